@@ -0,0 +1,13 @@
+// Package cpu reports the processor features used to select assembly
+// implementations at run time.
+package cpu
+
+var X86 struct {
+	HasAES       bool
+	HasPCLMULQDQ bool
+	HasSSSE3     bool
+	HasSSE41     bool
+	HasAVX       bool
+	HasAVX2      bool
+	HasBMI2      bool
+}
@@ -0,0 +1,38 @@
+package cpu
+
+func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+
+func xgetbv() (eax, edx uint32)
+
+func isSet(bit uint, value uint32) bool {
+	return value&(1<<bit) != 0
+}
+
+func init() {
+	maxID, _, _, _ := cpuid(0, 0)
+	if maxID < 1 {
+		return
+	}
+
+	_, _, ecx1, _ := cpuid(1, 0)
+	X86.HasPCLMULQDQ = isSet(1, ecx1)
+	X86.HasSSSE3 = isSet(9, ecx1)
+	X86.HasSSE41 = isSet(19, ecx1)
+	X86.HasAES = isSet(25, ecx1)
+
+	// AVX state must be enabled by the OS (XMM and YMM bits of XCR0).
+	osAVX := false
+	if isSet(27, ecx1) {
+		eax, _ := xgetbv()
+		osAVX = eax&6 == 6
+	}
+	X86.HasAVX = isSet(28, ecx1) && osAVX
+
+	if maxID < 7 {
+		return
+	}
+
+	_, ebx7, _, _ := cpuid(7, 0)
+	X86.HasAVX2 = isSet(5, ebx7) && osAVX
+	X86.HasBMI2 = isSet(8, ebx7)
+}
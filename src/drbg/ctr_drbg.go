@@ -0,0 +1,183 @@
+package drbg
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"io"
+	"opensm/src/sm4"
+	"time"
+)
+
+const (
+	keyLen     = 16
+	blockLen   = sm4.BlockSize
+	ctrSeedLen = keyLen + blockLen
+)
+
+// ctrEntropyLen is the entropy input length for a 128-bit security strength.
+const ctrEntropyLen = 16
+
+// CtrDRBG is the SM4 CTR_DRBG with derivation function. It is not safe for
+// concurrent use.
+type CtrDRBG struct {
+	source  io.Reader
+	pr      bool
+	block   cipher.Block
+	v       [blockLen]byte
+	counter uint64
+	seeded  time.Time
+}
+
+// NewCtrDRBG instantiates an SM4 CTR_DRBG with entropy and a nonce read from
+// source (crypto/rand.Reader if nil) and the optional personalization string.
+// With predictionResistance set, every request reseeds first.
+func NewCtrDRBG(source io.Reader, personalization []byte, predictionResistance bool) (*CtrDRBG, error) {
+	source = entropySource(source)
+	entropy, err := readEntropy(source, ctrEntropyLen+ctrEntropyLen/2)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &CtrDRBG{
+		source: source,
+		pr:     predictionResistance,
+	}
+
+	d.block, _ = sm4.NewCipher(make([]byte, keyLen))
+	d.update(blockCipherDF(ctrSeedLen, entropy, personalization))
+	d.counter = 1
+	d.seeded = now()
+
+	return d, nil
+}
+
+// bcc is BCC of SP 800-90A 10.3.3 over a whole number of blocks.
+func bcc(block cipher.Block, data []byte) []byte {
+	chain := make([]byte, blockLen)
+	for ; len(data) > 0; data = data[blockLen:] {
+		for i := range chain {
+			chain[i] ^= data[i]
+		}
+		block.Encrypt(chain, chain)
+	}
+	return chain
+}
+
+// blockCipherDF is Block_Cipher_df of SP 800-90A 10.3.2 on the concatenation
+// of inputs.
+func blockCipherDF(n int, inputs ...[]byte) []byte {
+	l := 0
+	for _, in := range inputs {
+		l += len(in)
+	}
+
+	// IV || L || N || input || 0x80, zero padded to a block
+	s := make([]byte, blockLen+8, blockLen+8+l+blockLen)
+	binary.BigEndian.PutUint32(s[blockLen:], uint32(l))
+	binary.BigEndian.PutUint32(s[blockLen+4:], uint32(n))
+	for _, in := range inputs {
+		s = append(s, in...)
+	}
+	s = append(s, 0x80)
+	for len(s)%blockLen != 0 {
+		s = append(s, 0)
+	}
+
+	k := make([]byte, keyLen)
+	for i := range k {
+		k[i] = byte(i)
+	}
+	block, _ := sm4.NewCipher(k)
+
+	temp := make([]byte, 0, ctrSeedLen+blockLen)
+	for i := uint32(0); len(temp) < ctrSeedLen; i++ {
+		binary.BigEndian.PutUint32(s[:4], i)
+		temp = append(temp, bcc(block, s)...)
+	}
+
+	block, _ = sm4.NewCipher(temp[:keyLen])
+	x := temp[keyLen:ctrSeedLen]
+
+	out := make([]byte, 0, n+blockLen)
+	for len(out) < n {
+		block.Encrypt(x, x)
+		out = append(out, x...)
+	}
+
+	return out[:n]
+}
+
+func incr(v []byte) {
+	for i := len(v) - 1; i >= 0; i-- {
+		v[i]++
+		if v[i] != 0 {
+			return
+		}
+	}
+}
+
+// update is CTR_DRBG_Update of SP 800-90A 10.2.1.2.
+func (d *CtrDRBG) update(provided []byte) {
+	temp := make([]byte, ctrSeedLen)
+	for i := 0; i < ctrSeedLen; i += blockLen {
+		incr(d.v[:])
+		d.block.Encrypt(temp[i:], d.v[:])
+	}
+
+	for i := range provided {
+		temp[i] ^= provided[i]
+	}
+
+	d.block, _ = sm4.NewCipher(temp[:keyLen])
+	copy(d.v[:], temp[keyLen:])
+}
+
+func (d *CtrDRBG) reseed(entropy, additional []byte) {
+	d.update(blockCipherDF(ctrSeedLen, entropy, additional))
+	d.counter = 1
+	d.seeded = now()
+}
+
+func (d *CtrDRBG) needsReseed() bool {
+	return reseedDue(d.counter, d.seeded)
+}
+
+func (d *CtrDRBG) generate(out, additional []byte) {
+	if len(additional) > 0 {
+		additional = blockCipherDF(ctrSeedLen, additional)
+		d.update(additional)
+	}
+
+	var ks [blockLen]byte
+	for len(out) > 0 {
+		incr(d.v[:])
+		d.block.Encrypt(ks[:], d.v[:])
+		k := copy(out, ks[:])
+		out = out[k:]
+	}
+
+	d.update(additional)
+	d.counter++
+}
+
+// Reseed mixes fresh entropy from the source and the optional additional
+// input into the state.
+func (d *CtrDRBG) Reseed(additional []byte) error {
+	entropy, err := readEntropy(d.source, ctrEntropyLen)
+	if err != nil {
+		return err
+	}
+	d.reseed(entropy, additional)
+	return nil
+}
+
+// Generate fills out, at most MaxRequest bytes, with pseudorandom bytes using
+// the optional additional input.
+func (d *CtrDRBG) Generate(out, additional []byte) error {
+	return generateWith(d, d.source, ctrEntropyLen, d.pr, out, additional)
+}
+
+// Read fills p with pseudorandom bytes. It implements io.Reader.
+func (d *CtrDRBG) Read(p []byte) (int, error) {
+	return read(d, d.source, ctrEntropyLen, d.pr, p)
+}
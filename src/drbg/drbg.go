@@ -0,0 +1,97 @@
+// Package drbg implements the SM3 Hash_DRBG and SM4 CTR_DRBG deterministic
+// random bit generators of GM/T 0105 (NIST SP 800-90A with SM3 and SM4).
+//
+// Both generators satisfy io.Reader and can be passed wherever the sm2
+// package takes a source of randomness. Neither is safe for concurrent use;
+// callers sharing one must serialize access, for example with a sync.Mutex.
+package drbg
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"time"
+)
+
+// ReseedInterval is the number of generate requests allowed between two
+// reseeds, as limited by GM/T 0105. The generators reseed themselves from
+// their entropy source when it is reached.
+const ReseedInterval = 1 << 20
+
+// ReseedTime is the longest time GM/T 0105 allows between two reseeds at the
+// security level of ReseedInterval. A generate request made later reseeds
+// first.
+const ReseedTime = 600 * time.Second
+
+// now is the clock ReseedTime is measured against.
+var now = time.Now
+
+// MaxRequest is the largest number of bytes a single generate request may
+// return (2^19 bits, as in SP 800-90A).
+const MaxRequest = 1 << 16
+
+var ErrRequestTooLarge = errors.New("opensm/drbg: request exceeds MaxRequest")
+
+// reseedDue reports whether a generator that has served counter-1 requests
+// since it was last seeded at seeded must reseed.
+func reseedDue(counter uint64, seeded time.Time) bool {
+	return counter > ReseedInterval || now().Sub(seeded) >= ReseedTime
+}
+
+func readEntropy(source io.Reader, n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(source, b); err != nil {
+		return nil, errors.New("opensm/drbg: reading entropy failed: " + err.Error())
+	}
+	return b, nil
+}
+
+func entropySource(source io.Reader) io.Reader {
+	if source == nil {
+		return rand.Reader
+	}
+	return source
+}
+
+// generator is the part shared by both DRBGs: Read splits a request into
+// generate calls and reseeds on schedule or, with prediction resistance, on
+// every call.
+type generator interface {
+	reseed(entropy, additional []byte)
+	generate(out, additional []byte)
+	needsReseed() bool
+}
+
+func read(g generator, source io.Reader, entropyLen int, pr bool, p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		k := len(p)
+		if k > MaxRequest {
+			k = MaxRequest
+		}
+		if err := generateWith(g, source, entropyLen, pr, p[:k], nil); err != nil {
+			return n, err
+		}
+		p = p[k:]
+		n += k
+	}
+	return n, nil
+}
+
+func generateWith(g generator, source io.Reader, entropyLen int, pr bool, out, additional []byte) error {
+	if len(out) > MaxRequest {
+		return ErrRequestTooLarge
+	}
+
+	if pr || g.needsReseed() {
+		entropy, err := readEntropy(source, entropyLen)
+		if err != nil {
+			return err
+		}
+		g.reseed(entropy, additional)
+		additional = nil
+	}
+
+	g.generate(out, additional)
+	return nil
+}
@@ -0,0 +1,151 @@
+package drbg
+
+import (
+	"encoding/binary"
+	"hash"
+	"io"
+	"opensm/src/sm3"
+	"time"
+)
+
+// seedLen is the Hash_DRBG seed length for SM3, 440 bits.
+const seedLen = 55
+
+// HashDRBG is the SM3 Hash_DRBG. It is not safe for concurrent use.
+type HashDRBG struct {
+	source  io.Reader
+	pr      bool
+	h       hash.Hash
+	v       [seedLen]byte
+	c       [seedLen]byte
+	counter uint64
+	seeded  time.Time
+}
+
+// hashEntropyLen is the entropy input length for a 256-bit security strength.
+const hashEntropyLen = 32
+
+// NewHashDRBG instantiates an SM3 Hash_DRBG with entropy and a nonce read
+// from source (crypto/rand.Reader if nil) and the optional personalization
+// string. With predictionResistance set, every request reseeds first.
+func NewHashDRBG(source io.Reader, personalization []byte, predictionResistance bool) (*HashDRBG, error) {
+	source = entropySource(source)
+	entropy, err := readEntropy(source, hashEntropyLen+hashEntropyLen/2)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &HashDRBG{
+		source: source,
+		pr:     predictionResistance,
+		h:      sm3.New(),
+	}
+
+	seed := d.hashDF(seedLen, entropy, personalization)
+	copy(d.v[:], seed)
+	copy(d.c[:], d.hashDF(seedLen, []byte{0x00}, d.v[:]))
+	d.counter = 1
+	d.seeded = now()
+
+	return d, nil
+}
+
+// hashDF is Hash_df of SP 800-90A 10.3.1 on the concatenation of inputs.
+func (d *HashDRBG) hashDF(n int, inputs ...[]byte) []byte {
+	var hdr [5]byte
+	binary.BigEndian.PutUint32(hdr[1:], uint32(n*8))
+
+	out := make([]byte, 0, n+sm3.Size)
+	for counter := byte(1); len(out) < n; counter++ {
+		hdr[0] = counter
+		d.h.Reset()
+		d.h.Write(hdr[:])
+		for _, in := range inputs {
+			d.h.Write(in)
+		}
+		out = d.h.Sum(out)
+	}
+
+	return out[:n]
+}
+
+// add sets v = v + x mod 2^(8*len(v)), for len(x) <= len(v).
+func add(v, x []byte) {
+	var carry uint16
+	for i, j := len(v)-1, len(x)-1; i >= 0; i, j = i-1, j-1 {
+		s := uint16(v[i]) + carry
+		if j >= 0 {
+			s += uint16(x[j])
+		}
+		v[i] = byte(s)
+		carry = s >> 8
+	}
+}
+
+func (d *HashDRBG) reseed(entropy, additional []byte) {
+	seed := d.hashDF(seedLen, []byte{0x01}, d.v[:], entropy, additional)
+	copy(d.v[:], seed)
+	copy(d.c[:], d.hashDF(seedLen, []byte{0x00}, d.v[:]))
+	d.counter = 1
+	d.seeded = now()
+}
+
+func (d *HashDRBG) needsReseed() bool {
+	return reseedDue(d.counter, d.seeded)
+}
+
+func (d *HashDRBG) generate(out, additional []byte) {
+	if len(additional) > 0 {
+		d.h.Reset()
+		d.h.Write([]byte{0x02})
+		d.h.Write(d.v[:])
+		d.h.Write(additional)
+		add(d.v[:], d.h.Sum(nil))
+	}
+
+	// Hashgen
+	data := d.v
+	var w []byte
+	for len(out) > 0 {
+		d.h.Reset()
+		d.h.Write(data[:])
+		w = d.h.Sum(w[:0])
+		k := copy(out, w)
+		out = out[k:]
+		add(data[:], []byte{1})
+	}
+
+	d.h.Reset()
+	d.h.Write([]byte{0x03})
+	d.h.Write(d.v[:])
+	h := d.h.Sum(nil)
+
+	var ctr [8]byte
+	binary.BigEndian.PutUint64(ctr[:], d.counter)
+	add(d.v[:], h)
+	add(d.v[:], d.c[:])
+	add(d.v[:], ctr[:])
+	d.counter++
+}
+
+// Reseed mixes fresh entropy from the source and the optional additional
+// input into the state.
+func (d *HashDRBG) Reseed(additional []byte) error {
+	entropy, err := readEntropy(d.source, hashEntropyLen)
+	if err != nil {
+		return err
+	}
+	d.reseed(entropy, additional)
+	return nil
+}
+
+// Generate fills out, at most MaxRequest bytes, with pseudorandom bytes using
+// the optional additional input.
+func (d *HashDRBG) Generate(out, additional []byte) error {
+	return generateWith(d, d.source, hashEntropyLen, d.pr, out, additional)
+}
+
+// Read fills p with pseudorandom bytes. It implements io.Reader.
+func (d *HashDRBG) Read(p []byte) (int, error) {
+	return read(d, d.source, hashEntropyLen, d.pr, p)
+}
@@ -0,0 +1,53 @@
+package drbg
+
+import (
+	"crypto/rand"
+	"io"
+	"testing"
+	"time"
+)
+
+// countingReader counts the bytes read from crypto/rand.
+type countingReader struct{ n int }
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.n += len(p)
+	return rand.Read(p)
+}
+
+func TestReseedTime(t *testing.T) {
+	clock := time.Unix(0, 0)
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	for name, f := range map[string]func(io.Reader) (io.Reader, error){
+		"Hash_DRBG": func(r io.Reader) (io.Reader, error) { return NewHashDRBG(r, nil, false) },
+		"CTR_DRBG":  func(r io.Reader) (io.Reader, error) { return NewCtrDRBG(r, nil, false) },
+	} {
+		src := new(countingReader)
+		d, err := f(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 32)
+
+		clock = clock.Add(ReseedTime - time.Second)
+		seeded := src.n
+		d.Read(buf)
+		if src.n != seeded {
+			t.Errorf("%s reseeded before ReseedTime", name)
+		}
+
+		clock = clock.Add(time.Second)
+		d.Read(buf)
+		if src.n == seeded {
+			t.Errorf("%s did not reseed after ReseedTime", name)
+		}
+
+		seeded = src.n
+		d.Read(buf)
+		if src.n != seeded {
+			t.Errorf("%s reseeded again right after reseeding", name)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Package fpe implements the format-preserving encryption modes FF1 and
+// FF3-1 of NIST SP 800-38G Rev. 1 over SM4.
+//
+// Inputs and outputs are strings of numerals taken from an alphabet, whose
+// length is the radix: "0123456789" for card numbers, for instance. The
+// ciphertext has the same length and alphabet as the plaintext.
+package fpe
+
+import (
+	"crypto/cipher"
+	"errors"
+	"math/big"
+	"opensm/src/sm4"
+	"unicode/utf8"
+)
+
+var (
+	// ErrAlphabet is returned for an alphabet that is too short, too long or
+	// repeats a character, and for input with characters outside it.
+	ErrAlphabet = errors.New("opensm/fpe: invalid alphabet or input character")
+	// ErrLength is returned for input outside the lengths allowed for the
+	// radix; the domain radix^length must be at least a million.
+	ErrLength = errors.New("opensm/fpe: input length outside the permitted range")
+	// ErrTweak is returned for a tweak of the wrong length.
+	ErrTweak = errors.New("opensm/fpe: invalid tweak length")
+)
+
+const (
+	maxRadix = 1 << 16
+	// minDomain is the smallest radix^minlen that SP 800-38G Rev. 1 allows.
+	minDomain = 1000000
+)
+
+// alphabet maps between characters and numerals.
+type alphabet struct {
+	chars []rune
+	index map[rune]int
+}
+
+func newAlphabet(s string) (*alphabet, error) {
+	a := &alphabet{index: make(map[rune]int)}
+	for _, r := range s {
+		if r == utf8.RuneError {
+			return nil, ErrAlphabet
+		}
+		if _, dup := a.index[r]; dup {
+			return nil, ErrAlphabet
+		}
+		a.index[r] = len(a.chars)
+		a.chars = append(a.chars, r)
+	}
+	if len(a.chars) < 2 || len(a.chars) > maxRadix {
+		return nil, ErrAlphabet
+	}
+	return a, nil
+}
+
+func (a *alphabet) radix() int {
+	return len(a.chars)
+}
+
+func (a *alphabet) numerals(s string) ([]int, error) {
+	x := make([]int, 0, len(s))
+	for _, r := range s {
+		i, ok := a.index[r]
+		if !ok {
+			return nil, ErrAlphabet
+		}
+		x = append(x, i)
+	}
+	return x, nil
+}
+
+func (a *alphabet) string(x []int) string {
+	r := make([]rune, len(x))
+	for i, v := range x {
+		r[i] = a.chars[v]
+	}
+	return string(r)
+}
+
+// minLength is the least n with radix^n >= minDomain, and at least 2.
+func minLength(radix int) int {
+	n, d := 0, 1
+	for d < minDomain {
+		d *= radix
+		n++
+	}
+	return max(n, 2)
+}
+
+// num returns NUM_radix(x), x[0] being the most significant numeral.
+func num(x []int, radix *big.Int) *big.Int {
+	n := new(big.Int)
+	d := new(big.Int)
+	for _, v := range x {
+		n.Mul(n, radix)
+		n.Add(n, d.SetInt64(int64(v)))
+	}
+	return n
+}
+
+// str sets x to STR^len(x)_radix(n), consuming n.
+func str(x []int, n, radix *big.Int) {
+	d := new(big.Int)
+	for i := len(x) - 1; i >= 0; i-- {
+		n.QuoRem(n, radix, d)
+		x[i] = int(d.Int64())
+	}
+}
+
+func newSM4(key []byte) (cipher.Block, error) {
+	return sm4.NewCipher(key)
+}
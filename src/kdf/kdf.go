@@ -0,0 +1,167 @@
+// Package kdf implements key derivation functions over SM3: HKDF (RFC 5869),
+// PBKDF2 (RFC 8018) and the KDF of GB/T 32918.
+package kdf
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+	"opensm/src/sm3"
+)
+
+var ErrLimit = errors.New("opensm/kdf: output length limit reached")
+
+// Extract returns the HKDF pseudorandom key for secret and salt. A nil salt
+// is replaced by sm3.Size zero bytes.
+func Extract(secret, salt []byte) []byte {
+	if salt == nil {
+		salt = make([]byte, sm3.Size)
+	}
+	mac := hmac.New(sm3.New, salt)
+	mac.Write(secret)
+	return mac.Sum(nil)
+}
+
+type hkdf struct {
+	mac     hash.Hash
+	info    []byte
+	counter byte
+	prev    []byte
+	buf     []byte
+}
+
+func (f *hkdf) Read(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if len(f.buf) == 0 {
+			if f.counter == 0xFF {
+				return n, ErrLimit
+			}
+			f.counter++
+
+			f.mac.Reset()
+			f.mac.Write(f.prev)
+			f.mac.Write(f.info)
+			f.mac.Write([]byte{f.counter})
+			f.prev = f.mac.Sum(f.prev[:0])
+			f.buf = f.prev
+		}
+
+		k := copy(p, f.buf)
+		f.buf = f.buf[k:]
+		p = p[k:]
+		n += k
+	}
+
+	return n, nil
+}
+
+// Expand returns a reader of the HKDF output keying material for the
+// pseudorandom key prk and context info. At most 255*sm3.Size bytes can be
+// read; beyond that Read returns ErrLimit.
+func Expand(prk, info []byte) io.Reader {
+	return &hkdf{
+		mac:  hmac.New(sm3.New, prk),
+		info: append([]byte(nil), info...),
+	}
+}
+
+// HKDF returns a reader of the output of Expand(Extract(secret, salt), info).
+func HKDF(secret, salt, info []byte) io.Reader {
+	return Expand(Extract(secret, salt), info)
+}
+
+// PBKDF2 derives a keyLen byte key from password and salt with iter
+// iterations of HMAC-SM3. It panics if iter is less than 1 or keyLen is
+// negative.
+func PBKDF2(password, salt []byte, iter, keyLen int) []byte {
+	if iter < 1 {
+		panic("opensm/kdf: iteration count must be positive")
+	}
+	if keyLen < 0 {
+		panic("opensm/kdf: negative key length")
+	}
+	mac := hmac.New(sm3.New, password)
+
+	var ctr [4]byte
+	dk := make([]byte, 0, (keyLen+sm3.Size-1)/sm3.Size*sm3.Size)
+	u := make([]byte, sm3.Size)
+	for block := uint32(1); len(dk) < keyLen; block++ {
+		binary.BigEndian.PutUint32(ctr[:], block)
+		mac.Reset()
+		mac.Write(salt)
+		mac.Write(ctr[:])
+		dk = mac.Sum(dk)
+		t := dk[len(dk)-sm3.Size:]
+		copy(u, t)
+
+		for i := 1; i < iter; i++ {
+			mac.Reset()
+			mac.Write(u)
+			u = mac.Sum(u[:0])
+			for j := range u {
+				t[j] ^= u[j]
+			}
+		}
+	}
+
+	return dk[:keyLen]
+}
+
+type sm2kdf struct {
+	h       hash.Hash
+	z       []byte
+	counter uint32
+	block   []byte
+	buf     []byte
+}
+
+func (f *sm2kdf) Read(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if len(f.buf) == 0 {
+			if f.counter == 0xFFFFFFFF {
+				return n, ErrLimit
+			}
+			f.counter++
+
+			var ct [4]byte
+			binary.BigEndian.PutUint32(ct[:], f.counter)
+			f.h.Reset()
+			f.h.Write(f.z)
+			f.h.Write(ct[:])
+			f.block = f.h.Sum(f.block[:0])
+			f.buf = f.block
+		}
+
+		k := copy(p, f.buf)
+		f.buf = f.buf[k:]
+		p = p[k:]
+		n += k
+	}
+
+	return n, nil
+}
+
+// NewKDF returns a reader of the GB/T 32918 key derivation function output
+// for the shared secret z: SM3(z || 1) || SM3(z || 2) || ..., with a 32-bit
+// big-endian counter.
+func NewKDF(z []byte) io.Reader {
+	return &sm2kdf{
+		h: sm3.New(),
+		z: append([]byte(nil), z...),
+	}
+}
+
+// KDF returns the first klen bytes of the GB/T 32918 key derivation function
+// output for z. It panics if klen is negative.
+func KDF(z []byte, klen int) []byte {
+	if klen < 0 {
+		panic("opensm/kdf: negative key length")
+	}
+	k := make([]byte, klen)
+	io.ReadFull(NewKDF(z), k)
+	return k
+}
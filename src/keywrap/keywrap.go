@@ -0,0 +1,177 @@
+// Package keywrap implements the key wrap algorithm of RFC 3394 and its
+// padded variant of RFC 5649 (NIST SP 800-38F KW and KWP) over a 128-bit
+// block cipher, in practice SM4 from sm4.NewCipher.
+package keywrap
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+var (
+	// ErrInvalidLength matches every LengthError under errors.Is.
+	ErrInvalidLength = errors.New("opensm/keywrap: invalid input length")
+	// ErrIntegrity is returned by Unwrap and UnwrapPad when the integrity
+	// check fails, whether from a wrong key or modified data.
+	ErrIntegrity = errors.New("opensm/keywrap: integrity check failed")
+)
+
+// LengthError is returned for input whose length, in bytes, the algorithm
+// does not accept.
+type LengthError int
+
+func (e LengthError) Error() string {
+	return "opensm/keywrap: invalid input length " + strconv.Itoa(int(e))
+}
+
+// Is reports whether target is ErrInvalidLength.
+func (e LengthError) Is(target error) bool {
+	return target == ErrInvalidLength
+}
+
+const (
+	// maxPadLen is the largest plaintext WrapPad accepts, bounded by its
+	// 32-bit length indicator.
+	maxPadLen = 1<<32 - 1
+)
+
+var (
+	defaultIV = [8]byte{0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6}
+	aivPrefix = [4]byte{0xA6, 0x59, 0x59, 0xA6}
+)
+
+func checkBlock(b cipher.Block) {
+	if b.BlockSize() != 16 {
+		panic("opensm/keywrap: a 128-bit block cipher is required")
+	}
+}
+
+// Wrap wraps plaintext, a multiple of 8 bytes and at least 16 bytes long,
+// under the key-encryption cipher b. The result is 8 bytes longer.
+func Wrap(b cipher.Block, plaintext []byte) ([]byte, error) {
+	checkBlock(b)
+	if len(plaintext) < 16 || len(plaintext)%8 != 0 {
+		return nil, LengthError(len(plaintext))
+	}
+
+	out := make([]byte, 8+len(plaintext))
+	copy(out, defaultIV[:])
+	copy(out[8:], plaintext)
+	wrap(b, out)
+	return out, nil
+}
+
+// Unwrap reverses Wrap.
+func Unwrap(b cipher.Block, ciphertext []byte) ([]byte, error) {
+	checkBlock(b)
+	if len(ciphertext) < 24 || len(ciphertext)%8 != 0 {
+		return nil, LengthError(len(ciphertext))
+	}
+
+	buf := append([]byte(nil), ciphertext...)
+	unwrap(b, buf)
+	if subtle.ConstantTimeCompare(buf[:8], defaultIV[:]) != 1 {
+		clear(buf)
+		return nil, ErrIntegrity
+	}
+	return buf[8:], nil
+}
+
+// WrapPad wraps plaintext of any length from 1 byte with the alternative
+// initial value of RFC 5649. The result is the plaintext rounded up to a
+// multiple of 8 bytes, plus 8.
+func WrapPad(b cipher.Block, plaintext []byte) ([]byte, error) {
+	checkBlock(b)
+	if len(plaintext) == 0 || uint64(len(plaintext)) > maxPadLen {
+		return nil, LengthError(len(plaintext))
+	}
+
+	padded := (len(plaintext) + 7) &^ 7
+	out := make([]byte, 8+padded)
+	copy(out, aivPrefix[:])
+	binary.BigEndian.PutUint32(out[4:], uint32(len(plaintext)))
+	copy(out[8:], plaintext)
+
+	if padded == 8 {
+		b.Encrypt(out, out)
+	} else {
+		wrap(b, out)
+	}
+	return out, nil
+}
+
+// UnwrapPad reverses WrapPad.
+func UnwrapPad(b cipher.Block, ciphertext []byte) ([]byte, error) {
+	checkBlock(b)
+	if len(ciphertext) < 16 || len(ciphertext)%8 != 0 {
+		return nil, LengthError(len(ciphertext))
+	}
+
+	buf := append([]byte(nil), ciphertext...)
+	if len(buf) == 16 {
+		b.Decrypt(buf, buf)
+	} else {
+		unwrap(b, buf)
+	}
+
+	// The prefix, the length and the zero padding are all checked before
+	// deciding, so that failures cannot be told apart.
+	n := uint64(len(buf) - 8)
+	mli := uint64(binary.BigEndian.Uint32(buf[4:8]))
+	ok := subtle.ConstantTimeCompare(buf[:4], aivPrefix[:])
+	ok &= lessOrEq(n-7, mli) & lessOrEq(mli, n)
+	var pad byte
+	for i := 8; i < len(buf); i++ {
+		pad |= buf[i] & byte(-lessOrEq(mli+8, uint64(i)))
+	}
+	ok &= subtle.ConstantTimeByteEq(pad, 0)
+
+	if ok != 1 {
+		clear(buf)
+		return nil, ErrIntegrity
+	}
+	return buf[8 : 8+mli], nil
+}
+
+// lessOrEq returns 1 if x <= y and 0 otherwise, in constant time, for
+// x, y < 2^63.
+func lessOrEq(x, y uint64) int {
+	return int(1 - (y-x)>>63)
+}
+
+// wrap applies the wrapping function W in place to buf = A || R[1] .. R[n].
+func wrap(b cipher.Block, buf []byte) {
+	n := len(buf)/8 - 1
+	var blk [16]byte
+	copy(blk[:8], buf[:8])
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(blk[8:], buf[8*i:8*i+8])
+			b.Encrypt(blk[:], blk[:])
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(blk[:8], binary.BigEndian.Uint64(blk[:8])^t)
+			copy(buf[8*i:], blk[8:])
+		}
+	}
+	copy(buf[:8], blk[:8])
+}
+
+// unwrap applies the inverse function W^-1 in place.
+func unwrap(b cipher.Block, buf []byte) {
+	n := len(buf)/8 - 1
+	var blk [16]byte
+	copy(blk[:8], buf[:8])
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(blk[:8], binary.BigEndian.Uint64(blk[:8])^t)
+			copy(blk[8:], buf[8*i:8*i+8])
+			b.Decrypt(blk[:], blk[:])
+			copy(buf[8*i:], blk[8:])
+		}
+	}
+	copy(buf[:8], blk[:8])
+}
@@ -0,0 +1,232 @@
+// Package mac implements the block cipher MACs of GB/T 15852.1-2020 and
+// ISO/IEC 9797-1:2011, intended for use with sm4.NewCipher.
+//
+// All six algorithms are CBC-MAC variants that differ in their first and
+// last block processing and their output transformation:
+//
+//	Alg1  CBC-MAC
+//	Alg2  EMAC: the final value is encrypted again under K1
+//	Alg3  ANSI retail MAC: the final value is decrypted under K1 and
+//	      encrypted again under K
+//	Alg4  MacDES style: the first block is encrypted again under K2 and
+//	      the final value under K1
+//	Alg5  CMAC (RFC 4493, NIST SP 800-38B) with its own padding
+//	Alg6  LMAC: the last block is encrypted under K1 instead of K
+//
+// The MACs are streaming hash.Hash values. Padding method 3 prefixes the
+// message with its length, so with it the message is buffered until Sum.
+package mac
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"hash"
+)
+
+// Algorithm is a MAC algorithm number of ISO/IEC 9797-1.
+type Algorithm int
+
+const (
+	Alg1 Algorithm = iota + 1
+	Alg2
+	Alg3
+	Alg4
+	Alg5
+	Alg6
+)
+
+// Padding is a padding method number of ISO/IEC 9797-1.
+type Padding int
+
+const (
+	// Pad1 appends as few zero bits as needed, at least one block in total.
+	Pad1 Padding = iota + 1
+	// Pad2 appends a single one bit, then as few zero bits as needed.
+	Pad2
+	// Pad3 prefixes a block holding the bit length, then pads as Pad1
+	// without adding a block to an empty message.
+	Pad3
+)
+
+const blockSize = 16
+
+// keyCount is how many keys each algorithm takes: K, then K1, then K2.
+var keyCount = [...]int{Alg1: 1, Alg2: 2, Alg3: 2, Alg4: 3, Alg5: 1, Alg6: 2}
+
+type mac struct {
+	alg  Algorithm
+	pad  Padding
+	size int
+	k    cipher.Block
+	k1   cipher.Block
+	k2   cipher.Block
+
+	// CMAC subkeys
+	sub1, sub2 [blockSize]byte
+
+	x     [blockSize]byte // chaining value
+	buf   [blockSize]byte // the last, possibly full, block not yet processed
+	n     int
+	first bool   // no block processed yet
+	msg   []byte // whole message for Pad3
+}
+
+// NewCMAC returns the 16-byte CMAC of the 128-bit block cipher b, the same
+// as NewISO9797(Alg5, 0, 16, b).
+func NewCMAC(b cipher.Block) hash.Hash {
+	h, err := NewISO9797(Alg5, 0, blockSize, b)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// NewISO9797 returns MAC algorithm alg with padding method pad, truncated to
+// size bytes. keys holds K, K1 and K2 as far as alg needs them; they must
+// be 128-bit block ciphers under independent keys. Alg5 uses its own
+// padding and ignores pad.
+func NewISO9797(alg Algorithm, pad Padding, size int, keys ...cipher.Block) (hash.Hash, error) {
+	if alg < Alg1 || alg > Alg6 {
+		return nil, errors.New("opensm/mac: unknown algorithm")
+	}
+	if alg != Alg5 && (pad < Pad1 || pad > Pad3) {
+		return nil, errors.New("opensm/mac: unknown padding method")
+	}
+	if size < 1 || size > blockSize {
+		return nil, errors.New("opensm/mac: invalid MAC size")
+	}
+	if len(keys) != keyCount[alg] {
+		return nil, errors.New("opensm/mac: wrong number of keys for the algorithm")
+	}
+	for _, k := range keys {
+		if k.BlockSize() != blockSize {
+			return nil, errors.New("opensm/mac: a 128-bit block cipher is required")
+		}
+	}
+
+	m := &mac{alg: alg, pad: pad, size: size, k: keys[0]}
+	if len(keys) > 1 {
+		m.k1 = keys[1]
+	}
+	if len(keys) > 2 {
+		m.k2 = keys[2]
+	}
+	if alg == Alg5 {
+		m.k.Encrypt(m.sub1[:], m.sub1[:])
+		double(&m.sub1)
+		m.sub2 = m.sub1
+		double(&m.sub2)
+	}
+	m.Reset()
+
+	return m, nil
+}
+
+// double multiplies v by x in GF(2^128) as CMAC subkey generation does.
+func double(v *[blockSize]byte) {
+	msb := v[0] >> 7
+	for i := 0; i < blockSize-1; i++ {
+		v[i] = v[i]<<1 | v[i+1]>>7
+	}
+	v[blockSize-1] = v[blockSize-1]<<1 ^ 0x87&-msb
+}
+
+func (m *mac) Size() int { return m.size }
+
+func (m *mac) BlockSize() int { return blockSize }
+
+func (m *mac) Reset() {
+	clear(m.x[:])
+	clear(m.buf[:])
+	m.n = 0
+	m.first = true
+	m.msg = m.msg[:0]
+}
+
+// block absorbs one full block that is not the last.
+func (m *mac) block(p []byte) {
+	subtle.XORBytes(m.x[:], m.x[:], p)
+	m.k.Encrypt(m.x[:], m.x[:])
+	if m.first && m.alg == Alg4 {
+		m.k2.Encrypt(m.x[:], m.x[:])
+	}
+	m.first = false
+}
+
+func (m *mac) Write(p []byte) (int, error) {
+	if m.pad == Pad3 && m.alg != Alg5 {
+		m.msg = append(m.msg, p...)
+		return len(p), nil
+	}
+	m.write(p)
+	return len(p), nil
+}
+
+// write keeps the latest block buffered, full or not, since only Sum knows
+// whether it is the last one.
+func (m *mac) write(p []byte) {
+	for len(p) > 0 {
+		if m.n == blockSize {
+			m.block(m.buf[:])
+			m.n = 0
+		}
+		k := copy(m.buf[m.n:], p)
+		m.n += k
+		p = p[k:]
+	}
+}
+
+func (m *mac) Sum(in []byte) []byte {
+	d := *m
+	if d.pad == Pad3 && d.alg != Alg5 {
+		d.msg = nil
+		var hdr [blockSize]byte
+		binary.BigEndian.PutUint64(hdr[8:], uint64(len(m.msg))*8)
+		d.write(hdr[:])
+		d.write(m.msg)
+	}
+
+	// build the final padded block
+	var last [blockSize]byte
+	copy(last[:], d.buf[:d.n])
+	switch {
+	case d.alg == Alg5:
+		if d.n == blockSize {
+			subtle.XORBytes(last[:], last[:], d.sub1[:])
+		} else {
+			last[d.n] = 0x80
+			subtle.XORBytes(last[:], last[:], d.sub2[:])
+		}
+	case d.pad == Pad2:
+		if d.n == blockSize {
+			d.block(last[:])
+			clear(last[:])
+			d.n = 0
+		}
+		last[d.n] = 0x80
+	}
+
+	// final iteration
+	subtle.XORBytes(d.x[:], d.x[:], last[:])
+	if d.alg == Alg6 {
+		d.k1.Encrypt(d.x[:], d.x[:])
+	} else {
+		d.k.Encrypt(d.x[:], d.x[:])
+		if d.first && d.alg == Alg4 {
+			d.k2.Encrypt(d.x[:], d.x[:])
+		}
+	}
+
+	// output transformation
+	switch d.alg {
+	case Alg2, Alg4:
+		d.k1.Encrypt(d.x[:], d.x[:])
+	case Alg3:
+		d.k1.Decrypt(d.x[:], d.x[:])
+		d.k.Encrypt(d.x[:], d.x[:])
+	}
+
+	return append(in, d.x[:d.size]...)
+}
@@ -0,0 +1,267 @@
+// Package modes provides one-shot and streaming ECB, CBC, CFB and OFB
+// encryption with PKCS #7, ISO/IEC 7816-4 or zero padding, intended for use
+// with sm4.NewCipher when exchanging data with legacy systems.
+//
+// Removing padding takes time independent of the padding bytes and fails
+// with ErrPadding alone, so that a decryption service does not become a
+// padding oracle. None of these modes is authenticated; new designs should
+// use an AEAD such as sm4.NewGCMSIV instead.
+package modes
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+	"opensm/src/sm4"
+)
+
+// Padding is a block padding scheme.
+type Padding int
+
+const (
+	// NoPadding requires input of whole blocks.
+	NoPadding Padding = iota
+	// PKCS7 appends n bytes of value n, 1 <= n <= block size (RFC 5652).
+	PKCS7
+	// ISO7816 appends 0x80 and then zero bytes, at least one byte in all
+	// (ISO/IEC 7816-4, also ISO/IEC 9797-1 method 2).
+	ISO7816
+	// Zero appends zero bytes up to a whole block, none to input that is
+	// already whole blocks. Unpadding strips all trailing zero bytes of the
+	// last block, so it only suits data that cannot end in a zero byte.
+	Zero
+)
+
+var (
+	// ErrInputLength is returned for ciphertext, or unpadded plaintext,
+	// that is not a whole number of blocks.
+	ErrInputLength = errors.New("opensm/modes: input not full blocks")
+	// ErrPadding is returned for any malformed padding.
+	ErrPadding = errors.New("opensm/modes: invalid padding")
+)
+
+// Pad returns p with padding to a multiple of blockSize, appended in place
+// when p has the capacity.
+func Pad(p []byte, pad Padding, blockSize int) ([]byte, error) {
+	r := len(p) % blockSize
+	switch pad {
+	case NoPadding:
+		if r != 0 {
+			return nil, ErrInputLength
+		}
+		return p, nil
+	case PKCS7:
+		n := blockSize - r
+		for i := 0; i < n; i++ {
+			p = append(p, byte(n))
+		}
+	case ISO7816:
+		p = append(p, 0x80)
+		for len(p)%blockSize != 0 {
+			p = append(p, 0)
+		}
+	case Zero:
+		for len(p)%blockSize != 0 {
+			p = append(p, 0)
+		}
+	default:
+		panic("opensm/modes: unknown padding")
+	}
+	return p, nil
+}
+
+// Unpad returns p without its padding. It looks only at the last block, and
+// the time taken does not depend on its contents.
+func Unpad(p []byte, pad Padding, blockSize int) ([]byte, error) {
+	if len(p)%blockSize != 0 {
+		return nil, ErrInputLength
+	}
+	if pad == NoPadding {
+		return p, nil
+	}
+	if len(p) == 0 {
+		if pad == Zero {
+			return p, nil
+		}
+		return nil, ErrPadding
+	}
+
+	last := p[len(p)-blockSize:]
+	var n, good int
+	switch pad {
+	case PKCS7:
+		n, good = unpadPKCS7(last)
+	case ISO7816:
+		n, good = unpadISO7816(last)
+	case Zero:
+		n, good = unpadZero(last), 1
+	default:
+		panic("opensm/modes: unknown padding")
+	}
+	if good != 1 {
+		return nil, ErrPadding
+	}
+	return p[:len(p)-n], nil
+}
+
+// unpadPKCS7 returns the padding length of the block b and 1 if the padding
+// is valid.
+func unpadPKCS7(b []byte) (n, good int) {
+	n = int(b[len(b)-1])
+	good = subtle.ConstantTimeLessOrEq(1, n) & subtle.ConstantTimeLessOrEq(n, len(b))
+	for i := 1; i <= len(b); i++ {
+		inPad := subtle.ConstantTimeLessOrEq(i, n)
+		eq := subtle.ConstantTimeByteEq(b[len(b)-i], byte(n))
+		good &= ^inPad&1 | eq
+	}
+	return n, good
+}
+
+// unpadISO7816 finds the 0x80 marker behind trailing zero bytes in b.
+func unpadISO7816(b []byte) (n, good int) {
+	found, bad := 0, 0
+	for i := 1; i <= len(b); i++ {
+		c := b[len(b)-i]
+		isZero := subtle.ConstantTimeByteEq(c, 0)
+		isMarker := subtle.ConstantTimeByteEq(c, 0x80)
+		searching := found ^ 1
+		bad |= searching &^ (isZero | isMarker)
+		n = subtle.ConstantTimeSelect(searching&isMarker, i, n)
+		found |= searching & isMarker
+	}
+	return n, found &^ bad
+}
+
+// unpadZero counts the trailing zero bytes of b.
+func unpadZero(b []byte) int {
+	n, zeros := 0, 1
+	for i := 1; i <= len(b); i++ {
+		zeros &= subtle.ConstantTimeByteEq(b[len(b)-i], 0)
+		n += zeros
+	}
+	return n
+}
+
+// InsecureECB is passed to the ECB functions to opt in to a mode that shows
+// which plaintext blocks are equal, for legacy interfaces that require it.
+type InsecureECB struct{}
+
+type ecb struct {
+	b       cipher.Block
+	decrypt bool
+}
+
+// NewECBEncrypter returns a cipher.BlockMode encrypting each block on its
+// own with b.
+func NewECBEncrypter(b cipher.Block, _ InsecureECB) cipher.BlockMode {
+	return &ecb{b: b}
+}
+
+// NewECBDecrypter returns the decrypting counterpart of NewECBEncrypter.
+func NewECBDecrypter(b cipher.Block, _ InsecureECB) cipher.BlockMode {
+	return &ecb{b: b, decrypt: true}
+}
+
+func (e *ecb) BlockSize() int {
+	return e.b.BlockSize()
+}
+
+func (e *ecb) CryptBlocks(dst, src []byte) {
+	bs := e.b.BlockSize()
+	if len(src)%bs != 0 {
+		panic("crypto/cipher: input not full blocks")
+	}
+	if len(dst) < len(src) {
+		panic("crypto/cipher: output smaller than input")
+	}
+	if bb, ok := e.b.(sm4.Blocks); ok {
+		if e.decrypt {
+			bb.DecryptBlocks(dst[:len(src)], src)
+		} else {
+			bb.EncryptBlocks(dst[:len(src)], src)
+		}
+		return
+	}
+	for i := 0; i < len(src); i += bs {
+		if e.decrypt {
+			e.b.Decrypt(dst[i:i+bs], src[i:i+bs])
+		} else {
+			e.b.Encrypt(dst[i:i+bs], src[i:i+bs])
+		}
+	}
+}
+
+// encrypt pads a copy of plaintext and encrypts it with m.
+func encrypt(m cipher.BlockMode, plaintext []byte, pad Padding) ([]byte, error) {
+	out := make([]byte, len(plaintext), len(plaintext)+m.BlockSize())
+	copy(out, plaintext)
+	out, err := Pad(out, pad, m.BlockSize())
+	if err != nil {
+		return nil, err
+	}
+	m.CryptBlocks(out, out)
+	return out, nil
+}
+
+// decrypt decrypts ciphertext with m and removes the padding.
+func decrypt(m cipher.BlockMode, ciphertext []byte, pad Padding) ([]byte, error) {
+	if len(ciphertext)%m.BlockSize() != 0 {
+		return nil, ErrInputLength
+	}
+	out := make([]byte, len(ciphertext))
+	m.CryptBlocks(out, ciphertext)
+	p, err := Unpad(out, pad, m.BlockSize())
+	if err != nil {
+		clear(out)
+	}
+	return p, err
+}
+
+// EncryptECB pads and encrypts plaintext in ECB mode.
+func EncryptECB(b cipher.Block, optIn InsecureECB, plaintext []byte, pad Padding) ([]byte, error) {
+	return encrypt(NewECBEncrypter(b, optIn), plaintext, pad)
+}
+
+// DecryptECB decrypts ciphertext in ECB mode and removes the padding.
+func DecryptECB(b cipher.Block, optIn InsecureECB, ciphertext []byte, pad Padding) ([]byte, error) {
+	return decrypt(NewECBDecrypter(b, optIn), ciphertext, pad)
+}
+
+// EncryptCBC pads and encrypts plaintext in CBC mode. The iv must be one
+// block long and unpredictable.
+func EncryptCBC(b cipher.Block, iv, plaintext []byte, pad Padding) ([]byte, error) {
+	return encrypt(cipher.NewCBCEncrypter(b, iv), plaintext, pad)
+}
+
+// DecryptCBC decrypts ciphertext in CBC mode and removes the padding.
+func DecryptCBC(b cipher.Block, iv, ciphertext []byte, pad Padding) ([]byte, error) {
+	return decrypt(cipher.NewCBCDecrypter(b, iv), ciphertext, pad)
+}
+
+// EncryptCFB encrypts plaintext in full-block CFB mode. Stream modes need no
+// padding; the output is as long as the input.
+func EncryptCFB(b cipher.Block, iv, plaintext []byte) []byte {
+	out := make([]byte, len(plaintext))
+	NewCFBEncrypter(b, iv).XORKeyStream(out, plaintext)
+	return out
+}
+
+// DecryptCFB decrypts ciphertext in full-block CFB mode.
+func DecryptCFB(b cipher.Block, iv, ciphertext []byte) []byte {
+	out := make([]byte, len(ciphertext))
+	NewCFBDecrypter(b, iv).XORKeyStream(out, ciphertext)
+	return out
+}
+
+// EncryptOFB encrypts plaintext in OFB mode.
+func EncryptOFB(b cipher.Block, iv, plaintext []byte) []byte {
+	out := make([]byte, len(plaintext))
+	NewOFB(b, iv).XORKeyStream(out, plaintext)
+	return out
+}
+
+// DecryptOFB decrypts ciphertext in OFB mode, the same operation as
+// EncryptOFB.
+func DecryptOFB(b cipher.Block, iv, ciphertext []byte) []byte {
+	return EncryptOFB(b, iv, ciphertext)
+}
@@ -0,0 +1,200 @@
+package modes
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+	"io"
+)
+
+// streamBuffer is about how much a streaming writer or reader processes at
+// once.
+const streamBuffer = 4096
+
+var errClosed = errors.New("opensm/modes: write after close")
+
+// feedback is full-block CFB or OFB, which differ only in what is fed back
+// into the cipher: the ciphertext or the cipher output.
+type feedback struct {
+	b       cipher.Block
+	reg     []byte
+	ks      []byte
+	used    int
+	ofb     bool
+	decrypt bool
+}
+
+func newFeedback(b cipher.Block, iv []byte, ofb, decrypt bool) cipher.Stream {
+	bs := b.BlockSize()
+	if len(iv) != bs {
+		panic("opensm/modes: IV length must equal block size")
+	}
+	f := &feedback{b: b, reg: make([]byte, bs), ks: make([]byte, bs), used: bs, ofb: ofb, decrypt: decrypt}
+	copy(f.reg, iv)
+	return f
+}
+
+// NewCFBEncrypter returns a cipher.Stream encrypting in full-block CFB mode
+// (CFB128 for SM4), as in GB/T 17964 and NIST SP 800-38A.
+func NewCFBEncrypter(b cipher.Block, iv []byte) cipher.Stream {
+	return newFeedback(b, iv, false, false)
+}
+
+// NewCFBDecrypter returns a cipher.Stream decrypting in full-block CFB mode.
+func NewCFBDecrypter(b cipher.Block, iv []byte) cipher.Stream {
+	return newFeedback(b, iv, false, true)
+}
+
+// NewOFB returns a cipher.Stream encrypting or decrypting in OFB mode.
+func NewOFB(b cipher.Block, iv []byte) cipher.Stream {
+	return newFeedback(b, iv, true, false)
+}
+
+func (f *feedback) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("crypto/cipher: output smaller than input")
+	}
+	for len(src) > 0 {
+		if f.used == len(f.ks) {
+			f.b.Encrypt(f.ks, f.reg)
+			f.used = 0
+			if f.ofb {
+				copy(f.reg, f.ks)
+			}
+		}
+		if !f.ofb && f.decrypt {
+			// the ciphertext is fed back before it is overwritten in place
+			copy(f.reg[f.used:], src[:min(len(src), len(f.ks)-f.used)])
+		}
+		n := subtle.XORBytes(dst, src, f.ks[f.used:])
+		if !f.ofb && !f.decrypt {
+			copy(f.reg[f.used:], dst[:n])
+		}
+		f.used += n
+		dst, src = dst[n:], src[n:]
+	}
+}
+
+type encryptWriter struct {
+	w    io.Writer
+	m    cipher.BlockMode
+	pad  Padding
+	buf  []byte
+	size int // whole blocks buffered before encrypting
+	err  error
+	done bool
+}
+
+// NewEncryptWriter returns a writer that encrypts with the block mode m,
+// such as cipher.NewCBCEncrypter or NewECBEncrypter, into w. Close pads and
+// writes the last block; it does not close w.
+func NewEncryptWriter(w io.Writer, m cipher.BlockMode, pad Padding) io.WriteCloser {
+	bs := m.BlockSize()
+	size := max(streamBuffer/bs, 1) * bs
+	return &encryptWriter{w: w, m: m, pad: pad, buf: make([]byte, 0, size+bs), size: size}
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.done {
+		return 0, errClosed
+	}
+	written := 0
+	for len(p) > 0 && e.err == nil {
+		n := copy(e.buf[len(e.buf):e.size], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+		if len(e.buf) == e.size {
+			e.m.CryptBlocks(e.buf, e.buf)
+			_, e.err = e.w.Write(e.buf)
+			e.buf = e.buf[:0]
+		}
+	}
+	return written, e.err
+}
+
+func (e *encryptWriter) Close() error {
+	if e.done || e.err != nil {
+		return e.err
+	}
+	e.done = true
+
+	// whole blocks of the buffer are encrypted with the padded tail
+	out, err := Pad(e.buf, e.pad, e.m.BlockSize())
+	if err != nil {
+		e.err = err
+		return err
+	}
+	e.m.CryptBlocks(out, out)
+	_, e.err = e.w.Write(out)
+	return e.err
+}
+
+type decryptReader struct {
+	r   io.Reader
+	m   cipher.BlockMode
+	pad Padding
+	in  []byte
+	out []byte
+	buf []byte
+	err error
+}
+
+// NewDecryptReader returns a reader of the plaintext of r decrypted with the
+// block mode m, such as cipher.NewCBCDecrypter or NewECBDecrypter. With
+// padding, the last block is held back until r reports io.EOF and then
+// unpadded, so a padding error surfaces at the end of the stream.
+func NewDecryptReader(r io.Reader, m cipher.BlockMode, pad Padding) io.Reader {
+	size := streamBuffer + 2*m.BlockSize()
+	return &decryptReader{r: r, m: m, pad: pad, in: make([]byte, 0, size), buf: make([]byte, size)}
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.fill()
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+// fill reads more ciphertext and decrypts the blocks known not to be last.
+func (d *decryptReader) fill() {
+	bs := d.m.BlockSize()
+	n, err := d.r.Read(d.in[len(d.in):cap(d.in)])
+	d.in = d.in[:len(d.in)+n]
+
+	if err == io.EOF {
+		out := d.buf[:len(d.in)]
+		if len(d.in)%bs != 0 {
+			d.err = ErrInputLength
+			return
+		}
+		d.m.CryptBlocks(out, d.in)
+		d.in = d.in[:0]
+		if d.out, d.err = Unpad(out, d.pad, bs); d.err == nil {
+			d.err = io.EOF
+		}
+		return
+	}
+	if err != nil {
+		d.err = err
+		return
+	}
+
+	// keep at least one block back, as it may be the last
+	keep := 0
+	if d.pad != NoPadding {
+		keep = bs
+	}
+	m := max(len(d.in)-keep, 0) / bs * bs
+	if m == 0 {
+		return
+	}
+	d.m.CryptBlocks(d.buf[:m], d.in[:m])
+	d.out = d.buf[:m]
+	d.in = d.in[:copy(d.in, d.in[m:])]
+}
@@ -0,0 +1,79 @@
+package randtest
+
+import (
+	"math"
+	"math/bits"
+	"math/cmplx"
+)
+
+// fft transforms x in place; len(x) must be a power of two.
+func fft(x []complex128, inverse bool) {
+	n := len(x)
+	shift := 64 - bits.Len(uint(n-1))
+	for i := range x {
+		j := int(bits.Reverse64(uint64(i)) >> shift)
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	sign := -1.0
+	if inverse {
+		sign = 1
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Rect(1, sign*2*math.Pi/float64(size))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				u := x[start+k]
+				v := x[start+k+size/2] * w
+				x[start+k] = u + v
+				x[start+k+size/2] = u - v
+				w *= step
+			}
+		}
+	}
+}
+
+// dft returns the discrete Fourier transform of x for any length, using
+// Bluestein's algorithm on top of a power-of-two FFT.
+func dft(x []float64) []complex128 {
+	n := len(x)
+	m := 1
+	for m < 2*n-1 {
+		m <<= 1
+	}
+
+	// chirp w[k] = exp(-i*pi*k^2/n), with k^2 reduced mod 2n for precision
+	w := make([]complex128, n)
+	for k := 0; k < n; k++ {
+		kk := (uint64(k) * uint64(k)) % uint64(2*n)
+		w[k] = cmplx.Rect(1, -math.Pi*float64(kk)/float64(n))
+	}
+
+	a := make([]complex128, m)
+	b := make([]complex128, m)
+	for k := 0; k < n; k++ {
+		a[k] = complex(x[k], 0) * w[k]
+	}
+	b[0] = cmplx.Conj(w[0])
+	for k := 1; k < n; k++ {
+		b[k] = cmplx.Conj(w[k])
+		b[m-k] = b[k]
+	}
+
+	fft(a, false)
+	fft(b, false)
+	for i := range a {
+		a[i] *= b[i]
+	}
+	fft(a, true)
+
+	out := make([]complex128, n)
+	for k := 0; k < n; k++ {
+		out[k] = a[k] * w[k] / complex(float64(m), 0)
+	}
+	return out
+}
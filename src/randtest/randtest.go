@@ -0,0 +1,95 @@
+// Package randtest implements the randomness test battery of GM/T 0005
+// (closely related to NIST SP 800-22) for binary sequences.
+//
+// Run applies the whole battery with the GM/T 0005-2021 parameters to a
+// sample read from any io.Reader, such as crypto/rand.Reader or one of the
+// generators of package drbg. The individual tests are exported as well and
+// take the sequence as one bit per byte.
+package randtest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SampleBits is the sample length GM/T 0005 specifies for the battery.
+const SampleBits = 1000000
+
+// DefaultAlpha is the significance level of GM/T 0005.
+const DefaultAlpha = 0.01
+
+type Result struct {
+	Name   string
+	PValue float64
+	Pass   bool
+}
+
+// Unpack expands p into one bit per byte, most significant bit first.
+func Unpack(p []byte) []byte {
+	e := make([]byte, 0, len(p)*8)
+	for _, b := range p {
+		for i := 7; i >= 0; i-- {
+			e = append(e, b>>uint(i)&1)
+		}
+	}
+	return e
+}
+
+// Battery runs every test on the bit sequence e, which must hold at least
+// SampleBits bits, and reports which P-values reach the significance level
+// alpha.
+func Battery(e []byte, alpha float64) ([]Result, error) {
+	if len(e) < SampleBits {
+		return nil, fmt.Errorf("opensm/randtest: sequence of %d bits is shorter than %d", len(e), SampleBits)
+	}
+	if alpha <= 0 || alpha >= 1 {
+		return nil, errors.New("opensm/randtest: significance level out of range")
+	}
+
+	var results []Result
+	add := func(name string, p float64) {
+		results = append(results, Result{Name: name, PValue: p, Pass: p >= alpha})
+	}
+
+	add("frequency", Frequency(e))
+	add("block frequency m=10000", BlockFrequency(e, 10000))
+	add("poker m=4", Poker(e, 4))
+	add("poker m=8", Poker(e, 8))
+	for _, m := range []int{3, 5} {
+		p1, p2 := Serial(e, m)
+		add(fmt.Sprintf("serial m=%d P1", m), p1)
+		add(fmt.Sprintf("serial m=%d P2", m), p2)
+	}
+	add("runs", Runs(e))
+	add("longest run of ones", LongestRunOfOnes(e))
+	add("binary derivation k=3", BinaryDerivation(e, 3))
+	add("binary derivation k=7", BinaryDerivation(e, 7))
+	for _, d := range []int{1, 2, 8, 16} {
+		add(fmt.Sprintf("autocorrelation d=%d", d), Autocorrelation(e, d))
+	}
+	add("rank", Rank(e))
+	add("cumulative sums forward", CumulativeSums(e, true))
+	add("cumulative sums backward", CumulativeSums(e, false))
+	add("approximate entropy m=2", ApproximateEntropy(e, 2))
+	add("approximate entropy m=5", ApproximateEntropy(e, 5))
+	add("linear complexity m=500", LinearComplexity(e, 500))
+	add("linear complexity m=1000", LinearComplexity(e, 1000))
+	add("universal L=7 Q=1280", Universal(e, 7, 1280))
+	add("discrete Fourier transform", DFT(e))
+
+	return results, nil
+}
+
+// Run reads nbits bits (rounded up to whole bytes) from r and runs the
+// battery on them. It reads nothing if nbits is below SampleBits.
+func Run(r io.Reader, nbits int, alpha float64) ([]Result, error) {
+	if nbits < SampleBits {
+		return nil, fmt.Errorf("opensm/randtest: sequence of %d bits is shorter than %d", nbits, SampleBits)
+	}
+	p := make([]byte, (nbits+7)/8)
+	if _, err := io.ReadFull(r, p); err != nil {
+		return nil, err
+	}
+	return Battery(Unpack(p)[:nbits], alpha)
+}
@@ -0,0 +1,101 @@
+package randtest
+
+import "math"
+
+// Constants of the Cephes incomplete gamma routines.
+const (
+	machEp = 1.11022302462515654042e-16
+	maxLog = 7.09782712893383996843e2
+	big    = 4.503599627370496e15
+	bigInv = 2.22044604925031308085e-16
+)
+
+// igam is the regularized lower incomplete gamma function P(a, x).
+func igam(a, x float64) float64 {
+	if x <= 0 || a <= 0 {
+		return 0
+	}
+	if x > 1 && x > a {
+		return 1 - igamc(a, x)
+	}
+
+	lg, _ := math.Lgamma(a)
+	ax := a*math.Log(x) - x - lg
+	if ax < -maxLog {
+		return 0
+	}
+	ax = math.Exp(ax)
+
+	r, c, ans := a, 1.0, 1.0
+	for {
+		r++
+		c *= x / r
+		ans += c
+		if c/ans <= machEp {
+			break
+		}
+	}
+
+	return ans * ax / a
+}
+
+// igamc is the regularized upper incomplete gamma function Q(a, x), the
+// survival function of the chi-square distribution used for most P-values.
+func igamc(a, x float64) float64 {
+	if x <= 0 || a <= 0 {
+		return 1
+	}
+	if x < 1 || x < a {
+		return 1 - igam(a, x)
+	}
+
+	lg, _ := math.Lgamma(a)
+	ax := a*math.Log(x) - x - lg
+	if ax < -maxLog {
+		return 0
+	}
+	ax = math.Exp(ax)
+
+	y := 1 - a
+	z := x + y + 1
+	c := 0.0
+	pkm2, qkm2 := 1.0, x
+	pkm1, qkm1 := x+1, z*x
+	ans := pkm1 / qkm1
+
+	for {
+		c++
+		y++
+		z += 2
+		yc := y * c
+		pk := pkm1*z - pkm2*yc
+		qk := qkm1*z - qkm2*yc
+
+		t := 1.0
+		if qk != 0 {
+			r := pk / qk
+			t = math.Abs((ans - r) / r)
+			ans = r
+		}
+
+		pkm2, pkm1 = pkm1, pk
+		qkm2, qkm1 = qkm1, qk
+		if math.Abs(pk) > big {
+			pkm2 *= bigInv
+			pkm1 *= bigInv
+			qkm2 *= bigInv
+			qkm1 *= bigInv
+		}
+
+		if t <= machEp {
+			break
+		}
+	}
+
+	return ans * ax
+}
+
+// normal is the standard normal cumulative distribution function.
+func normal(x float64) float64 {
+	return 0.5 * math.Erfc(-x/math.Sqrt2)
+}
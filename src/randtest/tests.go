@@ -0,0 +1,438 @@
+package randtest
+
+import "math"
+
+// Each test takes the sequence as one bit per byte (0 or 1) and returns its
+// P-value.
+
+// Frequency is the monobit frequency test.
+func Frequency(e []byte) float64 {
+	s := 0
+	for _, b := range e {
+		s += 2*int(b) - 1
+	}
+	sObs := math.Abs(float64(s)) / math.Sqrt(float64(len(e)))
+	return math.Erfc(sObs / math.Sqrt2)
+}
+
+// BlockFrequency is the frequency test within blocks of m bits.
+func BlockFrequency(e []byte, m int) float64 {
+	n := len(e) / m
+	chi2 := 0.0
+	for i := 0; i < n; i++ {
+		ones := 0
+		for _, b := range e[i*m : (i+1)*m] {
+			ones += int(b)
+		}
+		pi := float64(ones)/float64(m) - 0.5
+		chi2 += pi * pi
+	}
+	chi2 *= 4 * float64(m)
+	return igamc(float64(n)/2, chi2/2)
+}
+
+func pattern(e []byte, i, m int) int {
+	v := 0
+	for j := 0; j < m; j++ {
+		v = v<<1 | int(e[(i+j)%len(e)])
+	}
+	return v
+}
+
+// Poker is the poker test on non-overlapping m-bit patterns.
+func Poker(e []byte, m int) float64 {
+	n := len(e) / m
+	counts := make([]int, 1<<m)
+	for i := 0; i < n; i++ {
+		counts[pattern(e, i*m, m)]++
+	}
+
+	sum := 0.0
+	for _, c := range counts {
+		sum += float64(c) * float64(c)
+	}
+	v := float64(int(1)<<m)/float64(n)*sum - float64(n)
+	return igamc(float64(int(1)<<m-1)/2, v/2)
+}
+
+// psi2 is the ψ²_m statistic of the serial test: overlapping m-bit patterns
+// with the sequence wrapped around.
+func psi2(e []byte, m int) float64 {
+	if m <= 0 {
+		return 0
+	}
+
+	counts := make([]int, 1<<m)
+	for i := range e {
+		counts[pattern(e, i, m)]++
+	}
+
+	sum := 0.0
+	for _, c := range counts {
+		sum += float64(c) * float64(c)
+	}
+	n := float64(len(e))
+	return sum*float64(int(1)<<m)/n - n
+}
+
+// Serial is the serial (overlapping patterns) test for m-bit patterns. It
+// returns the two P-values of the first and second differences.
+func Serial(e []byte, m int) (float64, float64) {
+	p0, p1, p2 := psi2(e, m), psi2(e, m-1), psi2(e, m-2)
+	del1 := p0 - p1
+	del2 := p0 - 2*p1 + p2
+	return igamc(math.Pow(2, float64(m-2)), del1/2), igamc(math.Pow(2, float64(m-3)), del2/2)
+}
+
+// Runs is the total number of runs test.
+func Runs(e []byte) float64 {
+	n := float64(len(e))
+	ones := 0
+	for _, b := range e {
+		ones += int(b)
+	}
+	pi := float64(ones) / n
+	if math.Abs(pi-0.5) >= 2/math.Sqrt(n) {
+		// the frequency prerequisite fails
+		return 0
+	}
+
+	v := 1
+	for i := 1; i < len(e); i++ {
+		if e[i] != e[i-1] {
+			v++
+		}
+	}
+
+	x := math.Abs(float64(v)-2*n*pi*(1-pi)) / (2 * math.Sqrt(2*n) * pi * (1 - pi))
+	return math.Erfc(x)
+}
+
+// LongestRunOfOnes is the test for the longest run of ones in a block. The
+// block size and categories follow SP 800-22 for the sequence length: 8 bits
+// below 6272 bits, 128 bits below 750000 bits and 10000 bits above.
+func LongestRunOfOnes(e []byte) float64 {
+	var m, vMin int
+	var pi []float64
+	switch {
+	case len(e) < 6272:
+		m, vMin = 8, 1
+		pi = []float64{0.21484375, 0.3671875, 0.23046875, 0.1875}
+	case len(e) < 750000:
+		m, vMin = 128, 4
+		pi = []float64{0.1174035788, 0.242955959, 0.249363483, 0.17517706, 0.102701071, 0.112398847}
+	default:
+		m, vMin = 10000, 10
+		pi = []float64{0.0882, 0.2092, 0.2483, 0.1933, 0.1208, 0.0675, 0.0727}
+	}
+	k := len(pi) - 1
+
+	n := len(e) / m
+	nu := make([]int, len(pi))
+	for i := 0; i < n; i++ {
+		longest, run := 0, 0
+		for _, b := range e[i*m : (i+1)*m] {
+			if b == 1 {
+				run++
+				if run > longest {
+					longest = run
+				}
+			} else {
+				run = 0
+			}
+		}
+
+		c := longest - vMin
+		if c < 0 {
+			c = 0
+		} else if c > k {
+			c = k
+		}
+		nu[c]++
+	}
+
+	chi2 := 0.0
+	for i := range nu {
+		d := float64(nu[i]) - float64(n)*pi[i]
+		chi2 += d * d / (float64(n) * pi[i])
+	}
+	return igamc(float64(k)/2, chi2/2)
+}
+
+// BinaryDerivation is the binary derivation test: the frequency of the
+// sequence after k rounds of XORing adjacent bits.
+func BinaryDerivation(e []byte, k int) float64 {
+	d := append([]byte(nil), e...)
+	for r := 0; r < k; r++ {
+		for i := 0; i < len(d)-1; i++ {
+			d[i] ^= d[i+1]
+		}
+		d = d[:len(d)-1]
+	}
+	return Frequency(d)
+}
+
+// Autocorrelation is the autocorrelation test with shift d.
+func Autocorrelation(e []byte, d int) float64 {
+	a := 0
+	for i := 0; i < len(e)-d; i++ {
+		a += int(e[i] ^ e[i+d])
+	}
+	n := float64(len(e) - d)
+	v := 2 * (float64(a) - n/2) / math.Sqrt(n)
+	return math.Erfc(math.Abs(v) / math.Sqrt2)
+}
+
+// rankProb is the probability that a random 32x32 binary matrix has rank r.
+func rankProb(r int) float64 {
+	const q = 32
+	p := math.Pow(2, float64(r*(2*q-r)-q*q))
+	for i := 0; i < r; i++ {
+		t := 1 - math.Pow(2, float64(i-q))
+		p *= t * t / (1 - math.Pow(2, float64(i-r)))
+	}
+	return p
+}
+
+func rank32(rows *[32]uint32) int {
+	r := 0
+	for col := 31; col >= 0 && r < 32; col-- {
+		pivot := -1
+		for i := r; i < 32; i++ {
+			if rows[i]>>uint(col)&1 == 1 {
+				pivot = i
+				break
+			}
+		}
+		if pivot < 0 {
+			continue
+		}
+		rows[r], rows[pivot] = rows[pivot], rows[r]
+		for i := 0; i < 32; i++ {
+			if i != r && rows[i]>>uint(col)&1 == 1 {
+				rows[i] ^= rows[r]
+			}
+		}
+		r++
+	}
+	return r
+}
+
+// Rank is the binary matrix rank test on 32x32 matrices.
+func Rank(e []byte) float64 {
+	n := len(e) / (32 * 32)
+	full, full1 := 0, 0
+	for k := 0; k < n; k++ {
+		var rows [32]uint32
+		for i := range rows {
+			rows[i] = uint32(pattern(e, k*1024+i*32, 32))
+		}
+		switch rank32(&rows) {
+		case 32:
+			full++
+		case 31:
+			full1++
+		}
+	}
+
+	p32, p31 := rankProb(32), rankProb(31)
+	p30 := 1 - p32 - p31
+	fn := float64(n)
+	chi2 := math.Pow(float64(full)-p32*fn, 2)/(p32*fn) +
+		math.Pow(float64(full1)-p31*fn, 2)/(p31*fn) +
+		math.Pow(float64(n-full-full1)-p30*fn, 2)/(p30*fn)
+	return math.Exp(-chi2 / 2)
+}
+
+// CumulativeSums is the cumulative sums test, run from the start of the
+// sequence if forward is set and from its end otherwise.
+func CumulativeSums(e []byte, forward bool) float64 {
+	n := len(e)
+	s, z := 0, 0
+	for i := 0; i < n; i++ {
+		b := e[i]
+		if !forward {
+			b = e[n-1-i]
+		}
+		s += 2*int(b) - 1
+		if s > z {
+			z = s
+		} else if -s > z {
+			z = -s
+		}
+	}
+	if z == 0 {
+		return 0
+	}
+
+	sq := math.Sqrt(float64(n))
+	sum1 := 0.0
+	for k := (-n/z + 1) / 4; k <= (n/z-1)/4; k++ {
+		sum1 += normal(float64((4*k+1)*z)/sq) - normal(float64((4*k-1)*z)/sq)
+	}
+	sum2 := 0.0
+	for k := (-n/z - 3) / 4; k <= (n/z-1)/4; k++ {
+		sum2 += normal(float64((4*k+3)*z)/sq) - normal(float64((4*k+1)*z)/sq)
+	}
+	return 1 - sum1 + sum2
+}
+
+func phi(e []byte, m int) float64 {
+	if m <= 0 {
+		return 0
+	}
+
+	counts := make([]int, 1<<m)
+	for i := range e {
+		counts[pattern(e, i, m)]++
+	}
+
+	n := float64(len(e))
+	sum := 0.0
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / n
+			sum += p * math.Log(p)
+		}
+	}
+	return sum
+}
+
+// ApproximateEntropy is the approximate entropy test for m-bit patterns.
+func ApproximateEntropy(e []byte, m int) float64 {
+	apEn := phi(e, m) - phi(e, m+1)
+	chi2 := 2 * float64(len(e)) * (math.Ln2 - apEn)
+	return igamc(math.Pow(2, float64(m-1)), chi2/2)
+}
+
+// berlekampMassey returns the linear complexity of the bit sequence s.
+func berlekampMassey(s []byte) int {
+	n := len(s)
+	c := make([]byte, n+1)
+	b := make([]byte, n+1)
+	t := make([]byte, n+1)
+	c[0], b[0] = 1, 1
+
+	l, m := 0, -1
+	for i := 0; i < n; i++ {
+		d := s[i]
+		for j := 1; j <= l; j++ {
+			d ^= c[j] & s[i-j]
+		}
+		if d == 0 {
+			continue
+		}
+
+		copy(t, c)
+		for j := 0; j+i-m <= n; j++ {
+			c[j+i-m] ^= b[j]
+		}
+		if l <= i/2 {
+			l = i + 1 - l
+			m = i
+			copy(b, t)
+		}
+	}
+	return l
+}
+
+// LinearComplexity is the linear complexity test on blocks of m bits.
+func LinearComplexity(e []byte, m int) float64 {
+	pi := []float64{0.01047, 0.03125, 0.12500, 0.50000, 0.25000, 0.06250, 0.020833}
+	n := len(e) / m
+
+	fm := float64(m)
+	mean := fm/2 + (9+math.Pow(-1, fm+1))/36 - (fm/3+2.0/9.0)/math.Pow(2, fm)
+	sign := 1.0
+	if m%2 == 1 {
+		sign = -1
+	}
+
+	nu := make([]int, len(pi))
+	for i := 0; i < n; i++ {
+		t := sign*(float64(berlekampMassey(e[i*m:(i+1)*m]))-mean) + 2.0/9.0
+		switch {
+		case t <= -2.5:
+			nu[0]++
+		case t <= -1.5:
+			nu[1]++
+		case t <= -0.5:
+			nu[2]++
+		case t <= 0.5:
+			nu[3]++
+		case t <= 1.5:
+			nu[4]++
+		case t <= 2.5:
+			nu[5]++
+		default:
+			nu[6]++
+		}
+	}
+
+	chi2 := 0.0
+	for i := range nu {
+		d := float64(nu[i]) - float64(n)*pi[i]
+		chi2 += d * d / (float64(n) * pi[i])
+	}
+	return igamc(float64(len(pi)-1)/2, chi2/2)
+}
+
+// Expected value and variance of Maurer's statistic for L = 6..16.
+var universalExpected = [...]float64{
+	6: 5.2177052, 6.1962507, 7.1836656, 8.1764248, 9.1723243, 10.170032,
+	11.168765, 12.168070, 13.167693, 14.167488, 15.167379,
+}
+
+var universalVariance = [...]float64{
+	6: 2.954, 3.125, 3.238, 3.311, 3.356, 3.384, 3.401, 3.410, 3.416, 3.419, 3.421,
+}
+
+// Universal is Maurer's universal statistical test with l-bit blocks, the
+// first q of which initialize the table. l must be in [6, 16].
+func Universal(e []byte, l, q int) float64 {
+	k := len(e)/l - q
+	if l < 6 || l > 16 || k <= 0 {
+		return 0
+	}
+
+	table := make([]int, 1<<l)
+	for i := 1; i <= q; i++ {
+		table[pattern(e, (i-1)*l, l)] = i
+	}
+
+	sum := 0.0
+	for i := q + 1; i <= q+k; i++ {
+		p := pattern(e, (i-1)*l, l)
+		sum += math.Log2(float64(i - table[p]))
+		table[p] = i
+	}
+
+	fn := sum / float64(k)
+	fl, fk := float64(l), float64(k)
+	c := 0.7 - 0.8/fl + (4+32/fl)*math.Pow(fk, -3/fl)/15
+	sigma := c * math.Sqrt(universalVariance[l]/fk)
+	return math.Erfc(math.Abs(fn-universalExpected[l]) / (math.Sqrt2 * sigma))
+}
+
+// DFT is the discrete Fourier transform (spectral) test. The variance of the
+// peak count uses the corrected n*0.95*0.05/3.8 of GM/T 0005-2021.
+func DFT(e []byte) float64 {
+	x := make([]float64, len(e))
+	for i, b := range e {
+		x[i] = 2*float64(b) - 1
+	}
+	f := dft(x)
+
+	n := float64(len(e))
+	t := math.Sqrt(math.Log(1/0.05) * n)
+	n0 := 0.95 * n / 2
+	n1 := 0
+	for _, v := range f[:len(e)/2] {
+		if math.Hypot(real(v), imag(v)) < t {
+			n1++
+		}
+	}
+
+	d := (float64(n1) - n0) / math.Sqrt(n*0.95*0.05/3.8)
+	return math.Erfc(math.Abs(d) / math.Sqrt2)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"math/big"
+	"opensm/src/sm3"
 	"sync"
 )
 
@@ -369,3 +370,27 @@ func Verify(pub *PublicKey, hash []byte, r, s *big.Int) bool {
 		return false
 	}
 }
+
+// DefaultUID is the signer identity of GM/T 0009 for when none is agreed.
+var DefaultUID = []byte("1234567812345678")
+
+// ZA returns SM3(ENTL || uid || a || b || xG || yG || xA || yA), the hash of
+// the signer's identity and public key that SM2 signatures prefix to the
+// message before hashing it.
+func ZA(pub *PublicKey, uid []byte) ([]byte, error) {
+	if len(uid) >= 1<<13 {
+		return nil, fmt.Errorf("opensm/sm2: uid too long")
+	}
+	curve := SM2P256()
+	params := curve.Params()
+
+	h := sm3.New()
+	entl := len(uid) * 8
+	h.Write([]byte{byte(entl >> 8), byte(entl)})
+	h.Write(uid)
+	for _, v := range []*big.Int{sm2p256.A, params.B, params.Gx, params.Gy, pub.X, pub.Y} {
+		var b [32]byte
+		h.Write(v.FillBytes(b[:]))
+	}
+	return h.Sum(nil), nil
+}
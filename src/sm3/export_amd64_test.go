@@ -0,0 +1,14 @@
+//go:build amd64 && !purego
+
+package sm3
+
+// HasAVX2 reports whether SumMany can take the assembly path.
+var HasAVX2 = useAVX2
+
+// SetAsm selects the SumMany path and returns a function restoring the
+// previous one.
+func SetAsm(avx2 bool) (restore func()) {
+	old := useAVX2
+	useAVX2 = avx2
+	return func() { useAVX2 = old }
+}
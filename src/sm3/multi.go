@@ -0,0 +1,153 @@
+package sm3
+
+import (
+	"encoding/binary"
+	"opensm/src/util"
+)
+
+// lanes is the number of independent SM3 states compressed together.
+const lanes = 8
+
+// tRot[j] is T(j) <<< j, the per-round constant of CF.
+var tRot [64]uint32
+
+func init() {
+	for j := uint(0); j < 64; j++ {
+		tRot[j] = util.RotateLeft(T(j), j)
+	}
+}
+
+// block8Generic runs CF on eight states held in structure-of-arrays form:
+// dig[i][l] is word i of lane l, and w[j][l] is message word j of lane l,
+// of which the first 16 words are filled in by the caller.
+func block8Generic(dig *[8][lanes]uint32, w *[68][lanes]uint32) {
+	for j := 16; j < 68; j++ {
+		for l := 0; l < lanes; l++ {
+			w[j][l] = xorShiftP1(w[j-16][l]^w[j-9][l]^util.RotateLeft(w[j-3][l], 15)) ^ util.RotateLeft(w[j-13][l], 7) ^ w[j-6][l]
+		}
+	}
+
+	A, B, C, D, E, F, G, H := dig[0], dig[1], dig[2], dig[3], dig[4], dig[5], dig[6], dig[7]
+	for j := uint(0); j < 64; j++ {
+		for l := 0; l < lanes; l++ {
+			SS1 := util.RotateLeft(util.RotateLeft(A[l], 12)+E[l]+tRot[j], 7)
+			SS2 := SS1 ^ util.RotateLeft(A[l], 12)
+			TT1 := FF(A[l], B[l], C[l], j) + D[l] + SS2 + (w[j][l] ^ w[j+4][l])
+			TT2 := GG(E[l], F[l], G[l], j) + H[l] + SS1 + w[j][l]
+			D[l] = C[l]
+			C[l] = util.RotateLeft(B[l], 9)
+			B[l] = A[l]
+			A[l] = TT1
+			H[l] = G[l]
+			G[l] = util.RotateLeft(F[l], 19)
+			F[l] = E[l]
+			E[l] = xorShiftP0(TT2)
+		}
+	}
+
+	for l := 0; l < lanes; l++ {
+		dig[0][l] ^= A[l]
+		dig[1][l] ^= B[l]
+		dig[2][l] ^= C[l]
+		dig[3][l] ^= D[l]
+		dig[4][l] ^= E[l]
+		dig[5][l] ^= F[l]
+		dig[6][l] ^= G[l]
+		dig[7][l] ^= H[l]
+	}
+}
+
+type lane struct {
+	idx  int
+	msg  []byte
+	tail [2 * BlockSize]byte
+	rest []byte
+}
+
+func (l *lane) load(idx int, msg []byte) {
+	n := len(msg) &^ (BlockSize - 1)
+	l.idx = idx
+	l.msg = msg[:n]
+
+	k := copy(l.tail[:], msg[n:])
+	size := BlockSize
+	if k+9 > BlockSize {
+		size = 2 * BlockSize
+	}
+	clear(l.tail[k:])
+	l.tail[k] = 0x80
+	binary.BigEndian.PutUint64(l.tail[size-8:], uint64(len(msg))*8)
+	l.rest = l.tail[:size]
+}
+
+func (l *lane) next() []byte {
+	var p []byte
+	if len(l.msg) > 0 {
+		p, l.msg = l.msg[:BlockSize], l.msg[BlockSize:]
+	} else {
+		p, l.rest = l.rest[:BlockSize], l.rest[BlockSize:]
+	}
+	return p
+}
+
+func (l *lane) done() bool {
+	return len(l.msg) == 0 && len(l.rest) == 0
+}
+
+// SumMany returns the SM3 digest of every message in msgs. Messages are
+// hashed eight at a time with a multi-lane compression function, so it is
+// much faster than hashing them one by one when there are many short ones.
+func SumMany(msgs [][]byte) [][Size]byte {
+	out := make([][Size]byte, len(msgs))
+
+	var dig [8][lanes]uint32
+	var w [68][lanes]uint32
+	var ls [lanes]lane
+
+	next, active := 0, 0
+	start := func(l int) {
+		if next == len(msgs) {
+			ls[l].idx = -1
+			return
+		}
+
+		ls[l].load(next, msgs[next])
+		iv := [8]uint32{0x7380166f, 0x4914b2b9, 0x172442d7, 0xda8a0600, 0xa96f30bc, 0x163138aa, 0xe38dee4d, 0xb0fb0e4e}
+		for i := range iv {
+			dig[i][l] = iv[i]
+		}
+		next++
+		active++
+	}
+
+	for l := range ls {
+		start(l)
+	}
+
+	for active > 0 {
+		for l := range ls {
+			if ls[l].idx < 0 {
+				continue
+			}
+			p := ls[l].next()
+			for j := 0; j < 16; j++ {
+				w[j][l] = binary.BigEndian.Uint32(p[j*4:])
+			}
+		}
+
+		block8(&dig, &w)
+
+		for l := range ls {
+			if ls[l].idx < 0 || !ls[l].done() {
+				continue
+			}
+			for i := 0; i < 8; i++ {
+				binary.BigEndian.PutUint32(out[ls[l].idx][i*4:], dig[i][l])
+			}
+			active--
+			start(l)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,18 @@
+//go:build amd64 && !purego
+
+package sm3
+
+import "opensm/src/cpu"
+
+var useAVX2 = cpu.X86.HasAVX2
+
+//go:noescape
+func block8AVX2(dig *[8][lanes]uint32, w *[68][lanes]uint32)
+
+func block8(dig *[8][lanes]uint32, w *[68][lanes]uint32) {
+	if useAVX2 {
+		block8AVX2(dig, w)
+		return
+	}
+	block8Generic(dig, w)
+}
@@ -0,0 +1,195 @@
+//go:build amd64 && !purego
+
+#include "textflag.h"
+
+// Eight SM3 states are kept one word per YMM register, lane l of every
+// register belonging to message l. Y8-Y15 are scratch.
+
+// dst = src <<< n; src and dst may be the same register.
+#define ROL(n, src, dst, tmp) \
+	VPSRLD $(32-n), src, tmp \
+	VPSLLD $n, src, dst \
+	VPOR   tmp, dst, dst
+
+// dst = P1(dst)
+#define P1(dst) \
+	ROL(15, dst, Y9, Y11) \
+	ROL(23, dst, Y10, Y11) \
+	VPXOR Y9, dst, dst \
+	VPXOR Y10, dst, dst
+
+// Y8 = ROL(A, 12), Y10 = SS1, Y8 = SS2 on exit.
+#define SS(j, a, e) \
+	ROL(12, a, Y8, Y9) \
+	VPADDD       e, Y8, Y9 \
+	VPBROADCASTD (j*4)(DI), Y10 \
+	VPADDD       Y10, Y9, Y9 \
+	ROL(7, Y9, Y10, Y11) \
+	VPXOR        Y10, Y8, Y8
+
+// d = TT1 = ff + D + SS2 + (W[j] ^ W[j+4]), with ff in Y9. W[j] is left in Y11.
+#define TT1(j, d) \
+	VPADDD  d, Y9, Y9 \
+	VPADDD  Y8, Y9, Y9 \
+	VMOVDQU (j*32)(SI), Y11 \
+	VMOVDQU ((j+4)*32)(SI), Y12 \
+	VPXOR   Y11, Y12, Y12 \
+	VPADDD  Y12, Y9, d
+
+// h = P0(TT2), TT2 = gg + H + SS1 + W[j], with gg in Y12; then B <<<= 9 and
+// F <<<= 19.
+#define TT2(b, f, h) \
+	VPADDD h, Y12, Y12 \
+	VPADDD Y10, Y12, Y12 \
+	VPADDD Y11, Y12, Y12 \
+	ROL(9, b, b, Y13) \
+	ROL(19, f, f, Y13) \
+	ROL(9, Y12, Y13, Y14) \
+	ROL(17, Y12, h, Y15) \
+	VPXOR  Y13, h, h \
+	VPXOR  Y12, h, h
+
+// Rounds 0-15: FF and GG are both x ^ y ^ z.
+#define ROUND_00_15(j, a, b, c, d, e, f, g, h) \
+	SS(j, a, e) \
+	VPXOR a, b, Y9 \
+	VPXOR c, Y9, Y9 \
+	TT1(j, d) \
+	VPXOR e, f, Y12 \
+	VPXOR g, Y12, Y12 \
+	TT2(b, f, h)
+
+// Rounds 16-63: FF is majority, GG is choice.
+#define ROUND_16_63(j, a, b, c, d, e, f, g, h) \
+	SS(j, a, e) \
+	VPAND  a, b, Y9 \
+	VPOR   a, b, Y13 \
+	VPAND  c, Y13, Y13 \
+	VPOR   Y13, Y9, Y9 \
+	TT1(j, d) \
+	VPAND  e, f, Y12 \
+	VPANDN g, e, Y13 \
+	VPOR   Y13, Y12, Y12 \
+	TT2(b, f, h)
+
+// func block8AVX2(dig *[8][lanes]uint32, w *[68][lanes]uint32)
+TEXT ·block8AVX2(SB), NOSPLIT, $0-16
+	MOVQ dig+0(FP), AX
+	MOVQ w+8(FP), SI
+	LEAQ ·tRot(SB), DI
+
+	// message expansion, W[16] to W[67]
+	LEAQ (16*32)(SI), DX
+	MOVQ $52, CX
+
+expand:
+	VMOVDQU -512(DX), Y8
+	VPXOR   -288(DX), Y8, Y8
+	VMOVDQU -96(DX), Y12
+	ROL(15, Y12, Y12, Y11)
+	VPXOR   Y12, Y8, Y8
+	P1(Y8)
+	VMOVDQU -416(DX), Y12
+	ROL(7, Y12, Y12, Y11)
+	VPXOR   Y12, Y8, Y8
+	VPXOR   -192(DX), Y8, Y8
+	VMOVDQU Y8, (DX)
+	ADDQ    $32, DX
+	DECQ    CX
+	JNZ     expand
+
+	VMOVDQU (0*32)(AX), Y0
+	VMOVDQU (1*32)(AX), Y1
+	VMOVDQU (2*32)(AX), Y2
+	VMOVDQU (3*32)(AX), Y3
+	VMOVDQU (4*32)(AX), Y4
+	VMOVDQU (5*32)(AX), Y5
+	VMOVDQU (6*32)(AX), Y6
+	VMOVDQU (7*32)(AX), Y7
+
+	// Each round leaves TT1 in D's register and P0(TT2) in H's register, so
+	// the register roles rotate instead of being moved.
+	ROUND_00_15(0, Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7)
+	ROUND_00_15(1, Y3, Y0, Y1, Y2, Y7, Y4, Y5, Y6)
+	ROUND_00_15(2, Y2, Y3, Y0, Y1, Y6, Y7, Y4, Y5)
+	ROUND_00_15(3, Y1, Y2, Y3, Y0, Y5, Y6, Y7, Y4)
+	ROUND_00_15(4, Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7)
+	ROUND_00_15(5, Y3, Y0, Y1, Y2, Y7, Y4, Y5, Y6)
+	ROUND_00_15(6, Y2, Y3, Y0, Y1, Y6, Y7, Y4, Y5)
+	ROUND_00_15(7, Y1, Y2, Y3, Y0, Y5, Y6, Y7, Y4)
+	ROUND_00_15(8, Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7)
+	ROUND_00_15(9, Y3, Y0, Y1, Y2, Y7, Y4, Y5, Y6)
+	ROUND_00_15(10, Y2, Y3, Y0, Y1, Y6, Y7, Y4, Y5)
+	ROUND_00_15(11, Y1, Y2, Y3, Y0, Y5, Y6, Y7, Y4)
+	ROUND_00_15(12, Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7)
+	ROUND_00_15(13, Y3, Y0, Y1, Y2, Y7, Y4, Y5, Y6)
+	ROUND_00_15(14, Y2, Y3, Y0, Y1, Y6, Y7, Y4, Y5)
+	ROUND_00_15(15, Y1, Y2, Y3, Y0, Y5, Y6, Y7, Y4)
+	ROUND_16_63(16, Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7)
+	ROUND_16_63(17, Y3, Y0, Y1, Y2, Y7, Y4, Y5, Y6)
+	ROUND_16_63(18, Y2, Y3, Y0, Y1, Y6, Y7, Y4, Y5)
+	ROUND_16_63(19, Y1, Y2, Y3, Y0, Y5, Y6, Y7, Y4)
+	ROUND_16_63(20, Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7)
+	ROUND_16_63(21, Y3, Y0, Y1, Y2, Y7, Y4, Y5, Y6)
+	ROUND_16_63(22, Y2, Y3, Y0, Y1, Y6, Y7, Y4, Y5)
+	ROUND_16_63(23, Y1, Y2, Y3, Y0, Y5, Y6, Y7, Y4)
+	ROUND_16_63(24, Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7)
+	ROUND_16_63(25, Y3, Y0, Y1, Y2, Y7, Y4, Y5, Y6)
+	ROUND_16_63(26, Y2, Y3, Y0, Y1, Y6, Y7, Y4, Y5)
+	ROUND_16_63(27, Y1, Y2, Y3, Y0, Y5, Y6, Y7, Y4)
+	ROUND_16_63(28, Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7)
+	ROUND_16_63(29, Y3, Y0, Y1, Y2, Y7, Y4, Y5, Y6)
+	ROUND_16_63(30, Y2, Y3, Y0, Y1, Y6, Y7, Y4, Y5)
+	ROUND_16_63(31, Y1, Y2, Y3, Y0, Y5, Y6, Y7, Y4)
+	ROUND_16_63(32, Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7)
+	ROUND_16_63(33, Y3, Y0, Y1, Y2, Y7, Y4, Y5, Y6)
+	ROUND_16_63(34, Y2, Y3, Y0, Y1, Y6, Y7, Y4, Y5)
+	ROUND_16_63(35, Y1, Y2, Y3, Y0, Y5, Y6, Y7, Y4)
+	ROUND_16_63(36, Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7)
+	ROUND_16_63(37, Y3, Y0, Y1, Y2, Y7, Y4, Y5, Y6)
+	ROUND_16_63(38, Y2, Y3, Y0, Y1, Y6, Y7, Y4, Y5)
+	ROUND_16_63(39, Y1, Y2, Y3, Y0, Y5, Y6, Y7, Y4)
+	ROUND_16_63(40, Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7)
+	ROUND_16_63(41, Y3, Y0, Y1, Y2, Y7, Y4, Y5, Y6)
+	ROUND_16_63(42, Y2, Y3, Y0, Y1, Y6, Y7, Y4, Y5)
+	ROUND_16_63(43, Y1, Y2, Y3, Y0, Y5, Y6, Y7, Y4)
+	ROUND_16_63(44, Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7)
+	ROUND_16_63(45, Y3, Y0, Y1, Y2, Y7, Y4, Y5, Y6)
+	ROUND_16_63(46, Y2, Y3, Y0, Y1, Y6, Y7, Y4, Y5)
+	ROUND_16_63(47, Y1, Y2, Y3, Y0, Y5, Y6, Y7, Y4)
+	ROUND_16_63(48, Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7)
+	ROUND_16_63(49, Y3, Y0, Y1, Y2, Y7, Y4, Y5, Y6)
+	ROUND_16_63(50, Y2, Y3, Y0, Y1, Y6, Y7, Y4, Y5)
+	ROUND_16_63(51, Y1, Y2, Y3, Y0, Y5, Y6, Y7, Y4)
+	ROUND_16_63(52, Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7)
+	ROUND_16_63(53, Y3, Y0, Y1, Y2, Y7, Y4, Y5, Y6)
+	ROUND_16_63(54, Y2, Y3, Y0, Y1, Y6, Y7, Y4, Y5)
+	ROUND_16_63(55, Y1, Y2, Y3, Y0, Y5, Y6, Y7, Y4)
+	ROUND_16_63(56, Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7)
+	ROUND_16_63(57, Y3, Y0, Y1, Y2, Y7, Y4, Y5, Y6)
+	ROUND_16_63(58, Y2, Y3, Y0, Y1, Y6, Y7, Y4, Y5)
+	ROUND_16_63(59, Y1, Y2, Y3, Y0, Y5, Y6, Y7, Y4)
+	ROUND_16_63(60, Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7)
+	ROUND_16_63(61, Y3, Y0, Y1, Y2, Y7, Y4, Y5, Y6)
+	ROUND_16_63(62, Y2, Y3, Y0, Y1, Y6, Y7, Y4, Y5)
+	ROUND_16_63(63, Y1, Y2, Y3, Y0, Y5, Y6, Y7, Y4)
+
+	VPXOR   (0*32)(AX), Y0, Y0
+	VPXOR   (1*32)(AX), Y1, Y1
+	VPXOR   (2*32)(AX), Y2, Y2
+	VPXOR   (3*32)(AX), Y3, Y3
+	VPXOR   (4*32)(AX), Y4, Y4
+	VPXOR   (5*32)(AX), Y5, Y5
+	VPXOR   (6*32)(AX), Y6, Y6
+	VPXOR   (7*32)(AX), Y7, Y7
+	VMOVDQU Y0, (0*32)(AX)
+	VMOVDQU Y1, (1*32)(AX)
+	VMOVDQU Y2, (2*32)(AX)
+	VMOVDQU Y3, (3*32)(AX)
+	VMOVDQU Y4, (4*32)(AX)
+	VMOVDQU Y5, (5*32)(AX)
+	VMOVDQU Y6, (6*32)(AX)
+	VMOVDQU Y7, (7*32)(AX)
+
+	VZEROUPPER
+	RET
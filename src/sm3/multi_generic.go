@@ -0,0 +1,7 @@
+//go:build !amd64 || purego
+
+package sm3
+
+func block8(dig *[8][lanes]uint32, w *[68][lanes]uint32) {
+	block8Generic(dig, w)
+}
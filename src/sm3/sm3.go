@@ -167,11 +167,12 @@ func update(sm3 *SM3, p []byte, update bool) (int, []uint32) {
 	return i, []uint32{A, B, C, D, E, F, G, H}
 }
 
+// Sum appends the digest of the data written so far to b. It leaves the
+// state unchanged, so writing may continue afterwards.
 func (sm3 *SM3) Sum(b []byte) []byte {
 	data := padding(sm3, sm3.x)
 
-	nblocks, sum := update(sm3, data, false)
-	sm3.x = sm3.x[(nblocks-1)*BlockSize:]
+	_, sum := update(sm3, data, false)
 	dgst := make([]byte, 32)
 
 	for i := 0; i < len(sum); i++ {
@@ -182,10 +183,12 @@ func (sm3 *SM3) Sum(b []byte) []byte {
 	return b
 }
 
+// Write hashes the whole blocks of the buffered data and p, keeping the rest
+// buffered, so the digest does not depend on how the input is split.
 func (sm3 *SM3) Write(p []byte) (n int, err error) {
 	sm3.x = append(sm3.x, p...)
 	sm3.length += len(p)
-	nblocks, _ := update(sm3, p, true)
+	nblocks, _ := update(sm3, sm3.x, true)
 	sm3.x = sm3.x[nblocks*BlockSize:]
 	return len(p), nil
 }
@@ -0,0 +1,234 @@
+// Package sm3tree implements a parallel Merkle-tree hash built on SM3.
+//
+// The input is split into leaves of LeafSize bytes; the last leaf may be
+// shorter, and an empty input is a single empty leaf. Nodes are computed as
+//
+//	leaf  = SM3(0x00 || leaf data)
+//	inner = SM3(0x01 || left || right)
+//
+// Leaves are paired left to right, level by level. When a level has an odd
+// number of nodes the last node is promoted unchanged to the next level. The
+// digest is the single node left at the top, so an input of at most one leaf
+// hashes to SM3(0x00 || data).
+package sm3tree
+
+import (
+	"errors"
+	"hash"
+	"io"
+	"opensm/src/sm3"
+	"os"
+	"runtime"
+	"sync"
+)
+
+const LeafSize = 1 << 20
+const BlockSize = sm3.BlockSize
+const Size = sm3.Size
+
+const (
+	leafPrefix  = 0x00
+	innerPrefix = 0x01
+)
+
+type digest struct {
+	workers int
+	sem     chan struct{}
+	wg      sync.WaitGroup
+	buf     []byte
+	leaves  []*[Size]byte
+}
+
+func hashLeaf(out *[Size]byte, p []byte) {
+	h := sm3.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(p)
+	h.Sum(out[:0])
+}
+
+func hashInner(out *[Size]byte, left, right *[Size]byte) {
+	h := sm3.New()
+	h.Write([]byte{innerPrefix})
+	h.Write(left[:])
+	h.Write(right[:])
+	h.Sum(out[:0])
+}
+
+func root(leaves []*[Size]byte) []byte {
+	level := leaves
+	for len(level) > 1 {
+		next := make([]*[Size]byte, 0, (len(level)+1)/2)
+		for i := 0; i+1 < len(level); i += 2 {
+			node := new([Size]byte)
+			hashInner(node, level[i], level[i+1])
+			next = append(next, node)
+		}
+		if len(level)%2 == 1 {
+			next = append(next, level[len(level)-1])
+		}
+		level = next
+	}
+
+	return level[0][:]
+}
+
+// New returns a hash.Hash computing the tree digest, hashing full leaves on
+// up to workers goroutines. A workers value below 1 means runtime.NumCPU().
+func New(workers int) hash.Hash {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	d := &digest{
+		workers: workers,
+		sem:     make(chan struct{}, workers),
+	}
+	return d
+}
+
+func (d *digest) BlockSize() int {
+	return BlockSize
+}
+
+func (d *digest) Size() int {
+	return Size
+}
+
+func (d *digest) Reset() {
+	d.wg.Wait()
+	d.buf = nil
+	d.leaves = nil
+}
+
+func (d *digest) flush(p []byte) {
+	leaf := new([Size]byte)
+	d.leaves = append(d.leaves, leaf)
+
+	d.sem <- struct{}{}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		hashLeaf(leaf, p)
+		<-d.sem
+	}()
+}
+
+func (d *digest) Write(p []byte) (n int, err error) {
+	n = len(p)
+
+	if len(d.buf) > 0 {
+		k := copy(d.buf[len(d.buf):LeafSize], p)
+		d.buf = d.buf[:len(d.buf)+k]
+		p = p[k:]
+		if len(d.buf) < LeafSize {
+			return n, nil
+		}
+		d.flush(d.buf)
+		d.buf = nil
+	}
+
+	for len(p) >= LeafSize {
+		leaf := make([]byte, LeafSize)
+		copy(leaf, p)
+		d.flush(leaf)
+		p = p[LeafSize:]
+	}
+
+	if len(p) > 0 {
+		d.buf = make([]byte, len(p), LeafSize)
+		copy(d.buf, p)
+	}
+
+	return n, nil
+}
+
+func (d *digest) Sum(b []byte) []byte {
+	d.wg.Wait()
+
+	leaves := d.leaves
+	if len(d.buf) > 0 || len(leaves) == 0 {
+		last := new([Size]byte)
+		hashLeaf(last, d.buf)
+		leaves = append(leaves[:len(leaves):len(leaves)], last)
+	}
+
+	return append(b, root(leaves)...)
+}
+
+// SumReaderAt computes the tree digest of the first size bytes of r, reading
+// and hashing leaves concurrently on up to workers goroutines.
+func SumReaderAt(r io.ReaderAt, size int64, workers int) ([]byte, error) {
+	if size < 0 {
+		return nil, errors.New("opensm/sm3tree: negative size")
+	}
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	n := (size + LeafSize - 1) / LeafSize
+	if n == 0 {
+		n = 1
+	}
+
+	leaves := make([]*[Size]byte, n)
+	for i := range leaves {
+		leaves[i] = new([Size]byte)
+	}
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	next := make(chan int64)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, LeafSize)
+			for i := range next {
+				off := i * LeafSize
+				l := size - off
+				if l > LeafSize {
+					l = LeafSize
+				}
+				k, err := r.ReadAt(buf[:l], off)
+				if int64(k) == l {
+					err = nil
+				}
+				if err != nil {
+					once.Do(func() { firstErr = err })
+					continue
+				}
+				hashLeaf(leaves[i], buf[:l])
+			}
+		}()
+	}
+
+	for i := int64(0); i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	return root(leaves), nil
+}
+
+// SumFile computes the tree digest of the named file using all CPUs.
+func SumFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return SumReaderAt(f, fi.Size(), 0)
+}
@@ -0,0 +1,301 @@
+package sm4
+
+import "encoding/binary"
+
+// Bitsliced SM4 encrypts up to 64 blocks at once without any memory access
+// that depends on the data or the key. Bit b of word w of every block is
+// packed into one uint64, lane k belonging to block k, and the S-box is
+// evaluated as a boolean circuit on those planes.
+//
+// The S-box is S(x) = A·inv(A·x + C) + C, with inv the inversion in
+// GF(2^8) mod x^8+x^7+x^6+x^5+x^4+x^2+1, A the circulant matrix whose rows
+// are 0xA7 rotated and C = 0xD3. The inversion is done in the isomorphic
+// tower field GF(((2^2)^2)^2), where it reduces to a handful of GF(2^2)
+// multiplications; the change of basis is folded into the two affine maps.
+//
+// Tower field elements use these bit positions: GF(2^2) = GF(2)[w]/(w^2+w+1)
+// is (hi, lo) = bits (1, 0); GF(2^4) = GF(2^2)[z]/(z^2+z+w) is bits 3-2 for
+// the z coefficient and 1-0 for the constant; GF(2^8) = GF(2^4)[y]/(y^2+y+λ)
+// likewise is bits 7-4 and 3-0.
+//
+// The gates below were derived once from that decomposition (λ = 8, with the
+// SM4 generator α mapped to β = 0x87) and are checked against the table at
+// init, so a transcription error cannot go unnoticed.
+
+const (
+	bitsliceLanes = 64
+	bitsliceMin   = 8
+)
+
+func init() {
+	var in [4][8]uint64
+	for x := 0; x < 256; x++ {
+		for i := 0; i < 8; i++ {
+			in[x/64][i] |= uint64(x>>uint(i)&1) << uint(x%64)
+		}
+	}
+	for q := range in {
+		sboxBitsliced(&in[q])
+		for k := 0; k < 64; k++ {
+			var y uint8
+			for i := 0; i < 8; i++ {
+				y |= uint8(in[q][i]>>uint(k)&1) << uint(i)
+			}
+			if y != sbox[q*64+k] {
+				panic("opensm/sm4: internal error: bitsliced S-box mismatch")
+			}
+		}
+	}
+}
+
+// sboxBitsliced applies the S-box in place to the eight bit planes x, bit 0
+// first.
+func sboxBitsliced(x *[8]uint64) {
+	const ones = ^uint64(0)
+
+	t0 := x[1] ^ x[2]
+	t1 := t0 ^ x[5]
+	t2 := t1 ^ x[6]
+	t3 := t2 ^ ones
+	t4 := x[0] ^ x[2]
+	t5 := t4 ^ x[5]
+	t6 := t5 ^ x[6]
+	t7 := x[0] ^ x[1]
+	t8 := t7 ^ x[3]
+	t9 := t8 ^ x[4]
+	t10 := t9 ^ x[6]
+	t11 := t10 ^ x[7]
+	t12 := t11 ^ ones
+	t13 := t7 ^ x[5]
+	t14 := t13 ^ x[6]
+	t15 := t14 ^ x[7]
+	t16 := t15 ^ ones
+	t17 := t7 ^ x[2]
+	t18 := t17 ^ x[4]
+	t19 := t18 ^ x[6]
+	t20 := x[6] ^ ones
+	t21 := x[2] ^ x[7]
+	t22 := t21 ^ ones
+	t23 := t17 ^ x[3]
+	t24 := t23 ^ x[4]
+	t25 := t24 ^ x[5]
+	t26 := t25 ^ x[6]
+	t27 := t26 ^ ones
+	t28 := t16 ^ t12
+	t29 := t16 ^ t28
+	t30 := t6 ^ t3
+	t31 := t29 ^ t6
+	t32 := t16 ^ t30
+	t33 := t16 & t27
+	t34 := t12 & t22
+	t35 := t27 ^ t22
+	t36 := t28 & t35
+	t37 := t36 ^ t34
+	t38 := t33 ^ t34
+	t39 := t6 & t20
+	t40 := t3 & t19
+	t41 := t20 ^ t19
+	t42 := t30 & t41
+	t43 := t42 ^ t40
+	t44 := t39 ^ t40
+	t45 := t16 ^ t6
+	t46 := t12 ^ t3
+	t47 := t27 ^ t20
+	t48 := t22 ^ t19
+	t49 := t45 & t47
+	t50 := t46 & t48
+	t51 := t45 ^ t46
+	t52 := t47 ^ t48
+	t53 := t51 & t52
+	t54 := t53 ^ t50
+	t55 := t49 ^ t50
+	t56 := t54 ^ t43
+	t57 := t55 ^ t44
+	t58 := t37 ^ t38
+	t59 := t58 ^ t43
+	t60 := t37 ^ t44
+	t61 := t16 ^ t56
+	t62 := t28 ^ t57
+	t63 := t31 ^ t59
+	t64 := t32 ^ t60
+	t65 := t27 ^ t35
+	t66 := t65 ^ t20
+	t67 := t27 ^ t41
+	t68 := t66 ^ t27
+	t69 := t67 ^ t66
+	t70 := t69 ^ t35
+	t71 := t70 ^ t27
+	t72 := t61 ^ t71
+	t73 := t62 ^ t68
+	t74 := t63 ^ t35
+	t75 := t64 ^ t65
+	t76 := t74 ^ t75
+	t77 := t74 & t72
+	t78 := t75 & t73
+	t79 := t72 ^ t73
+	t80 := t76 & t79
+	t81 := t80 ^ t78
+	t82 := t77 ^ t78
+	t83 := t74 ^ t81
+	t84 := t76 ^ t82
+	t85 := t72 ^ t79
+	t86 := t83 ^ t85
+	t87 := t84 ^ t72
+	t88 := t86 ^ t87
+	t89 := t72 & t86
+	t90 := t73 & t88
+	t91 := t86 ^ t88
+	t92 := t79 & t91
+	t93 := t92 ^ t90
+	t94 := t89 ^ t90
+	t95 := t72 ^ t74
+	t96 := t73 ^ t75
+	t97 := t95 & t86
+	t98 := t96 & t88
+	t99 := t95 ^ t96
+	t100 := t99 & t91
+	t101 := t100 ^ t98
+	t102 := t97 ^ t98
+	t103 := t27 & t93
+	t104 := t22 & t94
+	t105 := t93 ^ t94
+	t106 := t35 & t105
+	t107 := t106 ^ t104
+	t108 := t103 ^ t104
+	t109 := t20 & t101
+	t110 := t19 & t102
+	t111 := t101 ^ t102
+	t112 := t41 & t111
+	t113 := t112 ^ t110
+	t114 := t109 ^ t110
+	t115 := t93 ^ t101
+	t116 := t94 ^ t102
+	t117 := t47 & t115
+	t118 := t48 & t116
+	t119 := t115 ^ t116
+	t120 := t52 & t119
+	t121 := t120 ^ t118
+	t122 := t117 ^ t118
+	t123 := t121 ^ t113
+	t124 := t122 ^ t114
+	t125 := t107 ^ t108
+	t126 := t125 ^ t113
+	t127 := t107 ^ t114
+	t128 := t27 ^ t16
+	t129 := t22 ^ t12
+	t130 := t20 ^ t6
+	t131 := t19 ^ t3
+	t132 := t128 & t93
+	t133 := t129 & t94
+	t134 := t128 ^ t129
+	t135 := t134 & t105
+	t136 := t135 ^ t133
+	t137 := t132 ^ t133
+	t138 := t130 & t101
+	t139 := t131 & t102
+	t140 := t130 ^ t131
+	t141 := t140 & t111
+	t142 := t141 ^ t139
+	t143 := t138 ^ t139
+	t144 := t128 ^ t130
+	t145 := t129 ^ t131
+	t146 := t144 & t115
+	t147 := t145 & t116
+	t148 := t144 ^ t145
+	t149 := t148 & t119
+	t150 := t149 ^ t147
+	t151 := t146 ^ t147
+	t152 := t150 ^ t142
+	t153 := t151 ^ t143
+	t154 := t136 ^ t137
+	t155 := t154 ^ t142
+	t156 := t136 ^ t143
+	x[0] = t156 ^ t153 ^ t127 ^ t126 ^ t124 ^ t123 ^ ones
+	x[1] = t156 ^ t126 ^ t124 ^ ones
+	x[2] = t155 ^ t153 ^ t124 ^ t123
+	x[3] = t156 ^ t127 ^ t126 ^ t124 ^ t123
+	x[4] = t155 ^ t152 ^ t127 ^ t126 ^ t124 ^ ones
+	x[5] = t155 ^ t152 ^ t127 ^ t124 ^ t123
+	x[6] = t156 ^ t155 ^ t127 ^ ones
+	x[7] = t156 ^ t155 ^ t153 ^ t152 ^ t127 ^ t126 ^ t124 ^ ones
+}
+
+// transpose64 transposes the 64x64 bit matrix m in place: bit j of row i
+// moves to bit i of row j.
+func transpose64(m *[64]uint64) {
+	masks := [...]uint64{
+		0x00000000FFFFFFFF, 0x0000FFFF0000FFFF, 0x00FF00FF00FF00FF,
+		0x0F0F0F0F0F0F0F0F, 0x3333333333333333, 0x5555555555555555,
+	}
+	for s, j := 0, 32; j > 0; s, j = s+1, j>>1 {
+		for i := 0; i < 64; i++ {
+			if i&j != 0 {
+				continue
+			}
+			t := (m[i]>>uint(j) ^ m[i+j]) & masks[s]
+			m[i] ^= t << uint(j)
+			m[i+j] ^= t
+		}
+	}
+}
+
+// cryptBitsliced runs the 32 rounds with round keys rk on n <= 64 blocks.
+func cryptBitsliced(rk *[32]uint32, dst, src []byte, n int) {
+	var x [4][32]uint64
+	var m [64]uint64
+
+	for w := 0; w < 4; w++ {
+		for k := 0; k < n; k++ {
+			m[k] = uint64(binary.BigEndian.Uint32(src[k*BlockSize+w*4:]))
+		}
+		clear(m[n:])
+		transpose64(&m)
+		copy(x[w][:], m[:32])
+	}
+
+	var t [32]uint64
+	for i := 0; i < 32; i++ {
+		x1, x2, x3 := &x[(i+1)%4], &x[(i+2)%4], &x[(i+3)%4]
+		r := rk[i]
+		for b := 0; b < 32; b++ {
+			t[b] = x1[b] ^ x2[b] ^ x3[b] ^ -uint64(r>>uint(b)&1)
+		}
+
+		for q := 0; q < 32; q += 8 {
+			sboxBitsliced((*[8]uint64)(t[q : q+8]))
+		}
+
+		x0 := &x[i%4]
+		for b := 0; b < 32; b++ {
+			x0[b] ^= t[b] ^ t[(b-2)&31] ^ t[(b-10)&31] ^ t[(b-18)&31] ^ t[(b-24)&31]
+		}
+	}
+
+	// the output is (X35, X34, X33, X32), held in x[3], x[2], x[1], x[0]
+	for w := 0; w < 4; w++ {
+		copy(m[:32], x[3-w][:])
+		clear(m[32:])
+		transpose64(&m)
+		for k := 0; k < n; k++ {
+			binary.BigEndian.PutUint32(dst[k*BlockSize+w*4:], uint32(m[k]))
+		}
+	}
+}
+
+// cryptBlocksGeneric runs the rounds with round keys rk on the whole blocks
+// of src, using the bitsliced implementation for runs of at least
+// bitsliceMin blocks.
+func cryptBlocksGeneric(rk *[32]uint32, dst, src []byte) {
+	for len(src) >= bitsliceMin*BlockSize {
+		n := len(src) / BlockSize
+		if n > bitsliceLanes {
+			n = bitsliceLanes
+		}
+		cryptBitsliced(rk, dst, src, n)
+		dst, src = dst[n*BlockSize:], src[n*BlockSize:]
+	}
+
+	for ; len(src) >= BlockSize; dst, src = dst[BlockSize:], src[BlockSize:] {
+		cryptBlock(rk, dst, src)
+	}
+}
@@ -0,0 +1,211 @@
+package sm4
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+const (
+	ccmStandardNonceSize = 12
+	ccmTagSize           = 16
+)
+
+// ccm is the Counter with CBC-MAC mode of NIST SP 800-38C and RFC 3610.
+type ccm struct {
+	b         cipher.Block
+	nonceSize int
+	tagSize   int
+}
+
+// NewCCM returns the CCM mode of b with a 12-byte nonce and a 16-byte tag,
+// as used by RFC 8998.
+func NewCCM(b cipher.Block) (cipher.AEAD, error) {
+	return NewCCMWithSize(b, ccmStandardNonceSize, ccmTagSize)
+}
+
+// NewCCMWithSize returns the CCM mode of the 16-byte block cipher b. The
+// nonce size must be 7 to 13 bytes and the tag size an even number from 4
+// to 16. A shorter nonce allows longer messages: at most 2^(8*(15-nonceSize))
+// - 1 bytes.
+func NewCCMWithSize(b cipher.Block, nonceSize, tagSize int) (cipher.AEAD, error) {
+	if b.BlockSize() != BlockSize {
+		return nil, errors.New("cipher: CCM requires a 128-bit block cipher")
+	}
+	if nonceSize < 7 || nonceSize > 13 {
+		return nil, errors.New("cipher: incorrect nonce size given to CCM")
+	}
+	if tagSize < 4 || tagSize > ccmTagSize || tagSize%2 != 0 {
+		return nil, errors.New("cipher: incorrect tag size given to CCM")
+	}
+
+	return &ccm{b: b, nonceSize: nonceSize, tagSize: tagSize}, nil
+}
+
+func (c *ccm) NonceSize() int {
+	return c.nonceSize
+}
+
+func (c *ccm) Overhead() int {
+	return c.tagSize
+}
+
+// maxLength is the longest message whose length fits the 15-nonceSize byte
+// length field.
+func (c *ccm) maxLength() uint64 {
+	l := 15 - c.nonceSize
+	if l >= 8 {
+		return math.MaxInt64
+	}
+	return 1<<(8*uint(l)) - 1
+}
+
+// counter returns A_i = flags || nonce || i.
+func (c *ccm) counter(nonce []byte, i uint64) [BlockSize]byte {
+	var a [BlockSize]byte
+	a[0] = byte(14 - c.nonceSize)
+	copy(a[1:], nonce)
+	for j := BlockSize - 1; j > c.nonceSize; j-- {
+		a[j] = byte(i)
+		i >>= 8
+	}
+	return a
+}
+
+// mac computes the CBC-MAC over B_0, the encoded additional data and the
+// plaintext into tag.
+func (c *ccm) mac(tag *[BlockSize]byte, nonce, plaintext, additionalData []byte) {
+	flags := byte(8 * ((c.tagSize - 2) / 2))
+	flags |= byte(14 - c.nonceSize)
+	if len(additionalData) > 0 {
+		flags |= 0x40
+	}
+
+	var b0 [BlockSize]byte
+	b0[0] = flags
+	copy(b0[1:], nonce)
+	n := uint64(len(plaintext))
+	for j := BlockSize - 1; j > c.nonceSize; j-- {
+		b0[j] = byte(n)
+		n >>= 8
+	}
+
+	clear(tag[:])
+	m := cbcMAC{b: c.b, x: tag}
+	m.write(b0[:])
+
+	if len(additionalData) > 0 {
+		var hdr [10]byte
+		var h []byte
+		switch n := uint64(len(additionalData)); {
+		case n < 0xff00:
+			binary.BigEndian.PutUint16(hdr[:], uint16(n))
+			h = hdr[:2]
+		case n <= math.MaxUint32:
+			hdr[0], hdr[1] = 0xff, 0xfe
+			binary.BigEndian.PutUint32(hdr[2:], uint32(n))
+			h = hdr[:6]
+		default:
+			hdr[0], hdr[1] = 0xff, 0xff
+			binary.BigEndian.PutUint64(hdr[2:], n)
+			h = hdr[:10]
+		}
+		m.write(h)
+		m.write(additionalData)
+		m.pad()
+	}
+
+	m.write(plaintext)
+	m.pad()
+}
+
+// cbcMAC absorbs data into x one block at a time, buffering partial blocks.
+type cbcMAC struct {
+	b cipher.Block
+	x *[BlockSize]byte
+	n int
+}
+
+func (m *cbcMAC) write(p []byte) {
+	for len(p) > 0 {
+		k := subtle.XORBytes(m.x[m.n:], m.x[m.n:], p)
+		m.n += k
+		p = p[k:]
+		if m.n == BlockSize {
+			m.b.Encrypt(m.x[:], m.x[:])
+			m.n = 0
+		}
+	}
+}
+
+// pad completes a partial block with zeros.
+func (m *cbcMAC) pad() {
+	if m.n > 0 {
+		m.b.Encrypt(m.x[:], m.x[:])
+		m.n = 0
+	}
+}
+
+func (c *ccm) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != c.nonceSize {
+		panic("crypto/cipher: incorrect nonce length given to CCM")
+	}
+	if uint64(len(plaintext)) > c.maxLength() {
+		panic("crypto/cipher: message too large for CCM")
+	}
+
+	ret, out := sliceForAppend(dst, len(plaintext)+c.tagSize)
+	if inexactOverlap(out, plaintext) {
+		panic("crypto/cipher: invalid buffer overlap")
+	}
+
+	var tag [BlockSize]byte
+	c.mac(&tag, nonce, plaintext, additionalData)
+
+	a0 := c.counter(nonce, 0)
+	c.b.Encrypt(a0[:], a0[:])
+	subtle.XORBytes(out[len(plaintext):], tag[:c.tagSize], a0[:])
+
+	a1 := c.counter(nonce, 1)
+	cipher.NewCTR(c.b, a1[:]).XORKeyStream(out, plaintext)
+
+	return ret
+}
+
+func (c *ccm) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != c.nonceSize {
+		panic("crypto/cipher: incorrect nonce length given to CCM")
+	}
+	if len(ciphertext) < c.tagSize {
+		return nil, errOpen
+	}
+	if uint64(len(ciphertext)-c.tagSize) > c.maxLength() {
+		return nil, errOpen
+	}
+
+	tag := ciphertext[len(ciphertext)-c.tagSize:]
+	ciphertext = ciphertext[:len(ciphertext)-c.tagSize]
+
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	if inexactOverlap(out, ciphertext) {
+		panic("crypto/cipher: invalid buffer overlap")
+	}
+
+	a1 := c.counter(nonce, 1)
+	cipher.NewCTR(c.b, a1[:]).XORKeyStream(out, ciphertext)
+
+	var expectedTag [BlockSize]byte
+	c.mac(&expectedTag, nonce, out, additionalData)
+	a0 := c.counter(nonce, 0)
+	c.b.Encrypt(a0[:], a0[:])
+	subtle.XORBytes(expectedTag[:], expectedTag[:], a0[:])
+
+	if subtle.ConstantTimeCompare(expectedTag[:c.tagSize], tag) != 1 {
+		clear(out)
+		return nil, errOpen
+	}
+
+	return ret, nil
+}
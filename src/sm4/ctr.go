@@ -0,0 +1,84 @@
+package sm4
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+)
+
+// ctr is the counter mode returned by cipher.NewCTR for SM4 blocks. It
+// generates up to bitsliceLanes blocks of keystream at a time so that the
+// bitsliced implementation is used.
+type ctr struct {
+	c       *sm4Cipher
+	counter [BlockSize]byte
+	in      [bitsliceLanes * BlockSize]byte
+	out     [bitsliceLanes * BlockSize]byte
+	avail   []byte
+	// workers above 1 splits long inputs across goroutines
+	workers int
+}
+
+// NewCTR implements the ctrAble interface consulted by cipher.NewCTR.
+func (c *sm4Cipher) NewCTR(iv []byte) cipher.Stream {
+	if len(iv) != BlockSize {
+		panic("cipher.NewCTR: IV length must equal block size")
+	}
+
+	s := &ctr{c: c}
+	copy(s.counter[:], iv)
+	return s
+}
+
+func incCounter(counter *[BlockSize]byte) {
+	for i := BlockSize - 1; i >= 0; i-- {
+		counter[i]++
+		if counter[i] != 0 {
+			return
+		}
+	}
+}
+
+// refill generates keystream for at least n more bytes.
+func (s *ctr) refill(n int) {
+	blocks := (n + BlockSize - 1) / BlockSize
+	if blocks < bitsliceMin {
+		blocks = bitsliceMin
+	} else if blocks > bitsliceLanes {
+		blocks = bitsliceLanes
+	}
+
+	for i := 0; i < blocks; i++ {
+		copy(s.in[i*BlockSize:], s.counter[:])
+		incCounter(&s.counter)
+	}
+	cryptBlocks(&s.c.rk, s.out[:blocks*BlockSize], s.in[:blocks*BlockSize])
+	s.avail = s.out[:blocks*BlockSize]
+}
+
+func (s *ctr) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("crypto/cipher: output smaller than input")
+	}
+	if inexactOverlap(dst[:len(src)], src) {
+		panic("crypto/cipher: invalid buffer overlap")
+	}
+
+	for len(src) > 0 {
+		if len(s.avail) == 0 && s.workers > 1 && len(src) >= parallelMin {
+			n := len(src) &^ (BlockSize - 1)
+			parallelCounterCrypt(&s.c.rk, dst[:n], src[:n], &s.counter, addCounter, s.workers)
+			dst, src = dst[n:], src[n:]
+			continue
+		}
+		if len(s.avail) == 0 {
+			s.refill(len(src))
+		}
+		n := len(s.avail)
+		if n > len(src) {
+			n = len(src)
+		}
+		subtle.XORBytes(dst, src[:n], s.avail)
+		s.avail = s.avail[n:]
+		dst, src = dst[n:], src[n:]
+	}
+}
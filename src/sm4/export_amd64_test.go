@@ -0,0 +1,27 @@
+//go:build amd64 && !purego
+
+package sm4
+
+import "crypto/cipher"
+
+// HasAESNI reports whether cryptBlocks can take the assembly path.
+var HasAESNI = useAESNI
+
+// SetAsm selects the cryptBlocks path and returns a function restoring the
+// previous one.
+func SetAsm(aesni, avx2 bool) (restore func()) {
+	oldAESNI, oldAVX2 := useAESNI, useAVX2
+	useAESNI, useAVX2 = aesni, avx2
+	return func() { useAESNI, useAVX2 = oldAESNI, oldAVX2 }
+}
+
+// CryptBlocks runs cryptBlocks with the encryption or decryption round keys
+// of b, which must come from NewCipher.
+func CryptBlocks(b cipher.Block, decrypt bool, dst, src []byte) {
+	c := b.(*sm4Cipher)
+	if decrypt {
+		cryptBlocks(&c.drk, dst, src)
+	} else {
+		cryptBlocks(&c.rk, dst, src)
+	}
+}
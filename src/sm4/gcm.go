@@ -0,0 +1,274 @@
+package sm4
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	gcmStandardNonceSize = 12
+	gcmTagSize           = 16
+	gcmMinimumTagSize    = 12
+)
+
+var errOpen = errors.New("cipher: message authentication failed")
+
+// gcm is the Galois/Counter Mode returned by cipher.NewGCM for SM4 blocks.
+// The hash key, the tag mask and the keystream all go through the bitsliced
+// SM4, or the vector code where available, and GHASH uses a constant-time
+// carry-less multiplication, so neither leaks through the cache.
+type gcm struct {
+	c         *sm4Cipher
+	nonceSize int
+	tagSize   int
+	h0, h1    uint64
+	// workers above 1 splits long inputs across goroutines
+	workers int
+}
+
+// NewGCM implements the gcmAble interface consulted by cipher.NewGCM,
+// cipher.NewGCMWithNonceSize and cipher.NewGCMWithTagSize.
+func (c *sm4Cipher) NewGCM(nonceSize, tagSize int) (cipher.AEAD, error) {
+	if tagSize < gcmMinimumTagSize || tagSize > gcmTagSize {
+		return nil, errors.New("cipher: incorrect tag size given to GCM")
+	}
+	if nonceSize <= 0 {
+		return nil, errors.New("cipher: the nonce can't have zero length")
+	}
+
+	var h [BlockSize]byte
+	encryptBlockCT(&c.rk, h[:], h[:])
+
+	return &gcm{
+		c:         c,
+		nonceSize: nonceSize,
+		tagSize:   tagSize,
+		h1:        binary.BigEndian.Uint64(h[:8]),
+		h0:        binary.BigEndian.Uint64(h[8:]),
+	}, nil
+}
+
+// encryptBlockCT encrypts one block through cryptBlocks, padded to
+// bitsliceMin blocks as in ctr.refill, so that it avoids the table-driven
+// cryptBlock.
+func encryptBlockCT(rk *[32]uint32, dst, src []byte) {
+	var buf [bitsliceMin * BlockSize]byte
+	copy(buf[:], src[:BlockSize])
+	cryptBlocks(rk, buf[:], buf[:])
+	copy(dst, buf[:BlockSize])
+}
+
+func (g *gcm) NonceSize() int {
+	return g.nonceSize
+}
+
+func (g *gcm) Overhead() int {
+	return g.tagSize
+}
+
+// bmul64 is a constant-time carry-less multiplication keeping the low 64
+// bits, using integer multiplications on operands with holes so that carries
+// cannot spill into the bits that are kept.
+func bmul64(x, y uint64) uint64 {
+	x0 := x & 0x1111111111111111
+	x1 := x & 0x2222222222222222
+	x2 := x & 0x4444444444444444
+	x3 := x & 0x8888888888888888
+	y0 := y & 0x1111111111111111
+	y1 := y & 0x2222222222222222
+	y2 := y & 0x4444444444444444
+	y3 := y & 0x8888888888888888
+	z0 := (x0 * y0) ^ (x1 * y3) ^ (x2 * y2) ^ (x3 * y1)
+	z1 := (x0 * y1) ^ (x1 * y0) ^ (x2 * y3) ^ (x3 * y2)
+	z2 := (x0 * y2) ^ (x1 * y1) ^ (x2 * y0) ^ (x3 * y3)
+	z3 := (x0 * y3) ^ (x1 * y2) ^ (x2 * y1) ^ (x3 * y0)
+	z0 &= 0x1111111111111111
+	z1 &= 0x2222222222222222
+	z2 &= 0x4444444444444444
+	z3 &= 0x8888888888888888
+	return z0 | z1 | z2 | z3
+}
+
+func rev64(x uint64) uint64 {
+	x = (x&0x5555555555555555)<<1 | (x>>1)&0x5555555555555555
+	x = (x&0x3333333333333333)<<2 | (x>>2)&0x3333333333333333
+	x = (x&0x0F0F0F0F0F0F0F0F)<<4 | (x>>4)&0x0F0F0F0F0F0F0F0F
+	x = (x&0x00FF00FF00FF00FF)<<8 | (x>>8)&0x00FF00FF00FF00FF
+	x = (x&0x0000FFFF0000FFFF)<<16 | (x>>16)&0x0000FFFF0000FFFF
+	return x<<32 | x>>32
+}
+
+// ghash absorbs data, zero padded to whole blocks, into the accumulator
+// (y1, y0) with key (h1, h0), high words first.
+func ghash(y1, y0 *uint64, h1, h0 uint64, data []byte) {
+	h0r, h1r := rev64(h0), rev64(h1)
+	h2, h2r := h0^h1, h0r^h1r
+
+	var block [BlockSize]byte
+	for len(data) > 0 {
+		n := copy(block[:], data)
+		clear(block[n:])
+		data = data[n:]
+
+		a1 := *y1 ^ binary.BigEndian.Uint64(block[:8])
+		a0 := *y0 ^ binary.BigEndian.Uint64(block[8:])
+		a0r, a1r := rev64(a0), rev64(a1)
+		a2, a2r := a0^a1, a0r^a1r
+
+		z0 := bmul64(a0, h0)
+		z1 := bmul64(a1, h1)
+		z2 := bmul64(a2, h2)
+		zh0 := bmul64(a0r, h0r)
+		zh1 := bmul64(a1r, h1r)
+		zh2 := bmul64(a2r, h2r)
+		z2 ^= z0 ^ z1
+		zh2 ^= zh0 ^ zh1
+		zh0 = rev64(zh0) >> 1
+		zh1 = rev64(zh1) >> 1
+		zh2 = rev64(zh2) >> 1
+
+		v0 := z0
+		v1 := zh0 ^ z2
+		v2 := z1 ^ zh2
+		v3 := zh1
+
+		v3 = v3<<1 | v2>>63
+		v2 = v2<<1 | v1>>63
+		v1 = v1<<1 | v0>>63
+		v0 = v0 << 1
+
+		v2 ^= v0 ^ v0>>1 ^ v0>>2 ^ v0>>7
+		v1 ^= v0<<63 ^ v0<<62 ^ v0<<57
+		v3 ^= v1 ^ v1>>1 ^ v1>>2 ^ v1>>7
+		v2 ^= v1<<63 ^ v1<<62 ^ v1<<57
+
+		*y1, *y0 = v3, v2
+	}
+}
+
+func (g *gcm) deriveCounter(counter *[BlockSize]byte, nonce []byte) {
+	if len(nonce) == gcmStandardNonceSize {
+		copy(counter[:], nonce)
+		counter[BlockSize-1] = 1
+		return
+	}
+
+	var y1, y0 uint64
+	var lens [BlockSize]byte
+	binary.BigEndian.PutUint64(lens[8:], uint64(len(nonce))*8)
+	ghash(&y1, &y0, g.h1, g.h0, nonce)
+	ghash(&y1, &y0, g.h1, g.h0, lens[:])
+	binary.BigEndian.PutUint64(counter[:8], y1)
+	binary.BigEndian.PutUint64(counter[8:], y0)
+}
+
+func gcmInc32(counter *[BlockSize]byte) {
+	ctr := counter[BlockSize-4:]
+	binary.BigEndian.PutUint32(ctr, binary.BigEndian.Uint32(ctr)+1)
+}
+
+// counterCrypt XORs in with the keystream starting at counter into out.
+func (g *gcm) counterCrypt(out, in []byte, counter *[BlockSize]byte) {
+	if g.workers > 1 && len(in) >= parallelMin {
+		parallelCounterCrypt(&g.c.rk, out, in, counter, gcmAdd32, g.workers)
+		return
+	}
+	counterCrypt(&g.c.rk, out, in, counter, gcmAdd32)
+}
+
+func (g *gcm) auth(out, ciphertext, additionalData []byte, tagMask *[BlockSize]byte) {
+	var y1, y0 uint64
+	var lens [BlockSize]byte
+	binary.BigEndian.PutUint64(lens[:8], uint64(len(additionalData))*8)
+	binary.BigEndian.PutUint64(lens[8:], uint64(len(ciphertext))*8)
+
+	ghash(&y1, &y0, g.h1, g.h0, additionalData)
+	if g.workers > 1 && len(ciphertext) >= parallelMin {
+		parallelGHASH(&y1, &y0, g.h1, g.h0, ciphertext, g.workers)
+	} else {
+		ghash(&y1, &y0, g.h1, g.h0, ciphertext)
+	}
+	ghash(&y1, &y0, g.h1, g.h0, lens[:])
+
+	var s [BlockSize]byte
+	binary.BigEndian.PutUint64(s[:8], y1)
+	binary.BigEndian.PutUint64(s[8:], y0)
+	subtle.XORBytes(out, s[:], tagMask[:])
+}
+
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
+
+func (g *gcm) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != g.nonceSize {
+		panic("crypto/cipher: incorrect nonce length given to GCM")
+	}
+	if uint64(len(plaintext)) > ((1<<32)-2)*BlockSize {
+		panic("crypto/cipher: message too large for GCM")
+	}
+
+	ret, out := sliceForAppend(dst, len(plaintext)+g.tagSize)
+	if inexactOverlap(out, plaintext) {
+		panic("crypto/cipher: invalid buffer overlap")
+	}
+
+	var counter, tagMask [BlockSize]byte
+	g.deriveCounter(&counter, nonce)
+	encryptBlockCT(&g.c.rk, tagMask[:], counter[:])
+	gcmInc32(&counter)
+
+	g.counterCrypt(out, plaintext, &counter)
+
+	var tag [gcmTagSize]byte
+	g.auth(tag[:], out[:len(plaintext)], additionalData, &tagMask)
+	copy(out[len(plaintext):], tag[:g.tagSize])
+
+	return ret
+}
+
+func (g *gcm) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != g.nonceSize {
+		panic("crypto/cipher: incorrect nonce length given to GCM")
+	}
+	if len(ciphertext) < g.tagSize {
+		return nil, errOpen
+	}
+	if uint64(len(ciphertext)) > ((1<<32)-2)*BlockSize+uint64(g.tagSize) {
+		return nil, errOpen
+	}
+
+	tag := ciphertext[len(ciphertext)-g.tagSize:]
+	ciphertext = ciphertext[:len(ciphertext)-g.tagSize]
+
+	var counter, tagMask [BlockSize]byte
+	g.deriveCounter(&counter, nonce)
+	encryptBlockCT(&g.c.rk, tagMask[:], counter[:])
+	gcmInc32(&counter)
+
+	var expectedTag [gcmTagSize]byte
+	g.auth(expectedTag[:], ciphertext, additionalData, &tagMask)
+
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	if inexactOverlap(out, ciphertext) {
+		panic("crypto/cipher: invalid buffer overlap")
+	}
+
+	if subtle.ConstantTimeCompare(expectedTag[:g.tagSize], tag) != 1 {
+		clear(out)
+		return nil, errOpen
+	}
+
+	g.counterCrypt(out, ciphertext, &counter)
+
+	return ret, nil
+}
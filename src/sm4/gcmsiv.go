@@ -0,0 +1,193 @@
+package sm4
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+)
+
+const (
+	gcmSIVNonceSize = 12
+	gcmSIVTagSize   = 16
+	// gcmSIVMaxLength bounds the plaintext and the additional data, 2^36
+	// bytes as in RFC 8452.
+	gcmSIVMaxLength = 1 << 36
+)
+
+// GCMSIV is the nonce-misuse-resistant AEAD of RFC 8452 with SM4 in place of
+// AES-128. Per-message keys are derived from the nonce, the tag is POLYVAL
+// of the additional data and the plaintext encrypted under them, and the tag
+// is the initial counter. Reusing a nonce only reveals whether two messages,
+// with their additional data, are equal.
+//
+// GCMSIV implements cipher.AEAD with a 12-byte nonce and a 16-byte tag.
+type GCMSIV struct {
+	c *sm4Cipher
+}
+
+// NewGCMSIV returns SM4-GCM-SIV for a 16-byte key.
+func NewGCMSIV(key []byte) (*GCMSIV, error) {
+	c, err := NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &GCMSIV{c: c.(*sm4Cipher)}, nil
+}
+
+func (g *GCMSIV) NonceSize() int {
+	return gcmSIVNonceSize
+}
+
+func (g *GCMSIV) Overhead() int {
+	return gcmSIVTagSize
+}
+
+// deriveKeys returns the message authentication key, as POLYVAL key words,
+// and the message encryption cipher for nonce.
+func (g *GCMSIV) deriveKeys(nonce []byte) (h1, h0 uint64, enc *sm4Cipher) {
+	// padded to bitsliceMin blocks so that the keys avoid the table-driven
+	// cryptBlock
+	var in, out [bitsliceMin * BlockSize]byte
+	for i := 0; i < 4; i++ {
+		binary.LittleEndian.PutUint32(in[i*BlockSize:], uint32(i))
+		copy(in[i*BlockSize+4:], nonce)
+	}
+	cryptBlocks(&g.c.rk, out[:], in[:])
+
+	var authKey, encKey [BlockSize]byte
+	copy(authKey[:8], out[:8])
+	copy(authKey[8:], out[BlockSize:BlockSize+8])
+	copy(encKey[:8], out[2*BlockSize:])
+	copy(encKey[8:], out[3*BlockSize:3*BlockSize+8])
+
+	h1, h0 = polyvalKey(&authKey)
+	b, _ := NewCipher(encKey[:])
+	clear(out[:])
+	clear(authKey[:])
+	clear(encKey[:])
+	return h1, h0, b.(*sm4Cipher)
+}
+
+// polyvalKey returns mulX_GHASH(ByteReverse(H)) as GHASH key words, so that
+// POLYVAL(H, X) = ByteReverse(GHASH(that key, ByteReverse(X))) as in RFC
+// 8452 appendix A.
+func polyvalKey(h *[BlockSize]byte) (h1, h0 uint64) {
+	h1 = binary.LittleEndian.Uint64(h[8:])
+	h0 = binary.LittleEndian.Uint64(h[:8])
+	lsb := h0 & 1
+	h0 = h0>>1 | h1<<63
+	h1 = h1>>1 ^ 0xE100000000000000&-lsb
+	return h1, h0
+}
+
+// polyval absorbs data, zero padded to whole blocks, through ghash with
+// each block byte-reversed.
+func polyval(y1, y0 *uint64, h1, h0 uint64, data []byte) {
+	var buf [bitsliceLanes * BlockSize]byte
+	for len(data) > 0 {
+		n := min(len(data), len(buf))
+		n = copy(buf[:], data[:n])
+		data = data[n:]
+		padded := (n + BlockSize - 1) &^ (BlockSize - 1)
+		clear(buf[n:padded])
+		for i := 0; i < padded; i += BlockSize {
+			b := buf[i : i+BlockSize]
+			lo := binary.LittleEndian.Uint64(b[:8])
+			hi := binary.LittleEndian.Uint64(b[8:])
+			binary.BigEndian.PutUint64(b[:8], hi)
+			binary.BigEndian.PutUint64(b[8:], lo)
+		}
+		ghash(y1, y0, h1, h0, buf[:padded])
+	}
+}
+
+// tag computes the tag over the additional data and the plaintext.
+func (g *GCMSIV) tag(tag *[BlockSize]byte, h1, h0 uint64, enc *sm4Cipher, nonce, plaintext, additionalData []byte) {
+	var lens [BlockSize]byte
+	binary.LittleEndian.PutUint64(lens[:8], uint64(len(additionalData))*8)
+	binary.LittleEndian.PutUint64(lens[8:], uint64(len(plaintext))*8)
+
+	var y1, y0 uint64
+	polyval(&y1, &y0, h1, h0, additionalData)
+	polyval(&y1, &y0, h1, h0, plaintext)
+	polyval(&y1, &y0, h1, h0, lens[:])
+
+	binary.LittleEndian.PutUint64(tag[:8], y0)
+	binary.LittleEndian.PutUint64(tag[8:], y1)
+	subtle.XORBytes(tag[:], tag[:], nonce)
+	tag[15] &= 0x7f
+	encryptBlockCT(&enc.rk, tag[:], tag[:])
+}
+
+// sivAdd32 adds n to the little-endian 32-bit counter in the first four
+// bytes of counter, wrapping around.
+func sivAdd32(counter *[BlockSize]byte, n uint64) {
+	ctr := counter[:4]
+	binary.LittleEndian.PutUint32(ctr, binary.LittleEndian.Uint32(ctr)+uint32(n))
+}
+
+// counterCrypt XORs in with the keystream whose initial counter is the tag
+// with its top bit set.
+func (g *GCMSIV) counterCrypt(out, in []byte, enc *sm4Cipher, tag *[BlockSize]byte) {
+	counter := *tag
+	counter[15] |= 0x80
+	counterCrypt(&enc.rk, out, in, &counter, sivAdd32)
+}
+
+func (g *GCMSIV) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != gcmSIVNonceSize {
+		panic("crypto/cipher: incorrect nonce length given to GCM-SIV")
+	}
+	if uint64(len(plaintext)) > gcmSIVMaxLength || uint64(len(additionalData)) > gcmSIVMaxLength {
+		panic("crypto/cipher: message too large for GCM-SIV")
+	}
+
+	ret, out := sliceForAppend(dst, len(plaintext)+gcmSIVTagSize)
+	if inexactOverlap(out, plaintext) {
+		panic("crypto/cipher: invalid buffer overlap")
+	}
+
+	h1, h0, enc := g.deriveKeys(nonce)
+	defer enc.Zeroize()
+
+	var tag [BlockSize]byte
+	g.tag(&tag, h1, h0, enc, nonce, plaintext, additionalData)
+	g.counterCrypt(out, plaintext, enc, &tag)
+	copy(out[len(plaintext):], tag[:])
+
+	return ret
+}
+
+func (g *GCMSIV) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != gcmSIVNonceSize {
+		panic("crypto/cipher: incorrect nonce length given to GCM-SIV")
+	}
+	if len(ciphertext) < gcmSIVTagSize {
+		return nil, errOpen
+	}
+	if uint64(len(ciphertext)) > gcmSIVMaxLength+gcmSIVTagSize || uint64(len(additionalData)) > gcmSIVMaxLength {
+		return nil, errOpen
+	}
+
+	var tag [BlockSize]byte
+	copy(tag[:], ciphertext[len(ciphertext)-gcmSIVTagSize:])
+	ciphertext = ciphertext[:len(ciphertext)-gcmSIVTagSize]
+
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	if inexactOverlap(out, ciphertext) {
+		panic("crypto/cipher: invalid buffer overlap")
+	}
+
+	h1, h0, enc := g.deriveKeys(nonce)
+	defer enc.Zeroize()
+
+	g.counterCrypt(out, ciphertext, enc, &tag)
+
+	var expectedTag [BlockSize]byte
+	g.tag(&expectedTag, h1, h0, enc, nonce, out, additionalData)
+	if subtle.ConstantTimeCompare(expectedTag[:], tag[:]) != 1 {
+		clear(out)
+		return nil, errOpen
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,178 @@
+package sm4
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"runtime"
+	"sync"
+)
+
+const (
+	// parallelChunk is the least work handed to one goroutine.
+	parallelChunk = 64 << 10
+	// parallelMin is the shortest input split across goroutines.
+	parallelMin = 2 * parallelChunk
+)
+
+var errForeignBlock = errors.New("opensm/sm4: parallel modes require a cipher from NewCipher")
+
+// NewParallelCTR returns the CTR mode of b, which must come from NewCipher,
+// splitting long inputs into counter ranges encrypted on up to workers
+// goroutines. A workers value below 1 means runtime.NumCPU(). The keystream
+// is the same as that of cipher.NewCTR.
+func NewParallelCTR(b cipher.Block, iv []byte, workers int) (cipher.Stream, error) {
+	c, ok := b.(*sm4Cipher)
+	if !ok {
+		return nil, errForeignBlock
+	}
+	if len(iv) != BlockSize {
+		return nil, errors.New("opensm/sm4: IV length must equal block size")
+	}
+	s := c.NewCTR(iv).(*ctr)
+	s.workers = parallelWorkers(workers)
+	return s, nil
+}
+
+// NewParallelGCM returns the GCM mode of b, which must come from NewCipher,
+// with the standard nonce and tag sizes. Long inputs are split across up to
+// workers goroutines for both the keystream and GHASH; a workers value below
+// 1 means runtime.NumCPU(). The output is the same as that of cipher.NewGCM.
+func NewParallelGCM(b cipher.Block, workers int) (cipher.AEAD, error) {
+	c, ok := b.(*sm4Cipher)
+	if !ok {
+		return nil, errForeignBlock
+	}
+	aead, err := c.NewGCM(gcmStandardNonceSize, gcmTagSize)
+	if err != nil {
+		return nil, err
+	}
+	aead.(*gcm).workers = parallelWorkers(workers)
+	return aead, nil
+}
+
+func parallelWorkers(workers int) int {
+	if workers < 1 {
+		return runtime.NumCPU()
+	}
+	return workers
+}
+
+// chunkSize splits n bytes into at most workers chunks, each a whole number
+// of bitsliced batches and at least parallelChunk.
+func chunkSize(n, workers int) int {
+	const batch = bitsliceLanes * BlockSize
+	chunk := (n + workers - 1) / workers
+	chunk = (chunk + batch - 1) / batch * batch
+	return max(chunk, parallelChunk)
+}
+
+// addCounter adds n to counter as a 128-bit big-endian integer.
+func addCounter(counter *[BlockSize]byte, n uint64) {
+	hi := binary.BigEndian.Uint64(counter[:8])
+	lo := binary.BigEndian.Uint64(counter[8:])
+	if lo+n < lo {
+		hi++
+	}
+	binary.BigEndian.PutUint64(counter[:8], hi)
+	binary.BigEndian.PutUint64(counter[8:], lo+n)
+}
+
+// gcmAdd32 adds n to the last 32 bits of counter, wrapping as gcmInc32.
+func gcmAdd32(counter *[BlockSize]byte, n uint64) {
+	ctr := counter[BlockSize-4:]
+	binary.BigEndian.PutUint32(ctr, binary.BigEndian.Uint32(ctr)+uint32(n))
+}
+
+// counterCrypt XORs in with the keystream starting at counter into out,
+// advancing counter with add. Short inputs are padded to bitsliceMin blocks
+// so that they too avoid the table-driven cryptBlock.
+func counterCrypt(rk *[32]uint32, out, in []byte, counter *[BlockSize]byte, add func(*[BlockSize]byte, uint64)) {
+	var ctrs, ks [bitsliceLanes * BlockSize]byte
+
+	for len(in) > 0 {
+		blocks := min((len(in)+BlockSize-1)/BlockSize, bitsliceLanes)
+		for i := 0; i < blocks; i++ {
+			copy(ctrs[i*BlockSize:], counter[:])
+			add(counter, 1)
+		}
+		padded := max(blocks, bitsliceMin)
+		cryptBlocks(rk, ks[:padded*BlockSize], ctrs[:padded*BlockSize])
+
+		n := subtle.XORBytes(out, in, ks[:blocks*BlockSize])
+		out, in = out[n:], in[n:]
+	}
+}
+
+// parallelCounterCrypt is counterCrypt with the input split into chunks
+// that start from their own counter values and run concurrently.
+func parallelCounterCrypt(rk *[32]uint32, out, in []byte, counter *[BlockSize]byte, add func(*[BlockSize]byte, uint64), workers int) {
+	chunk := chunkSize(len(in), workers)
+
+	var wg sync.WaitGroup
+	for off := 0; off < len(in); off += chunk {
+		end := min(off+chunk, len(in))
+		c := *counter
+		add(&c, uint64(off/BlockSize))
+		wg.Add(1)
+		go func(out, in []byte, c [BlockSize]byte) {
+			defer wg.Done()
+			counterCrypt(rk, out, in, &c, add)
+		}(out[off:end], in[off:end], c)
+	}
+	wg.Wait()
+
+	add(counter, uint64((len(in)+BlockSize-1)/BlockSize))
+}
+
+// gfMul returns x*h in the GHASH field.
+func gfMul(x1, x0, h1, h0 uint64) (uint64, uint64) {
+	var b [BlockSize]byte
+	binary.BigEndian.PutUint64(b[:8], x1)
+	binary.BigEndian.PutUint64(b[8:], x0)
+	var y1, y0 uint64
+	ghash(&y1, &y0, h1, h0, b[:])
+	return y1, y0
+}
+
+// gfPow returns h^n in the GHASH field.
+func gfPow(h1, h0 uint64, n int) (uint64, uint64) {
+	// one is the most significant bit in GHASH bit order
+	r1, r0 := uint64(1)<<63, uint64(0)
+	for ; n > 0; n >>= 1 {
+		if n&1 == 1 {
+			r1, r0 = gfMul(r1, r0, h1, h0)
+		}
+		h1, h0 = gfMul(h1, h0, h1, h0)
+	}
+	return r1, r0
+}
+
+// parallelGHASH absorbs data like ghash. Chunks are hashed from zero
+// concurrently, then folded in order: y = y*H^k ^ chunk for a chunk of k
+// blocks.
+func parallelGHASH(y1, y0 *uint64, h1, h0 uint64, data []byte, workers int) {
+	chunk := chunkSize(len(data), workers)
+	parts := make([][2]uint64, (len(data)+chunk-1)/chunk)
+
+	var wg sync.WaitGroup
+	for i := range parts {
+		wg.Add(1)
+		go func(p *[2]uint64, data []byte) {
+			defer wg.Done()
+			ghash(&p[0], &p[1], h1, h0, data)
+		}(&parts[i], data[i*chunk:min((i+1)*chunk, len(data))])
+	}
+	wg.Wait()
+
+	p1, p0 := gfPow(h1, h0, chunk/BlockSize)
+	for i, p := range parts {
+		if i == len(parts)-1 {
+			p1, p0 = gfPow(h1, h0, (len(data)-i*chunk+BlockSize-1)/BlockSize)
+		}
+		*y1, *y0 = gfMul(*y1, *y0, p1, p0)
+		*y1 ^= p[0]
+		*y0 ^= p[1]
+	}
+}
@@ -0,0 +1,183 @@
+package sm4
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+	"hash"
+	"opensm/src/mac"
+)
+
+// sivMaxAD is the most additional data components S2V accepts beside the
+// plaintext, keeping the vector within the 127 strings of RFC 5297.
+const sivMaxAD = 126
+
+// SIV is the Synthetic Initialization Vector mode of RFC 5297 over SM4: S2V
+// over SM4-CMAC derives the IV from the additional data, the nonce and the
+// plaintext, and the IV then drives SM4-CTR. Reusing a nonce only reveals
+// whether two messages, with their additional data, are equal.
+//
+// SIV implements cipher.AEAD and is safe for concurrent use. The ciphertext
+// is the 16-byte IV followed by the encrypted plaintext.
+type SIV struct {
+	k1        cipher.Block
+	ctr       *sm4Cipher
+	nonceSize int
+}
+
+// NewSIV returns SM4-SIV for a 32-byte key, the CMAC key followed by the CTR
+// key. Seal and Open take a nonce of nonceSize bytes, which may be zero for
+// fully deterministic encryption.
+func NewSIV(key []byte, nonceSize int) (*SIV, error) {
+	if len(key) != 2*KeySize {
+		return nil, KeySizeError(len(key))
+	}
+	if nonceSize < 0 {
+		return nil, errors.New("opensm/sm4: invalid SIV nonce size")
+	}
+
+	k1, _ := NewCipher(key[:KeySize])
+	k2, _ := NewCipher(key[KeySize:])
+	return &SIV{k1: k1, ctr: k2.(*sm4Cipher), nonceSize: nonceSize}, nil
+}
+
+func (s *SIV) NonceSize() int {
+	return s.nonceSize
+}
+
+func (s *SIV) Overhead() int {
+	return BlockSize
+}
+
+// s2v computes the synthetic IV over the additional data components and
+// the plaintext p.
+func (s *SIV) s2v(v *[BlockSize]byte, ad [][]byte, p []byte) {
+	if len(ad) > sivMaxAD {
+		panic("opensm/sm4: too many SIV additional data components")
+	}
+
+	// the CMAC state is local so that calls may run concurrently
+	h := mac.NewCMAC(s.k1)
+	var d [BlockSize]byte
+	cmac(h, &d, d[:])
+	for _, a := range ad {
+		var m [BlockSize]byte
+		cmac(h, &m, a)
+		sivDouble(&d)
+		subtle.XORBytes(d[:], d[:], m[:])
+	}
+
+	h.Reset()
+	if len(p) >= BlockSize {
+		// xorend: D is XORed into the last block of p
+		n := len(p) - BlockSize
+		h.Write(p[:n])
+		subtle.XORBytes(d[:], d[:], p[n:])
+	} else {
+		sivDouble(&d)
+		subtle.XORBytes(d[:], d[:], p)
+		d[len(p)] ^= 0x80
+	}
+	h.Write(d[:])
+	h.Sum(v[:0])
+}
+
+func cmac(h hash.Hash, out *[BlockSize]byte, p []byte) {
+	h.Reset()
+	h.Write(p)
+	h.Sum(out[:0])
+}
+
+// sivDouble multiplies v by x as in CMAC subkey generation.
+func sivDouble(v *[BlockSize]byte) {
+	msb := v[0] >> 7
+	for i := 0; i < BlockSize-1; i++ {
+		v[i] = v[i]<<1 | v[i+1]>>7
+	}
+	v[BlockSize-1] = v[BlockSize-1]<<1 ^ 0x87&-msb
+}
+
+// crypt runs CTR from the IV v with bits 63 and 31 cleared, so that
+// implementations may use a 64-bit counter.
+func (s *SIV) crypt(out, in []byte, v *[BlockSize]byte) {
+	q := *v
+	q[8] &= 0x7f
+	q[12] &= 0x7f
+	s.ctr.NewCTR(q[:]).XORKeyStream(out, in)
+}
+
+func (s *SIV) seal(dst, plaintext []byte, ad [][]byte) []byte {
+	ret, out := sliceForAppend(dst, BlockSize+len(plaintext))
+	if inexactOverlap(out, plaintext) {
+		panic("crypto/cipher: invalid buffer overlap")
+	}
+
+	// the output is shifted by the IV, so plaintext is moved into place
+	// first to allow sealing over plaintext[:0]
+	var v [BlockSize]byte
+	s.s2v(&v, ad, plaintext)
+	copy(out[BlockSize:], plaintext)
+	s.crypt(out[BlockSize:], out[BlockSize:], &v)
+	copy(out, v[:])
+	return ret
+}
+
+func (s *SIV) open(dst, ciphertext []byte, ad [][]byte) ([]byte, error) {
+	if len(ciphertext) < BlockSize {
+		return nil, errOpen
+	}
+
+	ret, out := sliceForAppend(dst, len(ciphertext)-BlockSize)
+	if inexactOverlap(out, ciphertext) {
+		panic("crypto/cipher: invalid buffer overlap")
+	}
+
+	var v [BlockSize]byte
+	copy(v[:], ciphertext)
+	copy(out, ciphertext[BlockSize:])
+	s.crypt(out, out, &v)
+
+	var expected [BlockSize]byte
+	s.s2v(&expected, ad, out)
+	if subtle.ConstantTimeCompare(expected[:], v[:]) != 1 {
+		clear(out)
+		return nil, errOpen
+	}
+	return ret, nil
+}
+
+// components returns the S2V vector of RFC 5297 section 3: the additional
+// data, then the nonce if the mode has one.
+func (s *SIV) components(nonce, additionalData []byte) [][]byte {
+	if len(nonce) != s.nonceSize {
+		panic("crypto/cipher: incorrect nonce length given to SIV")
+	}
+	if s.nonceSize == 0 {
+		return [][]byte{additionalData}
+	}
+	return [][]byte{additionalData, nonce}
+}
+
+func (s *SIV) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	return s.seal(dst, plaintext, s.components(nonce, additionalData))
+}
+
+func (s *SIV) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	return s.open(dst, ciphertext, s.components(nonce, additionalData))
+}
+
+// SealDeterministic encrypts plaintext without a nonce, authenticating up
+// to 126 separate additional data strings. Equal plaintexts under equal
+// additional data give equal ciphertexts, so the result can be stored in an
+// indexed database column and looked up by sealing the search value. Pass
+// the table and column names as additional data so that values cannot be
+// moved between columns.
+func (s *SIV) SealDeterministic(dst, plaintext []byte, additionalData ...[]byte) []byte {
+	return s.seal(dst, plaintext, additionalData)
+}
+
+// OpenDeterministic reverses SealDeterministic given the same additional
+// data.
+func (s *SIV) OpenDeterministic(dst, ciphertext []byte, additionalData ...[]byte) ([]byte, error) {
+	return s.open(dst, ciphertext, additionalData)
+}
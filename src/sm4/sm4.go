@@ -4,15 +4,41 @@ import (
 	"crypto/cipher"
 	"encoding/binary"
 	"opensm/src/util"
+	"strconv"
 )
 
+// sm4Cipher holds the encryption round keys and, for decryption, the same
+// keys in reverse order.
 type sm4Cipher struct {
-	key []byte
-	iv  []byte
-	rk  []uint32
+	rk  [32]uint32
+	drk [32]uint32
 }
 
-const BlockSize = 16
+// KeySizeError is returned by NewCipher for keys that are not 16 bytes.
+type KeySizeError int
+
+func (k KeySizeError) Error() string {
+	return "opensm/sm4: invalid key size " + strconv.Itoa(int(k))
+}
+
+const (
+	BlockSize = 16
+	KeySize   = 16
+)
+
+// Blocks is implemented by the cipher.Block returned by NewCipher and
+// processes many blocks at once, in constant time where the platform allows.
+type Blocks interface {
+	cipher.Block
+	EncryptBlocks(dst, src []byte)
+	DecryptBlocks(dst, src []byte)
+}
+
+// Zeroizer is implemented by the cipher.Block returned by NewCipher and by
+// XTS, whose Zeroize wipes the key schedule.
+type Zeroizer interface {
+	Zeroize()
+}
 
 var CK = [32]uint32{
 	0x00070E15, 0x1C232A31, 0x383F464D, 0x545B6269,
@@ -29,46 +55,54 @@ var FK = [4]uint32{
 	0xA3B1BAC6, 0x56AA3350, 0x677D9197, 0xB27022DC,
 }
 
-func Sbox(x uint8) uint8 {
-	box := [16][16]byte{
-		{0xd6, 0x90, 0xe9, 0xfe, 0xcc, 0xe1, 0x3d, 0xb7, 0x16, 0xb6, 0x14, 0xc2, 0x28, 0xfb, 0x2c, 0x05},
-		{0x2b, 0x67, 0x9a, 0x76, 0x2a, 0xbe, 0x04, 0xc3, 0xaa, 0x44, 0x13, 0x26, 0x49, 0x86, 0x06, 0x99},
-		{0x9c, 0x42, 0x50, 0xf4, 0x91, 0xef, 0x98, 0x7a, 0x33, 0x54, 0x0b, 0x43, 0xed, 0xcf, 0xac, 0x62},
-		{0xe4, 0xb3, 0x1c, 0xa9, 0xc9, 0x08, 0xe8, 0x95, 0x80, 0xdf, 0x94, 0xfa, 0x75, 0x8f, 0x3f, 0xa6},
-		{0x47, 0x07, 0xa7, 0xfc, 0xf3, 0x73, 0x17, 0xba, 0x83, 0x59, 0x3c, 0x19, 0xe6, 0x85, 0x4f, 0xa8},
-		{0x68, 0x6b, 0x81, 0xb2, 0x71, 0x64, 0xda, 0x8b, 0xf8, 0xeb, 0x0f, 0x4b, 0x70, 0x56, 0x9d, 0x35},
-		{0x1e, 0x24, 0x0e, 0x5e, 0x63, 0x58, 0xd1, 0xa2, 0x25, 0x22, 0x7c, 0x3b, 0x01, 0x21, 0x78, 0x87},
-		{0xd4, 0x00, 0x46, 0x57, 0x9f, 0xd3, 0x27, 0x52, 0x4c, 0x36, 0x02, 0xe7, 0xa0, 0xc4, 0xc8, 0x9e},
-		{0xea, 0xbf, 0x8a, 0xd2, 0x40, 0xc7, 0x38, 0xb5, 0xa3, 0xf7, 0xf2, 0xce, 0xf9, 0x61, 0x15, 0xa1},
-		{0xe0, 0xae, 0x5d, 0xa4, 0x9b, 0x34, 0x1a, 0x55, 0xad, 0x93, 0x32, 0x30, 0xf5, 0x8c, 0xb1, 0xe3},
-		{0x1d, 0xf6, 0xe2, 0x2e, 0x82, 0x66, 0xca, 0x60, 0xc0, 0x29, 0x23, 0xab, 0x0d, 0x53, 0x4e, 0x6f},
-		{0xd5, 0xdb, 0x37, 0x45, 0xde, 0xfd, 0x8e, 0x2f, 0x03, 0xff, 0x6a, 0x72, 0x6d, 0x6c, 0x5b, 0x51},
-		{0x8d, 0x1b, 0xaf, 0x92, 0xbb, 0xdd, 0xbc, 0x7f, 0x11, 0xd9, 0x5c, 0x41, 0x1f, 0x10, 0x5a, 0xd8},
-		{0x0a, 0xc1, 0x31, 0x88, 0xa5, 0xcd, 0x7b, 0xbd, 0x2d, 0x74, 0xd0, 0x12, 0xb8, 0xe5, 0xb4, 0xb0},
-		{0x89, 0x69, 0x97, 0x4a, 0x0c, 0x96, 0x77, 0x7e, 0x65, 0xb9, 0xf1, 0x09, 0xc5, 0x6e, 0xc6, 0x84},
-		{0x18, 0xf0, 0x7d, 0xec, 0x3a, 0xdc, 0x4d, 0x20, 0x79, 0xee, 0x5f, 0x3e, 0xd7, 0xcb, 0x39, 0x48},
+var sbox = [256]byte{
+	0xd6, 0x90, 0xe9, 0xfe, 0xcc, 0xe1, 0x3d, 0xb7, 0x16, 0xb6, 0x14, 0xc2, 0x28, 0xfb, 0x2c, 0x05,
+	0x2b, 0x67, 0x9a, 0x76, 0x2a, 0xbe, 0x04, 0xc3, 0xaa, 0x44, 0x13, 0x26, 0x49, 0x86, 0x06, 0x99,
+	0x9c, 0x42, 0x50, 0xf4, 0x91, 0xef, 0x98, 0x7a, 0x33, 0x54, 0x0b, 0x43, 0xed, 0xcf, 0xac, 0x62,
+	0xe4, 0xb3, 0x1c, 0xa9, 0xc9, 0x08, 0xe8, 0x95, 0x80, 0xdf, 0x94, 0xfa, 0x75, 0x8f, 0x3f, 0xa6,
+	0x47, 0x07, 0xa7, 0xfc, 0xf3, 0x73, 0x17, 0xba, 0x83, 0x59, 0x3c, 0x19, 0xe6, 0x85, 0x4f, 0xa8,
+	0x68, 0x6b, 0x81, 0xb2, 0x71, 0x64, 0xda, 0x8b, 0xf8, 0xeb, 0x0f, 0x4b, 0x70, 0x56, 0x9d, 0x35,
+	0x1e, 0x24, 0x0e, 0x5e, 0x63, 0x58, 0xd1, 0xa2, 0x25, 0x22, 0x7c, 0x3b, 0x01, 0x21, 0x78, 0x87,
+	0xd4, 0x00, 0x46, 0x57, 0x9f, 0xd3, 0x27, 0x52, 0x4c, 0x36, 0x02, 0xe7, 0xa0, 0xc4, 0xc8, 0x9e,
+	0xea, 0xbf, 0x8a, 0xd2, 0x40, 0xc7, 0x38, 0xb5, 0xa3, 0xf7, 0xf2, 0xce, 0xf9, 0x61, 0x15, 0xa1,
+	0xe0, 0xae, 0x5d, 0xa4, 0x9b, 0x34, 0x1a, 0x55, 0xad, 0x93, 0x32, 0x30, 0xf5, 0x8c, 0xb1, 0xe3,
+	0x1d, 0xf6, 0xe2, 0x2e, 0x82, 0x66, 0xca, 0x60, 0xc0, 0x29, 0x23, 0xab, 0x0d, 0x53, 0x4e, 0x6f,
+	0xd5, 0xdb, 0x37, 0x45, 0xde, 0xfd, 0x8e, 0x2f, 0x03, 0xff, 0x6a, 0x72, 0x6d, 0x6c, 0x5b, 0x51,
+	0x8d, 0x1b, 0xaf, 0x92, 0xbb, 0xdd, 0xbc, 0x7f, 0x11, 0xd9, 0x5c, 0x41, 0x1f, 0x10, 0x5a, 0xd8,
+	0x0a, 0xc1, 0x31, 0x88, 0xa5, 0xcd, 0x7b, 0xbd, 0x2d, 0x74, 0xd0, 0x12, 0xb8, 0xe5, 0xb4, 0xb0,
+	0x89, 0x69, 0x97, 0x4a, 0x0c, 0x96, 0x77, 0x7e, 0x65, 0xb9, 0xf1, 0x09, 0xc5, 0x6e, 0xc6, 0x84,
+	0x18, 0xf0, 0x7d, 0xec, 0x3a, 0xdc, 0x4d, 0x20, 0x79, 0xee, 0x5f, 0x3e, 0xd7, 0xcb, 0x39, 0x48,
+}
+
+// te0..te3 combine the S-box with the linear transform L: T(a) is the XOR of
+// te0..te3 indexed by the bytes of a, most significant first.
+var te0, te1, te2, te3 [256]uint32
+
+func init() {
+	for i := 0; i < 256; i++ {
+		b := uint32(sbox[i]) << 24
+		t := b ^ util.RotateLeft(b, 2) ^ util.RotateLeft(b, 10) ^ util.RotateLeft(b, 18) ^ util.RotateLeft(b, 24)
+		te0[i] = t
+		te1[i] = util.RotateLeft(t, 24)
+		te2[i] = util.RotateLeft(t, 16)
+		te3[i] = util.RotateLeft(t, 8)
 	}
+}
 
-	return box[(x>>4)&0x0F][x&0x0F]
+func Sbox(x uint8) uint8 {
+	return sbox[x]
 }
 
-func T(a uint32) uint32 {
-	a0 := uint8((a >> 24) & 0xFF)
-	a1 := uint8((a >> 16) & 0xFF)
-	a2 := uint8((a >> 8) & 0xFF)
-	a3 := uint8(a & 0xFF)
+func tau(a uint32) uint32 {
+	return uint32(sbox[a>>24])<<24 | uint32(sbox[a>>16&0xFF])<<16 | uint32(sbox[a>>8&0xFF])<<8 | uint32(sbox[a&0xFF])
+}
 
-	B := binary.BigEndian.Uint32([]uint8{Sbox(a0), Sbox(a1), Sbox(a2), Sbox(a3)})
-	return B ^ util.RotateLeft(B, 2) ^ util.RotateLeft(B, 10) ^ util.RotateLeft(B, 18) ^ util.RotateLeft(B, 24)
+func T(a uint32) uint32 {
+	return te0[a>>24] ^ te1[a>>16&0xFF] ^ te2[a>>8&0xFF] ^ te3[a&0xFF]
 }
 
 func TPrime(a uint32) uint32 {
-	a0 := uint8((a >> 24) & 0xFF)
-	a1 := uint8((a >> 16) & 0xFF)
-	a2 := uint8((a >> 8) & 0xFF)
-	a3 := uint8(a & 0xFF)
-
-	B := binary.BigEndian.Uint32([]uint8{Sbox(a0), Sbox(a1), Sbox(a2), Sbox(a3)})
+	B := tau(a)
 	return B ^ util.RotateLeft(B, 13) ^ util.RotateLeft(B, 23)
 }
 
@@ -77,49 +111,59 @@ func F(x0, x1, x2, x3, rk uint32) uint32 {
 }
 
 func MK(mk0, mk1, mk2, mk3 uint32) []uint32 {
-	k := make([]uint32, 36)
-	rk := make([]uint32, 32)
-
-	k[0], k[1], k[2], k[3] = mk0^FK[0], mk1^FK[1], mk2^FK[2], mk3^FK[3]
+	rk := expandKey(mk0, mk1, mk2, mk3)
+	return rk[:]
+}
 
-	for i := 0; i < 32; i++ {
-		k[i+4] = k[i] ^ TPrime(k[i+1]^k[i+2]^k[i+3]^CK[i])
-		rk[i] = k[i+4]
+// expandKey returns the round keys for the key words mk0 to mk3.
+func expandKey(mk0, mk1, mk2, mk3 uint32) [32]uint32 {
+	var rk [32]uint32
+
+	k0, k1, k2, k3 := mk0^FK[0], mk1^FK[1], mk2^FK[2], mk3^FK[3]
+	for i := 0; i < 32; i += 4 {
+		k0 ^= TPrime(k1 ^ k2 ^ k3 ^ CK[i])
+		k1 ^= TPrime(k2 ^ k3 ^ k0 ^ CK[i+1])
+		k2 ^= TPrime(k3 ^ k0 ^ k1 ^ CK[i+2])
+		k3 ^= TPrime(k0 ^ k1 ^ k2 ^ CK[i+3])
+		rk[i], rk[i+1], rk[i+2], rk[i+3] = k0, k1, k2, k3
 	}
 
 	return rk
 }
 
-func encryptBlock(x0, x1, x2, x3 uint32, rk []uint32) (uint32, uint32, uint32, uint32) {
-	X := make([]uint32, 36)
-
-	X[0], X[1], X[2], X[3] = x0, x1, x2, x3
-	for i := 0; i < 32; i++ {
-		X[i+4] = F(X[i], X[i+1], X[i+2], X[i+3], rk[i])
+func encryptBlock(x0, x1, x2, x3 uint32, rk *[32]uint32) (uint32, uint32, uint32, uint32) {
+	for i := 0; i < 32; i += 4 {
+		x0 ^= T(x1 ^ x2 ^ x3 ^ rk[i])
+		x1 ^= T(x2 ^ x3 ^ x0 ^ rk[i+1])
+		x2 ^= T(x3 ^ x0 ^ x1 ^ rk[i+2])
+		x3 ^= T(x0 ^ x1 ^ x2 ^ rk[i+3])
 	}
 
-	return X[35], X[34], X[33], X[32]
+	return x3, x2, x1, x0
 }
 
-func decryptBlock(x0, x1, x2, x3 uint32, rk []uint32) (uint32, uint32, uint32, uint32) {
-	X := make([]uint32, 36)
+// NewCipher returns an SM4 cipher.Block for a 16-byte key. The key is not
+// retained; only the round keys derived from it are, and they can be wiped
+// through the Zeroizer interface the block implements.
+func NewCipher(key []byte) (cipher.Block, error) {
+	if len(key) != KeySize {
+		return nil, KeySizeError(len(key))
+	}
 
-	X[0], X[1], X[2], X[3] = x0, x1, x2, x3
-	for i := 0; i < 32; i++ {
-		X[i+4] = F(X[i], X[i+1], X[i+2], X[i+3], rk[32-(i+1)])
+	c := new(sm4Cipher)
+	c.rk = expandKey(binary.BigEndian.Uint32(key[0:4]), binary.BigEndian.Uint32(key[4:8]),
+		binary.BigEndian.Uint32(key[8:12]), binary.BigEndian.Uint32(key[12:16]))
+	for i := range c.drk {
+		c.drk[i] = c.rk[31-i]
 	}
 
-	return X[35], X[34], X[33], X[32]
+	return c, nil
 }
 
-func NewCipher(key []byte) (cipher.Block, error) {
-	c := sm4Cipher{
-		key: key,
-		rk: MK(binary.BigEndian.Uint32(key[0:4]), binary.BigEndian.Uint32(key[4:8]),
-			binary.BigEndian.Uint32(key[8:12]), binary.BigEndian.Uint32(key[12:16])),
-	}
-
-	return &c, nil
+// Zeroize wipes the round keys. The cipher must not be used afterwards.
+func (c *sm4Cipher) Zeroize() {
+	clear(c.rk[:])
+	clear(c.drk[:])
 }
 
 func (c *sm4Cipher) BlockSize() int {
@@ -127,33 +171,58 @@ func (c *sm4Cipher) BlockSize() int {
 }
 
 func (c *sm4Cipher) Encrypt(dst, src []byte) {
-	for i := 0; i*BlockSize < len(src); i++ {
-		x0 := binary.BigEndian.Uint32(src[i*4 : i*4+4])
-		x1 := binary.BigEndian.Uint32(src[i*4+4 : i*4+8])
-		x2 := binary.BigEndian.Uint32(src[i*4+8 : i*4+12])
-		x3 := binary.BigEndian.Uint32(src[i*4+12 : i*4+16])
-
-		c0, c1, c2, c3 := encryptBlock(x0, x1, x2, x3, c.rk)
-
-		binary.BigEndian.PutUint32(dst[i*4:i*4+4], c0)
-		binary.BigEndian.PutUint32(dst[i*4+4:i*4+8], c1)
-		binary.BigEndian.PutUint32(dst[i*4+8:i*4+12], c2)
-		binary.BigEndian.PutUint32(dst[i*4+12:i*4+16], c3)
-	}
+	checkBlocks(dst, src, BlockSize)
+	cryptBlock(&c.rk, dst, src)
 }
 
 func (c *sm4Cipher) Decrypt(dst, src []byte) {
-	for i := 0; i*BlockSize < len(src); i++ {
-		x0 := binary.BigEndian.Uint32(src[i*4 : i*4+4])
-		x1 := binary.BigEndian.Uint32(src[i*4+4 : i*4+8])
-		x2 := binary.BigEndian.Uint32(src[i*4+8 : i*4+12])
-		x3 := binary.BigEndian.Uint32(src[i*4+12 : i*4+16])
-
-		c0, c1, c2, c3 := decryptBlock(x0, x1, x2, x3, c.rk)
-
-		binary.BigEndian.PutUint32(dst[i*4:i*4+4], c0)
-		binary.BigEndian.PutUint32(dst[i*4+4:i*4+8], c1)
-		binary.BigEndian.PutUint32(dst[i*4+8:i*4+12], c2)
-		binary.BigEndian.PutUint32(dst[i*4+12:i*4+16], c3)
+	checkBlocks(dst, src, BlockSize)
+	cryptBlock(&c.drk, dst, src)
+}
+
+// EncryptBlocks encrypts len(src)/BlockSize whole blocks; dst and src may
+// be the same slice but must not otherwise overlap.
+func (c *sm4Cipher) EncryptBlocks(dst, src []byte) {
+	if len(src)%BlockSize != 0 {
+		panic("opensm/sm4: input not full blocks")
+	}
+	checkBlocks(dst, src, len(src))
+	cryptBlocks(&c.rk, dst, src)
+}
+
+// DecryptBlocks decrypts len(src)/BlockSize whole blocks; dst and src may
+// be the same slice but must not otherwise overlap.
+func (c *sm4Cipher) DecryptBlocks(dst, src []byte) {
+	if len(src)%BlockSize != 0 {
+		panic("opensm/sm4: input not full blocks")
+	}
+	checkBlocks(dst, src, len(src))
+	cryptBlocks(&c.drk, dst, src)
+}
+
+func checkBlocks(dst, src []byte, n int) {
+	if len(src) < n {
+		panic("opensm/sm4: input not full block")
+	}
+	if len(dst) < n {
+		panic("opensm/sm4: output not full block")
 	}
+	if inexactOverlap(dst[:n], src[:n]) {
+		panic("opensm/sm4: invalid buffer overlap")
+	}
+}
+
+// cryptBlock runs the 32 rounds with round keys rk on one block.
+func cryptBlock(rk *[32]uint32, dst, src []byte) {
+	x0 := binary.BigEndian.Uint32(src[0:4])
+	x1 := binary.BigEndian.Uint32(src[4:8])
+	x2 := binary.BigEndian.Uint32(src[8:12])
+	x3 := binary.BigEndian.Uint32(src[12:16])
+
+	c0, c1, c2, c3 := encryptBlock(x0, x1, x2, x3, rk)
+
+	binary.BigEndian.PutUint32(dst[0:4], c0)
+	binary.BigEndian.PutUint32(dst[4:8], c1)
+	binary.BigEndian.PutUint32(dst[8:12], c2)
+	binary.BigEndian.PutUint32(dst[12:16], c3)
 }
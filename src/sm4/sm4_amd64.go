@@ -0,0 +1,44 @@
+//go:build amd64 && !purego
+
+package sm4
+
+import "opensm/src/cpu"
+
+var (
+	useAESNI = cpu.X86.HasAES && cpu.X86.HasSSSE3
+	useAVX2  = useAESNI && cpu.X86.HasAVX && cpu.X86.HasAVX2
+)
+
+//go:noescape
+func crypt4AESNI(rk *[32]uint32, dst, src *byte)
+
+//go:noescape
+func crypt8AVX2(rk *[32]uint32, dst, src *byte)
+
+// cryptBlocks runs the rounds with round keys rk on the whole blocks of src.
+// With AES-NI every block, including a short tail, goes through the
+// constant-time assembly.
+func cryptBlocks(rk *[32]uint32, dst, src []byte) {
+	if !useAESNI {
+		cryptBlocksGeneric(rk, dst, src)
+		return
+	}
+
+	if useAVX2 {
+		for len(src) >= 8*BlockSize {
+			crypt8AVX2(rk, &dst[0], &src[0])
+			dst, src = dst[8*BlockSize:], src[8*BlockSize:]
+		}
+	}
+	for len(src) >= 4*BlockSize {
+		crypt4AESNI(rk, &dst[0], &src[0])
+		dst, src = dst[4*BlockSize:], src[4*BlockSize:]
+	}
+
+	if n := len(src) / BlockSize * BlockSize; n > 0 {
+		var buf [4 * BlockSize]byte
+		copy(buf[:], src[:n])
+		crypt4AESNI(rk, &buf[0], &buf[0])
+		copy(dst, buf[:n])
+	}
+}
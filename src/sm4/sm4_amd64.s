@@ -0,0 +1,274 @@
+//go:build amd64 && !purego
+
+#include "textflag.h"
+
+// The SM4 S-box is affine-equivalent to the AES one: S(x) = B·AES(A·x + a) + b,
+// so each round pushes its 16 or 32 bytes through AESENCLAST with a zero key,
+// wrapped in two 8x8 bit affine maps done as a pair of nibble PSHUFB lookups.
+// AESENCLAST also applies ShiftRows, which is undone with PSHUFB.
+//
+// Blocks are transposed so that register Wj holds word j of every block, one
+// 32-bit lane per block; the AVX2 variant does the same in each 128-bit half.
+// X0-X3 hold the words, X4-X7 are scratch and X8-X15 hold constants.
+
+DATA nibbleMask<>+0(SB)/8, $0x0f0f0f0f0f0f0f0f
+DATA nibbleMask<>+8(SB)/8, $0x0f0f0f0f0f0f0f0f
+GLOBL nibbleMask<>(SB), (NOPTR+RODATA), $16
+
+DATA preLo<>+0(SB)/8, $0x078b37bb820eb23e
+DATA preLo<>+8(SB)/8, $0x9814a8241d912da1
+GLOBL preLo<>(SB), (NOPTR+RODATA), $16
+
+DATA preHi<>+0(SB)/8, $0x37eb19c5f22edc00
+DATA preHi<>+8(SB)/8, $0x3fe311cdfa26d408
+GLOBL preHi<>(SB), (NOPTR+RODATA), $16
+
+DATA postLo<>+0(SB)/8, $0x2098ea521ea6d46c
+DATA postLo<>+8(SB)/8, $0x47ff8d3579c1b30b
+GLOBL postLo<>(SB), (NOPTR+RODATA), $16
+
+DATA postHi<>+0(SB)/8, $0x2dcd7d9db050e000
+DATA postHi<>+8(SB)/8, $0xed0dbd5d709020c0
+GLOBL postHi<>(SB), (NOPTR+RODATA), $16
+
+DATA invShiftRows<>+0(SB)/8, $0x0b0e0104070a0d00
+DATA invShiftRows<>+8(SB)/8, $0x0306090c0f020508
+GLOBL invShiftRows<>(SB), (NOPTR+RODATA), $16
+
+DATA bswap32<>+0(SB)/8, $0x0405060700010203
+DATA bswap32<>+8(SB)/8, $0x0c0d0e0f08090a0b
+GLOBL bswap32<>(SB), (NOPTR+RODATA), $16
+
+DATA rotl8<>+0(SB)/8, $0x0605040702010003
+DATA rotl8<>+8(SB)/8, $0x0e0d0c0f0a09080b
+GLOBL rotl8<>(SB), (NOPTR+RODATA), $16
+
+DATA rotl16<>+0(SB)/8, $0x0504070601000302
+DATA rotl16<>+8(SB)/8, $0x0d0c0f0e09080b0a
+GLOBL rotl16<>(SB), (NOPTR+RODATA), $16
+
+DATA rotl24<>+0(SB)/8, $0x0407060500030201
+DATA rotl24<>+8(SB)/8, $0x0c0f0e0d080b0a09
+GLOBL rotl24<>(SB), (NOPTR+RODATA), $16
+
+// X4 = affine(X4) using the nibble tables lo and hi; X5 is clobbered.
+#define AFFINE(lo, hi) \
+	MOVOU  X4, X5   \
+	PSRLQ  $4, X5   \
+	PAND   X15, X4  \
+	PAND   X15, X5  \
+	MOVOU  lo, X6   \
+	PSHUFB X4, X6   \
+	MOVOU  hi, X4   \
+	PSHUFB X5, X4   \
+	PXOR   X6, X4
+
+// x0 ^= L(S(x1 ^ x2 ^ x3 ^ rk[i]))
+#define ROUND(i, x0, x1, x2, x3) \
+	MOVSS      ((i)*4)(AX), X4 \
+	PSHUFD     $0, X4, X4    \
+	PXOR       x1, X4        \
+	PXOR       x2, X4        \
+	PXOR       x3, X4        \
+	AFFINE(X14, X13)         \
+	PXOR       X5, X5        \
+	AESENCLAST X5, X4        \
+	PSHUFB     X10, X4       \
+	AFFINE(X12, X11)         \
+	PXOR       X4, x0        \
+	MOVOU      X4, X5        \
+	PSHUFB     X9, X5        \
+	MOVOU      X4, X6        \
+	PSHUFB     X8, X6        \
+	PXOR       X4, X5        \
+	PXOR       X6, X5        \
+	MOVOU      X5, X6        \
+	PSLLL      $2, X5        \
+	PSRLL      $30, X6       \
+	PXOR       X5, x0        \
+	PXOR       X6, x0        \
+	PSHUFB     rotl24<>(SB), X4 \
+	PXOR       X4, x0
+
+// Transpose the 4x4 matrix of 32-bit words in r0-r3; t0, t1 are scratch.
+#define TRANSPOSE(r0, r1, r2, r3, t0, t1) \
+	MOVOU      r0, t0 \
+	PUNPCKLLQ  r1, t0 \
+	PUNPCKHLQ  r1, r0 \
+	MOVOU      r2, t1 \
+	PUNPCKLLQ  r3, t1 \
+	PUNPCKHLQ  r3, r2 \
+	MOVOU      t0, r1 \
+	PUNPCKLQDQ t1, t0 \
+	PUNPCKHQDQ t1, r1 \
+	MOVOU      r0, r3 \
+	PUNPCKLQDQ r2, r0 \
+	PUNPCKHQDQ r2, r3 \
+	MOVOU      r0, r2 \
+	MOVOU      t0, r0
+
+#define ROUNDS4(i) \
+	ROUND(i, X0, X1, X2, X3)     \
+	ROUND(i+1, X1, X2, X3, X0)   \
+	ROUND(i+2, X2, X3, X0, X1)   \
+	ROUND(i+3, X3, X0, X1, X2)
+
+// func crypt4AESNI(rk *[32]uint32, dst, src *byte)
+TEXT ·crypt4AESNI(SB), NOSPLIT, $0-24
+	MOVQ rk+0(FP), AX
+	MOVQ dst+8(FP), DI
+	MOVQ src+16(FP), SI
+
+	MOVOU nibbleMask<>(SB), X15
+	MOVOU preLo<>(SB), X14
+	MOVOU preHi<>(SB), X13
+	MOVOU postLo<>(SB), X12
+	MOVOU postHi<>(SB), X11
+	MOVOU invShiftRows<>(SB), X10
+	MOVOU rotl8<>(SB), X9
+	MOVOU rotl16<>(SB), X8
+
+	MOVOU   bswap32<>(SB), X7
+	MOVOU   0(SI), X0
+	MOVOU   16(SI), X1
+	MOVOU   32(SI), X2
+	MOVOU   48(SI), X3
+	PSHUFB  X7, X0
+	PSHUFB  X7, X1
+	PSHUFB  X7, X2
+	PSHUFB  X7, X3
+	TRANSPOSE(X0, X1, X2, X3, X4, X5)
+
+	ROUNDS4(0)
+	ROUNDS4(4)
+	ROUNDS4(8)
+	ROUNDS4(12)
+	ROUNDS4(16)
+	ROUNDS4(20)
+	ROUNDS4(24)
+	ROUNDS4(28)
+
+	// the output words are X35, X34, X33, X32
+	TRANSPOSE(X3, X2, X1, X0, X4, X5)
+	MOVOU  bswap32<>(SB), X7
+	PSHUFB X7, X3
+	PSHUFB X7, X2
+	PSHUFB X7, X1
+	PSHUFB X7, X0
+	MOVOU  X3, 0(DI)
+	MOVOU  X2, 16(DI)
+	MOVOU  X1, 32(DI)
+	MOVOU  X0, 48(DI)
+	RET
+
+// Y4 = affine(Y4) using the nibble tables lo and hi; Y5, Y6 are clobbered.
+#define VAFFINE(lo, hi) \
+	VPSRLQ $4, Y4, Y5   \
+	VPAND  Y15, Y4, Y4  \
+	VPAND  Y15, Y5, Y5  \
+	VPSHUFB Y4, lo, Y6  \
+	VPSHUFB Y5, hi, Y4  \
+	VPXOR  Y6, Y4, Y4
+
+// AESENCLAST has no 256-bit form without VAES, so each half goes through it
+// on its own.
+#define VROUND(i, x0, x1, x2, x3) \
+	VPBROADCASTD ((i)*4)(AX), Y4         \
+	VPXOR        x1, Y4, Y4            \
+	VPXOR        x2, Y4, Y4            \
+	VPXOR        x3, Y4, Y4            \
+	VAFFINE(Y14, Y13)                  \
+	VEXTRACTI128 $1, Y4, X5            \
+	VPXOR        X6, X6, X6            \
+	VAESENCLAST  X6, X4, X4            \
+	VAESENCLAST  X6, X5, X5            \
+	VINSERTI128  $1, X5, Y4, Y4        \
+	VPSHUFB      Y10, Y4, Y4           \
+	VAFFINE(Y12, Y11)                  \
+	VPXOR        Y4, x0, x0            \
+	VPSHUFB      Y9, Y4, Y5            \
+	VPSHUFB      Y8, Y4, Y6            \
+	VPXOR        Y4, Y5, Y5            \
+	VPXOR        Y6, Y5, Y5            \
+	VPSLLD       $2, Y5, Y6            \
+	VPSRLD       $30, Y5, Y5           \
+	VPXOR        Y6, x0, x0            \
+	VPXOR        Y5, x0, x0            \
+	VPSHUFB      Y7, Y4, Y4            \
+	VPXOR        Y4, x0, x0
+
+#define VTRANSPOSE(r0, r1, r2, r3, t0, t1) \
+	VPUNPCKLDQ  r1, r0, t0 \
+	VPUNPCKHDQ  r1, r0, r0 \
+	VPUNPCKLDQ  r3, r2, t1 \
+	VPUNPCKHDQ  r3, r2, r2 \
+	VPUNPCKHQDQ t1, t0, r1 \
+	VPUNPCKLQDQ t1, t0, t0 \
+	VPUNPCKHQDQ r2, r0, r3 \
+	VPUNPCKLQDQ r2, r0, r2 \
+	VMOVDQU     t0, r0
+
+#define VROUNDS4(i) \
+	VROUND(i, Y0, Y1, Y2, Y3)     \
+	VROUND(i+1, Y1, Y2, Y3, Y0)   \
+	VROUND(i+2, Y2, Y3, Y0, Y1)   \
+	VROUND(i+3, Y3, Y0, Y1, Y2)
+
+// func crypt8AVX2(rk *[32]uint32, dst, src *byte)
+TEXT ·crypt8AVX2(SB), NOSPLIT, $0-24
+	MOVQ rk+0(FP), AX
+	MOVQ dst+8(FP), DI
+	MOVQ src+16(FP), SI
+
+	VBROADCASTI128 nibbleMask<>(SB), Y15
+	VBROADCASTI128 preLo<>(SB), Y14
+	VBROADCASTI128 preHi<>(SB), Y13
+	VBROADCASTI128 postLo<>(SB), Y12
+	VBROADCASTI128 postHi<>(SB), Y11
+	VBROADCASTI128 invShiftRows<>(SB), Y10
+	VBROADCASTI128 rotl8<>(SB), Y9
+	VBROADCASTI128 rotl16<>(SB), Y8
+
+	// blocks 0-3 go to the low halves and 4-7 to the high halves
+	VBROADCASTI128 bswap32<>(SB), Y7
+	VMOVDQU        0(SI), X0
+	VMOVDQU        16(SI), X1
+	VMOVDQU        32(SI), X2
+	VMOVDQU        48(SI), X3
+	VINSERTI128    $1, 64(SI), Y0, Y0
+	VINSERTI128    $1, 80(SI), Y1, Y1
+	VINSERTI128    $1, 96(SI), Y2, Y2
+	VINSERTI128    $1, 112(SI), Y3, Y3
+	VPSHUFB        Y7, Y0, Y0
+	VPSHUFB        Y7, Y1, Y1
+	VPSHUFB        Y7, Y2, Y2
+	VPSHUFB        Y7, Y3, Y3
+	VTRANSPOSE(Y0, Y1, Y2, Y3, Y4, Y5)
+
+	VBROADCASTI128 rotl24<>(SB), Y7
+	VROUNDS4(0)
+	VROUNDS4(4)
+	VROUNDS4(8)
+	VROUNDS4(12)
+	VROUNDS4(16)
+	VROUNDS4(20)
+	VROUNDS4(24)
+	VROUNDS4(28)
+
+	VTRANSPOSE(Y3, Y2, Y1, Y0, Y4, Y5)
+	VBROADCASTI128 bswap32<>(SB), Y7
+	VPSHUFB        Y7, Y3, Y3
+	VPSHUFB        Y7, Y2, Y2
+	VPSHUFB        Y7, Y1, Y1
+	VPSHUFB        Y7, Y0, Y0
+	VMOVDQU        X3, 0(DI)
+	VMOVDQU        X2, 16(DI)
+	VMOVDQU        X1, 32(DI)
+	VMOVDQU        X0, 48(DI)
+	VEXTRACTI128   $1, Y3, 64(DI)
+	VEXTRACTI128   $1, Y2, 80(DI)
+	VEXTRACTI128   $1, Y1, 96(DI)
+	VEXTRACTI128   $1, Y0, 112(DI)
+
+	VZEROUPPER
+	RET
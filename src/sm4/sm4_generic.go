@@ -0,0 +1,7 @@
+//go:build !amd64 || purego
+
+package sm4
+
+func cryptBlocks(rk *[32]uint32, dst, src []byte) {
+	cryptBlocksGeneric(rk, dst, src)
+}
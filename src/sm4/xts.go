@@ -0,0 +1,174 @@
+package sm4
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+// XTS is the XTS mode of SM4 for encrypting data units such as disk sectors.
+// Each data unit must be at least one block long; a trailing partial block
+// is handled with ciphertext stealing.
+//
+// IEEE 1619 and GB/T 17964-2021 differ only in how the tweak is multiplied
+// by x between blocks: IEEE reads the tweak as a little-endian polynomial
+// (reduction constant 0x87), GB/T as a bit-reflected one like GCM (0xE1).
+type XTS struct {
+	k1, k2 *sm4Cipher
+	gb     bool
+}
+
+// xtsLanes is how many blocks are gathered for one multi-block call.
+const xtsLanes = bitsliceLanes
+
+// NewXTS returns SM4-XTS with the IEEE 1619 tweak convention. The 32-byte
+// key is the data key followed by the tweak key; the two halves must differ.
+func NewXTS(key []byte) (*XTS, error) {
+	return newXTS(key, false)
+}
+
+// NewXTSGB returns SM4-XTS with the GB/T 17964-2021 tweak convention.
+func NewXTSGB(key []byte) (*XTS, error) {
+	return newXTS(key, true)
+}
+
+func newXTS(key []byte, gb bool) (*XTS, error) {
+	if len(key) != 2*KeySize {
+		return nil, KeySizeError(len(key))
+	}
+	if subtle.ConstantTimeCompare(key[:KeySize], key[KeySize:]) == 1 {
+		return nil, errors.New("opensm/sm4: XTS data and tweak keys must differ")
+	}
+
+	k1, _ := NewCipher(key[:KeySize])
+	k2, _ := NewCipher(key[KeySize:])
+	return &XTS{k1: k1.(*sm4Cipher), k2: k2.(*sm4Cipher), gb: gb}, nil
+}
+
+// Zeroize wipes both keys. The XTS must not be used afterwards.
+func (x *XTS) Zeroize() {
+	x.k1.Zeroize()
+	x.k2.Zeroize()
+}
+
+// sectorTweak encodes a sector number as a 128-bit little-endian value, as
+// IEEE 1619 does; the same encoding is used for GB/T 17964.
+func sectorTweak(sector uint64) *[BlockSize]byte {
+	var t [BlockSize]byte
+	binary.LittleEndian.PutUint64(t[:8], sector)
+	return &t
+}
+
+// Encrypt encrypts the data unit src, numbered sector, into dst.
+func (x *XTS) Encrypt(dst, src []byte, sector uint64) {
+	x.EncryptTweak(dst, src, sectorTweak(sector))
+}
+
+// Decrypt decrypts the data unit src, numbered sector, into dst.
+func (x *XTS) Decrypt(dst, src []byte, sector uint64) {
+	x.DecryptTweak(dst, src, sectorTweak(sector))
+}
+
+// EncryptTweak encrypts the data unit src into dst with the 128-bit tweak
+// value, which is encrypted with the tweak key before use.
+func (x *XTS) EncryptTweak(dst, src []byte, tweak *[BlockSize]byte) {
+	x.crypt(dst, src, tweak, false)
+}
+
+// DecryptTweak decrypts the data unit src into dst with the 128-bit tweak
+// value.
+func (x *XTS) DecryptTweak(dst, src []byte, tweak *[BlockSize]byte) {
+	x.crypt(dst, src, tweak, true)
+}
+
+func (x *XTS) mul(t *[BlockSize]byte) {
+	if x.gb {
+		var carry byte
+		for i := range t {
+			next := t[i] & 1
+			t[i] = t[i]>>1 | carry<<7
+			carry = next
+		}
+		t[0] ^= 0xE1 & -carry
+		return
+	}
+
+	var carry byte
+	for i := range t {
+		next := t[i] >> 7
+		t[i] = t[i]<<1 | carry
+		carry = next
+	}
+	t[0] ^= 0x87 & -carry
+}
+
+func (x *XTS) crypt(dst, src []byte, tweak *[BlockSize]byte, decrypt bool) {
+	if len(src) < BlockSize {
+		panic("opensm/sm4: XTS data unit shorter than one block")
+	}
+	if len(dst) < len(src) {
+		panic("opensm/sm4: output smaller than input")
+	}
+	if inexactOverlap(dst[:len(src)], src) {
+		panic("opensm/sm4: invalid buffer overlap")
+	}
+
+	rk := &x.k1.rk
+	if decrypt {
+		rk = &x.k1.drk
+	}
+
+	var t [BlockSize]byte
+	encryptBlockCT(&x.k2.rk, t[:], tweak[:])
+
+	// with a partial last block, the last full block takes part in stealing
+	r := len(src) % BlockSize
+	full := len(src) - r
+	if r != 0 {
+		full -= BlockSize
+	}
+
+	var tw, buf [xtsLanes * BlockSize]byte
+	for off := 0; off < full; {
+		n := min(full-off, len(buf))
+		for i := 0; i < n; i += BlockSize {
+			copy(tw[i:], t[:])
+			x.mul(&t)
+		}
+		subtle.XORBytes(buf[:n], src[off:off+n], tw[:n])
+		// short runs are padded so that they avoid the table-driven cryptBlock
+		padded := max(n, bitsliceMin*BlockSize)
+		cryptBlocks(rk, buf[:padded], buf[:padded])
+		subtle.XORBytes(dst[off:off+n], buf[:n], tw[:n])
+		off += n
+	}
+
+	if r == 0 {
+		return
+	}
+
+	// ciphertext stealing: the second tweak is used first when decrypting
+	t1 := t
+	x.mul(&t)
+	t2 := t
+	if decrypt {
+		t1, t2 = t2, t1
+	}
+
+	var cc [BlockSize]byte
+	xtsBlock(rk, &cc, src[full:full+BlockSize], &t1)
+
+	var pp [BlockSize]byte
+	copy(pp[:], src[full+BlockSize:])
+	copy(pp[r:], cc[r:])
+	copy(dst[full+BlockSize:], cc[:r])
+	xtsBlock(rk, &pp, pp[:], &t2)
+	copy(dst[full:], pp[:])
+}
+
+// xtsBlock sets out to E(in ^ t) ^ t, E running with round keys rk.
+func xtsBlock(rk *[32]uint32, out *[BlockSize]byte, in []byte, t *[BlockSize]byte) {
+	subtle.XORBytes(out[:], in, t[:])
+	encryptBlockCT(rk, out[:], out[:])
+	subtle.XORBytes(out[:], out[:], t[:])
+}
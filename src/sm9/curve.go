@@ -0,0 +1,294 @@
+package sm9
+
+import (
+	"errors"
+	"math/big"
+)
+
+var (
+	// curveB is b of E(Fp): y² = x³ + 5 and twistB that of the twist
+	// E'(Fp2): y² = x³ + 5u.
+	curveB = fp2{big.NewInt(5), new(big.Int)}
+	twistB = fp2{new(big.Int), big.NewInt(5)}
+
+	g1Gen = jacobian{
+		x: fp2{bigFromHex("93DE051D62BF718FF5ED0704487D01D6E1E4086909DC3280E8C4E4817C66DDDD"), new(big.Int)},
+		y: fp2{bigFromHex("21FE8DDA4F21E607631065125C395BBC1C1C00CBFA6024350C464CD70A3EA616"), new(big.Int)},
+		z: fp2One(),
+	}
+	g2Gen = jacobian{
+		x: fp2{
+			bigFromHex("3722755292130B08D2AAB97FD34EC120EE265948D19C17ABF9B7213BAF82D65B"),
+			bigFromHex("85AEF3D078640C98597B6027B441A01FF1DD2C190F5E93C454806C11D8806141"),
+		},
+		y: fp2{
+			bigFromHex("A7CF28D519BE3DA65F3170153D278FF247EFBA98A71A08116215BBA5C999A7C7"),
+			bigFromHex("17509B092E845C1266BA0D262CBEE6ED0736A96FA347C8BD856DC76B84EBEB96"),
+		},
+		z: fp2One(),
+	}
+)
+
+var errPoint = errors.New("opensm/sm9: invalid point encoding")
+
+// jacobian is the point (x/z², y/z³) of a curve y² = x³ + b over Fp2. G1
+// points keep their coordinates in Fp and G2 points are on the twist. The
+// point at infinity has z = 0.
+type jacobian struct {
+	x, y, z fp2
+}
+
+func infinity() jacobian { return jacobian{fp2One(), fp2One(), fp2Zero()} }
+
+func (a *jacobian) isInfinity() bool { return a.z.isZero() }
+
+func (a *jacobian) double() jacobian {
+	if a.isInfinity() {
+		return *a
+	}
+	// dbl-2009-l for a = 0
+	xx := fp2Mul(a.x, a.x)
+	yy := fp2Mul(a.y, a.y)
+	yyyy := fp2Mul(yy, yy)
+	d := fp2Sub(fp2Mul(fp2Add(a.x, yy), fp2Add(a.x, yy)), fp2Add(xx, yyyy))
+	d = fp2Add(d, d)
+	e := fp2Add(fp2Add(xx, xx), xx)
+	x3 := fp2Sub(fp2Mul(e, e), fp2Add(d, d))
+	y8 := fp2Add(yyyy, yyyy)
+	y8 = fp2Add(y8, y8)
+	y8 = fp2Add(y8, y8)
+	y3 := fp2Sub(fp2Mul(e, fp2Sub(d, x3)), y8)
+	z3 := fp2Mul(a.y, a.z)
+	return jacobian{x3, y3, fp2Add(z3, z3)}
+}
+
+func (a *jacobian) add(b *jacobian) jacobian {
+	if a.isInfinity() {
+		return *b
+	}
+	if b.isInfinity() {
+		return *a
+	}
+	z1z1 := fp2Mul(a.z, a.z)
+	z2z2 := fp2Mul(b.z, b.z)
+	u1 := fp2Mul(a.x, z2z2)
+	u2 := fp2Mul(b.x, z1z1)
+	s1 := fp2Mul(a.y, fp2Mul(b.z, z2z2))
+	s2 := fp2Mul(b.y, fp2Mul(a.z, z1z1))
+	h := fp2Sub(u2, u1)
+	r := fp2Sub(s2, s1)
+	if h.isZero() {
+		if r.isZero() {
+			return a.double()
+		}
+		return infinity()
+	}
+	hh := fp2Mul(h, h)
+	hhh := fp2Mul(h, hh)
+	v := fp2Mul(u1, hh)
+	x3 := fp2Sub(fp2Sub(fp2Mul(r, r), hhh), fp2Add(v, v))
+	y3 := fp2Sub(fp2Mul(r, fp2Sub(v, x3)), fp2Mul(s1, hhh))
+	z3 := fp2Mul(fp2Mul(a.z, b.z), h)
+	return jacobian{x3, y3, z3}
+}
+
+func (a *jacobian) neg() jacobian { return jacobian{a.x, fp2Neg(a.y), a.z} }
+
+func (a *jacobian) mul(k *big.Int) jacobian {
+	r := infinity()
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		r = r.double()
+		if k.Bit(i) == 1 {
+			r = r.add(a)
+		}
+	}
+	return r
+}
+
+// affine returns a with z = 1, or the point at infinity unchanged.
+func (a *jacobian) affine() jacobian {
+	if a.isInfinity() {
+		return *a
+	}
+	zi := fp2Inv(a.z)
+	zi2 := fp2Mul(zi, zi)
+	return jacobian{fp2Mul(a.x, zi2), fp2Mul(a.y, fp2Mul(zi2, zi)), fp2One()}
+}
+
+func (a *jacobian) equal(b *jacobian) bool {
+	if a.isInfinity() || b.isInfinity() {
+		return a.isInfinity() == b.isInfinity()
+	}
+	x, y := a.affine(), b.affine()
+	return x.x.equal(y.x) && x.y.equal(y.y)
+}
+
+// onCurve reports whether the affine point a satisfies y² = x³ + b.
+func (a *jacobian) onCurve(b fp2) bool {
+	rhs := fp2Add(fp2Mul(fp2Mul(a.x, a.x), a.x), b)
+	return fp2Mul(a.y, a.y).equal(rhs)
+}
+
+// appendFp appends the 32-byte big-endian encoding of x.
+func appendFp(b []byte, x *big.Int) []byte {
+	b = append(b, make([]byte, 32)...)
+	x.FillBytes(b[len(b)-32:])
+	return b
+}
+
+// readFp decodes a 32-byte field element, which must be below p.
+func readFp(b []byte) (*big.Int, error) {
+	x := new(big.Int).SetBytes(b[:32])
+	if x.Cmp(p) >= 0 {
+		return nil, errPoint
+	}
+	return x, nil
+}
+
+// G1 is a point of the group generated by P1 on E(Fp).
+type G1 struct {
+	p jacobian
+}
+
+// Gen1 returns the generator P1 of G1.
+func Gen1() *G1 { return &G1{g1Gen} }
+
+// ScalarBaseMult sets e to k·P1 and returns e.
+func (e *G1) ScalarBaseMult(k *big.Int) *G1 {
+	e.p = g1Gen.mul(k)
+	return e
+}
+
+// ScalarMult sets e to k·a and returns e.
+func (e *G1) ScalarMult(a *G1, k *big.Int) *G1 {
+	e.p = a.p.mul(k)
+	return e
+}
+
+// Add sets e to a+b and returns e.
+func (e *G1) Add(a, b *G1) *G1 {
+	e.p = a.p.add(&b.p)
+	return e
+}
+
+// Neg sets e to -a and returns e.
+func (e *G1) Neg(a *G1) *G1 {
+	e.p = a.p.neg()
+	return e
+}
+
+// Equal reports whether e and a are the same point.
+func (e *G1) Equal(a *G1) bool { return e.p.equal(&a.p) }
+
+// Marshal returns e as 0x04 || x || y, 65 bytes in all, or the single byte
+// 0x00 for the point at infinity.
+func (e *G1) Marshal() []byte {
+	if e.p.isInfinity() {
+		return []byte{0}
+	}
+	a := e.p.affine()
+	b := make([]byte, 1, 65)
+	b[0] = 4
+	b = appendFp(b, a.x.a0)
+	return appendFp(b, a.y.a0)
+}
+
+// Unmarshal sets e to the point encoded by Marshal. It fails for encodings
+// of points not on the curve and of the point at infinity.
+func (e *G1) Unmarshal(m []byte) error {
+	if len(m) != 65 || m[0] != 4 {
+		return errPoint
+	}
+	x, err := readFp(m[1:])
+	if err != nil {
+		return err
+	}
+	y, err := readFp(m[33:])
+	if err != nil {
+		return err
+	}
+	a := jacobian{fp2{x, new(big.Int)}, fp2{y, new(big.Int)}, fp2One()}
+	// G1 is all of E(Fp), whose order is prime
+	if !a.onCurve(curveB) {
+		return errPoint
+	}
+	e.p = a
+	return nil
+}
+
+// G2 is a point of the group generated by P2 on the twist E'(Fp2).
+type G2 struct {
+	p jacobian
+}
+
+// Gen2 returns the generator P2 of G2.
+func Gen2() *G2 { return &G2{g2Gen} }
+
+// ScalarBaseMult sets e to k·P2 and returns e.
+func (e *G2) ScalarBaseMult(k *big.Int) *G2 {
+	e.p = g2Gen.mul(k)
+	return e
+}
+
+// ScalarMult sets e to k·a and returns e.
+func (e *G2) ScalarMult(a *G2, k *big.Int) *G2 {
+	e.p = a.p.mul(k)
+	return e
+}
+
+// Add sets e to a+b and returns e.
+func (e *G2) Add(a, b *G2) *G2 {
+	e.p = a.p.add(&b.p)
+	return e
+}
+
+// Neg sets e to -a and returns e.
+func (e *G2) Neg(a *G2) *G2 {
+	e.p = a.p.neg()
+	return e
+}
+
+// Equal reports whether e and a are the same point.
+func (e *G2) Equal(a *G2) bool { return e.p.equal(&a.p) }
+
+// Marshal returns e as 0x04 || x || y with each coordinate a1 || a0, the
+// coefficient of u first, 129 bytes in all, or the single byte 0x00 for the
+// point at infinity.
+func (e *G2) Marshal() []byte {
+	if e.p.isInfinity() {
+		return []byte{0}
+	}
+	a := e.p.affine()
+	b := make([]byte, 1, 129)
+	b[0] = 4
+	b = appendFp(b, a.x.a1)
+	b = appendFp(b, a.x.a0)
+	b = appendFp(b, a.y.a1)
+	return appendFp(b, a.y.a0)
+}
+
+// Unmarshal sets e to the point encoded by Marshal. It fails for encodings
+// of points not in G2 and of the point at infinity.
+func (e *G2) Unmarshal(m []byte) error {
+	if len(m) != 129 || m[0] != 4 {
+		return errPoint
+	}
+	var c [4]*big.Int
+	for i := range c {
+		x, err := readFp(m[1+32*i:])
+		if err != nil {
+			return err
+		}
+		c[i] = x
+	}
+	a := jacobian{fp2{c[1], c[0]}, fp2{c[3], c[2]}, fp2One()}
+	if !a.onCurve(twistB) {
+		return errPoint
+	}
+	// the twist has a cofactor, so check the order too
+	if o := a.mul(Order); !o.isInfinity() {
+		return errPoint
+	}
+	e.p = a
+	return nil
+}
@@ -0,0 +1,237 @@
+package sm9
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"math/big"
+	"opensm/src/kdf"
+	"opensm/src/modes"
+	"opensm/src/sm3"
+	"opensm/src/sm4"
+)
+
+// HIDEncrypt is the hid byte GM/T 0044 assigns to encryption keys.
+const HIDEncrypt byte = 0x03
+
+// macKeySize is the length of the key K2 of the ciphertext MAC.
+const macKeySize = 32
+
+var (
+	errDecrypt = errors.New("opensm/sm9: decryption failed")
+	errKeyLen  = errors.New("opensm/sm9: key length must be positive")
+)
+
+// Cipher is the symmetric step of SM9 public-key encryption.
+type Cipher int
+
+const (
+	// XORCipher masks the message with KDF output as long as it.
+	XORCipher Cipher = iota
+	// SM4Cipher encrypts the message with SM4 in ECB mode with PKCS #7
+	// padding under a 16-byte KDF output.
+	SM4Cipher
+)
+
+// EncryptMasterPublicKey is the public encryption key of a key generation
+// centre, Ppub-e = ke·P1.
+type EncryptMasterPublicKey struct {
+	Ppub *G1
+}
+
+// EncryptMasterPrivateKey is the master encryption key ke of a key
+// generation centre.
+type EncryptMasterPrivateKey struct {
+	EncryptMasterPublicKey
+	D *big.Int
+}
+
+// EncryptPrivateKey is a user's decryption key
+// deB = (ke/(H1(ID || hid) + ke))·P2 with the master public key it was
+// issued under.
+type EncryptPrivateKey struct {
+	EncryptMasterPublicKey
+	D *G2
+}
+
+// NewEncryptMasterKey returns the master encryption key ke, which must be
+// in [1, N-1].
+func NewEncryptMasterKey(ke *big.Int) (*EncryptMasterPrivateKey, error) {
+	if !inRange(ke) {
+		return nil, errors.New("opensm/sm9: master key out of range")
+	}
+	d := new(big.Int).Set(ke)
+	return &EncryptMasterPrivateKey{EncryptMasterPublicKey{new(G1).ScalarBaseMult(d)}, d}, nil
+}
+
+// GenerateEncryptMasterKey returns a random master encryption key.
+func GenerateEncryptMasterKey(rand io.Reader) (*EncryptMasterPrivateKey, error) {
+	ke, err := randScalar(rand)
+	if err != nil {
+		return nil, err
+	}
+	return NewEncryptMasterKey(ke)
+}
+
+// ExtractKey returns the decryption key of the user with identity id, hid
+// normally being HIDEncrypt.
+func (m *EncryptMasterPrivateKey) ExtractKey(id []byte, hid byte) (*EncryptPrivateKey, error) {
+	t2, err := extractScalar(m.D, id, hid)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptPrivateKey{m.EncryptMasterPublicKey, new(G2).ScalarBaseMult(t2)}, nil
+}
+
+// UserKey returns QB = H1(id || hid)·P1 + Ppub-e, the public key of the
+// user with identity id.
+func (pub *EncryptMasterPublicKey) UserKey(id []byte, hid byte) *G1 {
+	q := new(G1).ScalarBaseMult(hashToRange(1, id, []byte{hid}))
+	return q.Add(q, pub.Ppub)
+}
+
+// kemKey returns KDF(C || w || id, keyLen), with C as x || y.
+func kemKey(c *G1, w *GT, id []byte, keyLen int) []byte {
+	z := append(c.Marshal()[1:], w.Marshal()...)
+	return kdf.KDF(append(z, id...), keyLen)
+}
+
+// Encapsulate returns a random key of keyLen bytes for the user with
+// identity id and hid, and the encapsulation C from which Decapsulate
+// recovers it. keyLen must be positive.
+func Encapsulate(rand io.Reader, pub *EncryptMasterPublicKey, id []byte, hid byte, keyLen int) (key []byte, c *G1, err error) {
+	if keyLen < 1 {
+		return nil, nil, errKeyLen
+	}
+	q := pub.UserKey(id, hid)
+	g := Pair(pub.Ppub, Gen2())
+	for {
+		r, err := randScalar(rand)
+		if err != nil {
+			return nil, nil, err
+		}
+		c = new(G1).ScalarMult(q, r)
+		key = kemKey(c, new(GT).Exp(g, r), id, keyLen)
+		if !allZero(key) {
+			return key, c, nil
+		}
+	}
+}
+
+// Decapsulate returns the key of keyLen bytes encapsulated in c for the
+// user with identity id and decryption key priv.
+func Decapsulate(priv *EncryptPrivateKey, id []byte, c *G1, keyLen int) ([]byte, error) {
+	if keyLen < 1 {
+		return nil, errKeyLen
+	}
+	if c == nil || c.p.isInfinity() {
+		return nil, errDecrypt
+	}
+	key := kemKey(c, Pair(c, priv.D), id, keyLen)
+	if allZero(key) {
+		return nil, errDecrypt
+	}
+	return key, nil
+}
+
+func allZero(b []byte) bool {
+	var v byte
+	for _, x := range b {
+		v |= x
+	}
+	return v == 0
+}
+
+// encKeyLen returns the length of K1 for a message of n bytes.
+func encKeyLen(c Cipher, n int) int {
+	switch c {
+	case XORCipher:
+		return n
+	case SM4Cipher:
+		return sm4.KeySize
+	}
+	panic("opensm/sm9: unknown cipher")
+}
+
+// mac returns MAC(K2, c2) = SM3(c2 || K2).
+func mac(k2, c2 []byte) []byte {
+	h := sm3.New()
+	h.Write(c2)
+	h.Write(k2)
+	return h.Sum(nil)
+}
+
+// Encrypt encrypts msg to the user with identity id and hid. The
+// ciphertext is C1 || C3 || C2: the 64-byte point C1 as x || y, the 32-byte
+// MAC C3 and the encrypted message C2.
+func Encrypt(rand io.Reader, pub *EncryptMasterPublicKey, id []byte, hid byte, msg []byte, c Cipher) ([]byte, error) {
+	k1Len := encKeyLen(c, len(msg))
+	for {
+		k, c1, err := Encapsulate(rand, pub, id, hid, k1Len+macKeySize)
+		if err != nil {
+			return nil, err
+		}
+		k1, k2 := k[:k1Len], k[k1Len:]
+
+		var c2 []byte
+		if c == XORCipher {
+			if len(k1) > 0 && allZero(k1) {
+				continue
+			}
+			c2 = make([]byte, len(msg))
+			subtle.XORBytes(c2, msg, k1)
+		} else {
+			b, err := sm4.NewCipher(k1)
+			if err != nil {
+				return nil, err
+			}
+			if c2, err = modes.EncryptECB(b, modes.InsecureECB{}, msg, modes.PKCS7); err != nil {
+				return nil, err
+			}
+		}
+
+		out := append(c1.Marshal()[1:], mac(k2, c2)...)
+		return append(out, c2...), nil
+	}
+}
+
+// Decrypt decrypts a ciphertext from Encrypt with the decryption key priv
+// of the user with identity id.
+func Decrypt(priv *EncryptPrivateKey, id []byte, ciphertext []byte, c Cipher) ([]byte, error) {
+	if len(ciphertext) < 64+sm3.Size {
+		return nil, errDecrypt
+	}
+	c1 := new(G1)
+	if err := c1.Unmarshal(append([]byte{4}, ciphertext[:64]...)); err != nil {
+		return nil, errDecrypt
+	}
+	c3, c2 := ciphertext[64:64+sm3.Size], ciphertext[64+sm3.Size:]
+
+	k1Len := encKeyLen(c, len(c2))
+	k, err := Decapsulate(priv, id, c1, k1Len+macKeySize)
+	if err != nil {
+		return nil, err
+	}
+	k1, k2 := k[:k1Len], k[k1Len:]
+	if subtle.ConstantTimeCompare(mac(k2, c2), c3) != 1 {
+		return nil, errDecrypt
+	}
+
+	if c == XORCipher {
+		if len(k1) > 0 && allZero(k1) {
+			return nil, errDecrypt
+		}
+		msg := make([]byte, len(c2))
+		subtle.XORBytes(msg, c2, k1)
+		return msg, nil
+	}
+	b, err := sm4.NewCipher(k1)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := modes.DecryptECB(b, modes.InsecureECB{}, c2, modes.PKCS7)
+	if err != nil {
+		return nil, errDecrypt
+	}
+	return msg, nil
+}
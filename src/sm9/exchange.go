@@ -0,0 +1,246 @@
+package sm9
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"math/big"
+	"opensm/src/kdf"
+	"opensm/src/sm3"
+)
+
+// HIDExchange is the hid byte GM/T 0044 assigns to key exchange keys.
+const HIDExchange byte = 0x02
+
+var (
+	errExchangeState = errors.New("opensm/sm9: key exchange step out of order")
+	errConfirm       = errors.New("opensm/sm9: key confirmation failed")
+	errMessage       = errors.New("opensm/sm9: invalid key exchange message")
+)
+
+// KeyExchange is one party to the SM9 key exchange of GM/T 0044 part 3.
+// The initiator A calls Init and then Finish; the responder B calls Respond
+// and, with confirmation, Confirm. A KeyExchange is good for one run.
+type KeyExchange struct {
+	priv     *EncryptPrivateKey
+	id, peer []byte
+	hid      byte
+	keyLen   int
+	confirm  bool
+
+	initiator bool
+	r         *big.Int
+	ra, rb    *G1
+	// g1 = e(Ppub-e, P2)^rA, g2 = e(Ppub-e, P2)^rB and g3 = g1^rB, which
+	// both sides reach by different routes
+	g1, g2, g3 *GT
+	key        []byte
+	done       bool
+}
+
+// ExchangeInit is the message RA that the initiator sends first.
+type ExchangeInit struct {
+	R *G1
+}
+
+// ExchangeResponse is the responder's reply RB with, when confirmation is
+// on, its confirmation hash SB.
+type ExchangeResponse struct {
+	R *G1
+	S []byte
+}
+
+// ExchangeConfirm is the initiator's confirmation hash SA.
+type ExchangeConfirm struct {
+	S []byte
+}
+
+// NewKeyExchange returns a party with decryption key priv for identity id
+// agreeing keyLen bytes with the party with identity peer, both keys
+// issued with hid, normally HIDExchange. With confirm, each side proves to
+// the other it holds the same key. keyLen must be positive.
+func NewKeyExchange(priv *EncryptPrivateKey, id, peer []byte, hid byte, keyLen int, confirm bool) (*KeyExchange, error) {
+	if keyLen < 1 {
+		return nil, errKeyLen
+	}
+	return &KeyExchange{
+		priv:    priv,
+		id:      append([]byte(nil), id...),
+		peer:    append([]byte(nil), peer...),
+		hid:     hid,
+		keyLen:  keyLen,
+		confirm: confirm,
+	}, nil
+}
+
+// ephemeral picks r and returns R = r·(H1(peer || hid)·P1 + Ppub-e).
+func (k *KeyExchange) ephemeral(rand io.Reader) (*G1, error) {
+	r, err := randScalar(rand)
+	if err != nil {
+		return nil, err
+	}
+	k.r = r
+	return new(G1).ScalarMult(k.priv.UserKey(k.peer, k.hid), r), nil
+}
+
+// Init runs steps A1 to A4 and returns the message for the responder.
+func (k *KeyExchange) Init(rand io.Reader) (*ExchangeInit, error) {
+	if k.r != nil {
+		return nil, errExchangeState
+	}
+	ra, err := k.ephemeral(rand)
+	if err != nil {
+		return nil, err
+	}
+	k.initiator, k.ra = true, ra
+	return &ExchangeInit{ra}, nil
+}
+
+// Respond runs steps B1 to B6 on the initiator's message and returns the
+// reply and the agreed key. With confirmation the key must not be used
+// before Confirm accepts the initiator's hash.
+func (k *KeyExchange) Respond(rand io.Reader, m *ExchangeInit) (*ExchangeResponse, []byte, error) {
+	if k.r != nil {
+		return nil, nil, errExchangeState
+	}
+	if m == nil || m.R == nil || m.R.p.isInfinity() {
+		return nil, nil, errMessage
+	}
+	rb, err := k.ephemeral(rand)
+	if err != nil {
+		return nil, nil, err
+	}
+	k.ra, k.rb = m.R, rb
+	k.g1 = Pair(m.R, k.priv.D)
+	k.g2 = new(GT).Exp(Pair(k.priv.Ppub, Gen2()), k.r)
+	k.g3 = new(GT).Exp(k.g1, k.r)
+	k.key = k.sharedKey()
+
+	resp := &ExchangeResponse{R: rb}
+	if k.confirm {
+		resp.S = k.confirmHash(0x82)
+	} else {
+		k.done = true
+	}
+	return resp, k.key, nil
+}
+
+// Finish runs steps A5 to A8 on the responder's reply. It returns the
+// agreed key and, with confirmation, the message for the responder.
+func (k *KeyExchange) Finish(m *ExchangeResponse) ([]byte, *ExchangeConfirm, error) {
+	if !k.initiator || k.done {
+		return nil, nil, errExchangeState
+	}
+	if m == nil || m.R == nil || m.R.p.isInfinity() {
+		return nil, nil, errMessage
+	}
+	k.rb = m.R
+	k.g1 = new(GT).Exp(Pair(k.priv.Ppub, Gen2()), k.r)
+	k.g2 = Pair(m.R, k.priv.D)
+	k.g3 = new(GT).Exp(k.g2, k.r)
+	k.done = true
+
+	if !k.confirm {
+		return k.sharedKey(), nil, nil
+	}
+	if subtle.ConstantTimeCompare(k.confirmHash(0x82), m.S) != 1 {
+		return nil, nil, errConfirm
+	}
+	return k.sharedKey(), &ExchangeConfirm{k.confirmHash(0x83)}, nil
+}
+
+// Confirm runs step B8, checking the initiator's hash.
+func (k *KeyExchange) Confirm(m *ExchangeConfirm) error {
+	if k.initiator || k.key == nil || k.done {
+		return errExchangeState
+	}
+	k.done = true
+	if m == nil || subtle.ConstantTimeCompare(k.confirmHash(0x83), m.S) != 1 {
+		return errConfirm
+	}
+	return nil
+}
+
+// transcript returns IDA || IDB || RA || RB, the points as x || y.
+func (k *KeyExchange) transcript() []byte {
+	ida, idb := k.id, k.peer
+	if !k.initiator {
+		ida, idb = idb, ida
+	}
+	b := append(append([]byte(nil), ida...), idb...)
+	b = append(b, k.ra.Marshal()[1:]...)
+	return append(b, k.rb.Marshal()[1:]...)
+}
+
+// sharedKey returns KDF(IDA || IDB || RA || RB || g1 || g2 || g3, klen).
+func (k *KeyExchange) sharedKey() []byte {
+	z := k.transcript()
+	z = append(z, k.g1.Marshal()...)
+	z = append(z, k.g2.Marshal()...)
+	z = append(z, k.g3.Marshal()...)
+	return kdf.KDF(z, k.keyLen)
+}
+
+// confirmHash returns SM3(prefix || g1 || SM3(g2 || g3 || IDA || IDB ||
+// RA || RB)), SB for prefix 0x82 and SA for 0x83.
+func (k *KeyExchange) confirmHash(prefix byte) []byte {
+	h := sm3.New()
+	h.Write(k.g2.Marshal())
+	h.Write(k.g3.Marshal())
+	h.Write(k.transcript())
+	inner := h.Sum(nil)
+
+	h.Reset()
+	h.Write([]byte{prefix})
+	h.Write(k.g1.Marshal())
+	h.Write(inner)
+	return h.Sum(nil)
+}
+
+// Marshal returns the message as the 65-byte encoding of RA.
+func (m *ExchangeInit) Marshal() []byte { return m.R.Marshal() }
+
+// Unmarshal sets m to the encoding returned by Marshal.
+func (m *ExchangeInit) Unmarshal(b []byte) error {
+	r := new(G1)
+	if err := r.Unmarshal(b); err != nil {
+		return err
+	}
+	m.R = r
+	return nil
+}
+
+// Marshal returns the message as RB, 65 bytes, followed by SB if present.
+func (m *ExchangeResponse) Marshal() []byte {
+	return append(m.R.Marshal(), m.S...)
+}
+
+// Unmarshal sets m to the encoding returned by Marshal.
+func (m *ExchangeResponse) Unmarshal(b []byte) error {
+	if len(b) != 65 && len(b) != 65+sm3.Size {
+		return errMessage
+	}
+	r := new(G1)
+	if err := r.Unmarshal(b[:65]); err != nil {
+		return err
+	}
+	m.R, m.S = r, nil
+	if len(b) > 65 {
+		m.S = append([]byte(nil), b[65:]...)
+	}
+	return nil
+}
+
+// Marshal returns the message as the 32-byte SA.
+func (m *ExchangeConfirm) Marshal() []byte {
+	return append([]byte(nil), m.S...)
+}
+
+// Unmarshal sets m to the encoding returned by Marshal.
+func (m *ExchangeConfirm) Unmarshal(b []byte) error {
+	if len(b) != sm3.Size {
+		return errMessage
+	}
+	m.S = append([]byte(nil), b...)
+	return nil
+}
@@ -0,0 +1,205 @@
+package sm9
+
+import "math/big"
+
+// The SM9 curve is the BN curve with t = 0x600000000058F98A, so that
+// p = 36t⁴+36t³+24t²+6t+1 and Order = 36t⁴+36t³+18t²+6t+1.
+var (
+	bnT = bigFromHex("600000000058F98A")
+	p   = bigFromHex("B640000002A3A6F1D603AB4FF58EC74521F2934B1A7AEEDBE56F9B27E351457D")
+	// Order is the prime order N of G1, G2 and GT.
+	Order = bigFromHex("B640000002A3A6F1D603AB4FF58EC74449F2934B18EA8BEEE56EE19CD69ECF25")
+)
+
+func bigFromHex(s string) *big.Int {
+	b, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("opensm/sm9: internal error: invalid encoding")
+	}
+	return b
+}
+
+func fpAdd(a, b *big.Int) *big.Int {
+	r := new(big.Int).Add(a, b)
+	if r.Cmp(p) >= 0 {
+		r.Sub(r, p)
+	}
+	return r
+}
+
+func fpSub(a, b *big.Int) *big.Int {
+	r := new(big.Int).Sub(a, b)
+	if r.Sign() < 0 {
+		r.Add(r, p)
+	}
+	return r
+}
+
+func fpNeg(a *big.Int) *big.Int {
+	if a.Sign() == 0 {
+		return new(big.Int)
+	}
+	return new(big.Int).Sub(p, a)
+}
+
+func fpMul(a, b *big.Int) *big.Int {
+	r := new(big.Int).Mul(a, b)
+	return r.Mod(r, p)
+}
+
+func fpInv(a *big.Int) *big.Int {
+	return new(big.Int).ModInverse(a, p)
+}
+
+// fp2 is a0 + a1·u in Fp2 = Fp[u]/(u²+2).
+type fp2 struct {
+	a0, a1 *big.Int
+}
+
+func fp2Zero() fp2 { return fp2{new(big.Int), new(big.Int)} }
+func fp2One() fp2  { return fp2{big.NewInt(1), new(big.Int)} }
+
+func (x fp2) isZero() bool { return x.a0.Sign() == 0 && x.a1.Sign() == 0 }
+
+func (x fp2) equal(y fp2) bool { return x.a0.Cmp(y.a0) == 0 && x.a1.Cmp(y.a1) == 0 }
+
+func fp2Add(x, y fp2) fp2 { return fp2{fpAdd(x.a0, y.a0), fpAdd(x.a1, y.a1)} }
+func fp2Sub(x, y fp2) fp2 { return fp2{fpSub(x.a0, y.a0), fpSub(x.a1, y.a1)} }
+func fp2Neg(x fp2) fp2    { return fp2{fpNeg(x.a0), fpNeg(x.a1)} }
+
+// fp2Conj returns a0 - a1·u, which is also x^p.
+func fp2Conj(x fp2) fp2 { return fp2{new(big.Int).Set(x.a0), fpNeg(x.a1)} }
+
+func fp2Mul(x, y fp2) fp2 {
+	t0 := fpMul(x.a0, y.a0)
+	t1 := fpMul(x.a1, y.a1)
+	c1 := fpMul(fpAdd(x.a0, x.a1), fpAdd(y.a0, y.a1))
+	return fp2{fpSub(t0, fpAdd(t1, t1)), fpSub(c1, fpAdd(t0, t1))}
+}
+
+// fp2MulFp returns x·k for k in Fp.
+func fp2MulFp(x fp2, k *big.Int) fp2 { return fp2{fpMul(x.a0, k), fpMul(x.a1, k)} }
+
+// fp2MulU returns x·u = -2a1 + a0·u.
+func fp2MulU(x fp2) fp2 {
+	return fp2{fpNeg(fpAdd(x.a1, x.a1)), new(big.Int).Set(x.a0)}
+}
+
+func fp2Inv(x fp2) fp2 {
+	// (a0 + a1·u)(a0 - a1·u) = a0² + 2a1²
+	t := fpAdd(fpMul(x.a0, x.a0), fpMul(fpAdd(x.a1, x.a1), x.a1))
+	t = fpInv(t)
+	return fp2{fpMul(x.a0, t), fpNeg(fpMul(x.a1, t))}
+}
+
+func fp2Exp(x fp2, k *big.Int) fp2 {
+	r := fp2One()
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		r = fp2Mul(r, r)
+		if k.Bit(i) == 1 {
+			r = fp2Mul(r, x)
+		}
+	}
+	return r
+}
+
+// fp4 is b0 + b1·v in Fp4 = Fp2[v]/(v²-u).
+type fp4 struct {
+	b0, b1 fp2
+}
+
+func fp4Zero() fp4 { return fp4{fp2Zero(), fp2Zero()} }
+func fp4One() fp4  { return fp4{fp2One(), fp2Zero()} }
+
+func (x fp4) equal(y fp4) bool { return x.b0.equal(y.b0) && x.b1.equal(y.b1) }
+
+func fp4Add(x, y fp4) fp4 { return fp4{fp2Add(x.b0, y.b0), fp2Add(x.b1, y.b1)} }
+func fp4Sub(x, y fp4) fp4 { return fp4{fp2Sub(x.b0, y.b0), fp2Sub(x.b1, y.b1)} }
+
+func fp4Mul(x, y fp4) fp4 {
+	t0 := fp2Mul(x.b0, y.b0)
+	t1 := fp2Mul(x.b1, y.b1)
+	c1 := fp2Mul(fp2Add(x.b0, x.b1), fp2Add(y.b0, y.b1))
+	return fp4{fp2Add(t0, fp2MulU(t1)), fp2Sub(c1, fp2Add(t0, t1))}
+}
+
+// fp4MulV returns x·v = b1·u + b0·v.
+func fp4MulV(x fp4) fp4 { return fp4{fp2MulU(x.b1), x.b0} }
+
+func fp4Inv(x fp4) fp4 {
+	// (b0 + b1·v)(b0 - b1·v) = b0² - b1²·u
+	t := fp2Sub(fp2Mul(x.b0, x.b0), fp2MulU(fp2Mul(x.b1, x.b1)))
+	t = fp2Inv(t)
+	return fp4{fp2Mul(x.b0, t), fp2Neg(fp2Mul(x.b1, t))}
+}
+
+// fp12 is c0 + c1·w + c2·w² in Fp12 = Fp4[w]/(w³-v). As w⁶ = u, it is also
+// the sum of (ck + c(k+3)·w³)·w^k over Fp2 coefficients.
+type fp12 struct {
+	c0, c1, c2 fp4
+}
+
+func fp12One() fp12 { return fp12{fp4One(), fp4Zero(), fp4Zero()} }
+
+func (x fp12) equal(y fp12) bool {
+	return x.c0.equal(y.c0) && x.c1.equal(y.c1) && x.c2.equal(y.c2)
+}
+
+func fp12Mul(x, y fp12) fp12 {
+	t0 := fp4Mul(x.c0, y.c0)
+	t1 := fp4Mul(x.c1, y.c1)
+	t2 := fp4Mul(x.c2, y.c2)
+	// Karatsuba for the cross terms
+	m01 := fp4Sub(fp4Mul(fp4Add(x.c0, x.c1), fp4Add(y.c0, y.c1)), fp4Add(t0, t1))
+	m02 := fp4Sub(fp4Mul(fp4Add(x.c0, x.c2), fp4Add(y.c0, y.c2)), fp4Add(t0, t2))
+	m12 := fp4Sub(fp4Mul(fp4Add(x.c1, x.c2), fp4Add(y.c1, y.c2)), fp4Add(t1, t2))
+	return fp12{
+		fp4Add(t0, fp4MulV(m12)),
+		fp4Add(m01, fp4MulV(t2)),
+		fp4Add(m02, t1),
+	}
+}
+
+func fp12Inv(x fp12) fp12 {
+	a := fp4Sub(fp4Mul(x.c0, x.c0), fp4MulV(fp4Mul(x.c1, x.c2)))
+	b := fp4Sub(fp4MulV(fp4Mul(x.c2, x.c2)), fp4Mul(x.c0, x.c1))
+	c := fp4Sub(fp4Mul(x.c1, x.c1), fp4Mul(x.c0, x.c2))
+	f := fp4Add(fp4Mul(x.c0, a), fp4MulV(fp4Add(fp4Mul(x.c2, b), fp4Mul(x.c1, c))))
+	f = fp4Inv(f)
+	return fp12{fp4Mul(a, f), fp4Mul(b, f), fp4Mul(c, f)}
+}
+
+func fp12Exp(x fp12, k *big.Int) fp12 {
+	r := fp12One()
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		r = fp12Mul(r, r)
+		if k.Bit(i) == 1 {
+			r = fp12Mul(r, x)
+		}
+	}
+	return r
+}
+
+// frobGamma[k] is w^(k(p-1)) = u^(k(p-1)/6), so that (ck·w^k)^p is
+// conj(ck)·frobGamma[k]·w^k.
+var frobGamma [6]fp2
+
+func init() {
+	e := new(big.Int).Sub(p, big.NewInt(1))
+	e.Div(e, big.NewInt(6))
+	g := fp2Exp(fp2{new(big.Int), big.NewInt(1)}, e)
+	frobGamma[0] = fp2One()
+	for k := 1; k < 6; k++ {
+		frobGamma[k] = fp2Mul(frobGamma[k-1], g)
+	}
+}
+
+// fp12Frob returns x^p.
+func fp12Frob(x fp12) fp12 {
+	f := func(c fp2, k int) fp2 { return fp2Mul(fp2Conj(c), frobGamma[k]) }
+	return fp12{
+		fp4{f(x.c0.b0, 0), f(x.c0.b1, 3)},
+		fp4{f(x.c1.b0, 1), f(x.c1.b1, 4)},
+		fp4{f(x.c2.b0, 2), f(x.c2.b1, 5)},
+	}
+}
@@ -0,0 +1,139 @@
+package sm9
+
+import "math/big"
+
+var (
+	// ateLoop is 6t+2, the R-ate Miller loop count.
+	ateLoop = new(big.Int).Add(new(big.Int).Mul(bnT, big.NewInt(6)), big.NewInt(2))
+	// finalHard is (p⁴-p²+1)/N, the hard part of the final exponentiation.
+	finalHard *big.Int
+	// twistFrobX and twistFrobY map conjugated twist coordinates to those
+	// of the image of the p-power Frobenius endomorphism.
+	twistFrobX, twistFrobY fp2
+)
+
+func init() {
+	p2 := new(big.Int).Mul(p, p)
+	finalHard = new(big.Int).Mul(p2, p2)
+	finalHard.Sub(finalHard, p2)
+	finalHard.Add(finalHard, big.NewInt(1))
+	finalHard.Div(finalHard, Order)
+
+	twistFrobX = fp2Inv(frobGamma[2])
+	twistFrobY = fp2Inv(frobGamma[3])
+}
+
+// GT is an element of the order N subgroup of Fp12*, the target group of
+// the pairing.
+type GT struct {
+	f fp12
+}
+
+// Pair returns the R-ate pairing e(a, b) of GM/T 0044.
+func Pair(a *G1, b *G2) *GT {
+	if a.p.isInfinity() || b.p.isInfinity() {
+		return &GT{fp12One()}
+	}
+	return &GT{finalExp(miller(a.p.affine(), b.p.affine()))}
+}
+
+// line returns the line of slope lambda through the twist point t,
+// evaluated at the G1 point pt. With the untwisting (x, y) → (x/w², y/w³),
+// and a factor u that the final exponentiation removes, it is
+// u·y_P + (lambda·x_T - y_T)·w³ - lambda·x_P·w⁵.
+func line(t, pt *jacobian, lambda fp2) fp12 {
+	c0 := fp2{new(big.Int), pt.y.a0}
+	c3 := fp2Sub(fp2Mul(lambda, t.x), t.y)
+	c5 := fp2Neg(fp2MulFp(lambda, pt.x.a0))
+	return fp12{fp4{c0, c3}, fp4Zero(), fp4{fp2Zero(), c5}}
+}
+
+// lineDouble returns the tangent line at t evaluated at pt, and 2t.
+func lineDouble(t, pt *jacobian) (fp12, jacobian) {
+	xx := fp2Mul(t.x, t.x)
+	lambda := fp2Mul(fp2Add(fp2Add(xx, xx), xx), fp2Inv(fp2Add(t.y, t.y)))
+	l := line(t, pt, lambda)
+	x3 := fp2Sub(fp2Mul(lambda, lambda), fp2Add(t.x, t.x))
+	y3 := fp2Sub(fp2Mul(lambda, fp2Sub(t.x, x3)), t.y)
+	return l, jacobian{x3, y3, fp2One()}
+}
+
+// lineAdd returns the line through t and q evaluated at pt, and t+q.
+func lineAdd(t, q, pt *jacobian) (fp12, jacobian) {
+	lambda := fp2Mul(fp2Sub(q.y, t.y), fp2Inv(fp2Sub(q.x, t.x)))
+	l := line(t, pt, lambda)
+	x3 := fp2Sub(fp2Sub(fp2Mul(lambda, lambda), t.x), q.x)
+	y3 := fp2Sub(fp2Mul(lambda, fp2Sub(t.x, x3)), t.y)
+	return l, jacobian{x3, y3, fp2One()}
+}
+
+// twistFrob returns the image of the affine twist point q under the p-power
+// Frobenius endomorphism of E.
+func twistFrob(q *jacobian) jacobian {
+	return jacobian{fp2Mul(fp2Conj(q.x), twistFrobX), fp2Mul(fp2Conj(q.y), twistFrobY), fp2One()}
+}
+
+// miller runs the Miller loop of the R-ate pairing for the affine points pt
+// in G1 and q in G2.
+func miller(pt, q jacobian) fp12 {
+	f := fp12One()
+	t := q
+	var l fp12
+	for i := ateLoop.BitLen() - 2; i >= 0; i-- {
+		l, t = lineDouble(&t, &pt)
+		f = fp12Mul(fp12Mul(f, f), l)
+		if ateLoop.Bit(i) == 1 {
+			l, t = lineAdd(&t, &q, &pt)
+			f = fp12Mul(f, l)
+		}
+	}
+
+	q1 := twistFrob(&q)
+	q2 := twistFrob(&q1)
+	q2 = q2.neg()
+	l, t = lineAdd(&t, &q1, &pt)
+	f = fp12Mul(f, l)
+	l, _ = lineAdd(&t, &q2, &pt)
+	return fp12Mul(f, l)
+}
+
+// finalExp raises f to (p¹²-1)/N.
+func finalExp(f fp12) fp12 {
+	// easy part: f^((p⁶-1)(p²+1))
+	t := f
+	for i := 0; i < 6; i++ {
+		t = fp12Frob(t)
+	}
+	t = fp12Mul(t, fp12Inv(f))
+	t = fp12Mul(fp12Frob(fp12Frob(t)), t)
+	return fp12Exp(t, finalHard)
+}
+
+// Exp sets e to a^k and returns e.
+func (e *GT) Exp(a *GT, k *big.Int) *GT {
+	e.f = fp12Exp(a.f, k)
+	return e
+}
+
+// Mul sets e to a·b and returns e.
+func (e *GT) Mul(a, b *GT) *GT {
+	e.f = fp12Mul(a.f, b.f)
+	return e
+}
+
+// Equal reports whether e and a are equal.
+func (e *GT) Equal(a *GT) bool { return e.f.equal(a.f) }
+
+// Marshal returns the 384-byte encoding of e used by GM/T 0044, the
+// coefficients of w², w and 1 in turn, each from its highest Fp coefficient
+// down.
+func (e *GT) Marshal() []byte {
+	b := make([]byte, 0, 384)
+	for _, c := range []fp4{e.f.c2, e.f.c1, e.f.c0} {
+		b = appendFp(b, c.b1.a1)
+		b = appendFp(b, c.b1.a0)
+		b = appendFp(b, c.b0.a1)
+		b = appendFp(b, c.b0.a0)
+	}
+	return b
+}
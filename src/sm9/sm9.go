@@ -0,0 +1,186 @@
+// Package sm9 implements the SM9 identity-based cryptographic algorithms of
+// GM/T 0044-2016: the R-ate pairing on the 256-bit BN curve the standard
+// fixes, and digital signatures, key exchange, key encapsulation and
+// public-key encryption where a user's public key is their identity, such as
+// an email address, and a key generation centre holds the master keys.
+//
+// Field and curve arithmetic use math/big and do not run in constant time.
+package sm9
+
+import (
+	"errors"
+	"io"
+	"math/big"
+	"opensm/src/sm3"
+)
+
+// HIDSign is the hid byte GM/T 0044 assigns to signing keys.
+const HIDSign byte = 0x01
+
+// hashSize is hlen/8 for the 256-bit Order: 8·⌈5·log₂N/32⌉ bits.
+const hashSize = 40
+
+// hashToRange is H1 (prefix 1) or H2 (prefix 2) of GM/T 0044: the first
+// hashSize bytes of SM3(prefix || z || ct) for ct = 1, 2, reduced into
+// [1, N-1].
+func hashToRange(prefix byte, z ...[]byte) *big.Int {
+	h := sm3.New()
+	var out []byte
+	for ct := byte(1); len(out) < hashSize; ct++ {
+		h.Reset()
+		h.Write([]byte{prefix})
+		for _, b := range z {
+			h.Write(b)
+		}
+		h.Write([]byte{0, 0, 0, ct})
+		out = h.Sum(out)
+	}
+	n1 := new(big.Int).Sub(Order, big.NewInt(1))
+	k := new(big.Int).SetBytes(out[:hashSize])
+	k.Mod(k, n1)
+	return k.Add(k, big.NewInt(1))
+}
+
+// randScalar reads a uniform scalar in [1, N-1] from rand.
+func randScalar(rand io.Reader) (*big.Int, error) {
+	var b [32]byte
+	for {
+		if _, err := io.ReadFull(rand, b[:]); err != nil {
+			return nil, err
+		}
+		k := new(big.Int).SetBytes(b[:])
+		if k.Sign() > 0 && k.Cmp(Order) < 0 {
+			return k, nil
+		}
+	}
+}
+
+// inRange reports whether 1 <= k < N.
+func inRange(k *big.Int) bool {
+	return k != nil && k.Sign() > 0 && k.Cmp(Order) < 0
+}
+
+// extractScalar returns d/(H1(id || hid) + d) mod N, the multiple of the
+// generator that is a user's private key under the master key d.
+func extractScalar(d *big.Int, id []byte, hid byte) (*big.Int, error) {
+	t1 := hashToRange(1, id, []byte{hid})
+	t1.Add(t1, d)
+	t1.Mod(t1, Order)
+	if t1.Sign() == 0 {
+		return nil, errors.New("opensm/sm9: master key unusable for this identity")
+	}
+	t2 := t1.ModInverse(t1, Order)
+	t2.Mul(t2, d)
+	return t2.Mod(t2, Order), nil
+}
+
+// SignMasterPublicKey is the public signing key of a key generation
+// centre, Ppub-s = ks·P2.
+type SignMasterPublicKey struct {
+	Ppub *G2
+}
+
+// SignMasterPrivateKey is the master signing key ks of a key generation
+// centre.
+type SignMasterPrivateKey struct {
+	SignMasterPublicKey
+	D *big.Int
+}
+
+// SignPrivateKey is a user's signing key dsA = (ks/(H1(ID || hid) + ks))·P1
+// with the master public key it was issued under.
+type SignPrivateKey struct {
+	SignMasterPublicKey
+	D *G1
+}
+
+// Signature is an SM9 signature (h, S).
+type Signature struct {
+	H *big.Int
+	S *G1
+}
+
+// NewSignMasterKey returns the master signing key ks, which must be in
+// [1, N-1].
+func NewSignMasterKey(ks *big.Int) (*SignMasterPrivateKey, error) {
+	if !inRange(ks) {
+		return nil, errors.New("opensm/sm9: master key out of range")
+	}
+	d := new(big.Int).Set(ks)
+	return &SignMasterPrivateKey{SignMasterPublicKey{new(G2).ScalarBaseMult(d)}, d}, nil
+}
+
+// GenerateSignMasterKey returns a random master signing key.
+func GenerateSignMasterKey(rand io.Reader) (*SignMasterPrivateKey, error) {
+	ks, err := randScalar(rand)
+	if err != nil {
+		return nil, err
+	}
+	return NewSignMasterKey(ks)
+}
+
+// ExtractKey returns the signing key of the user with identity id, hid
+// normally being HIDSign. It fails in the negligible case that
+// H1(id || hid) + ks = 0 mod N, when the centre must choose a new master
+// key.
+func (m *SignMasterPrivateKey) ExtractKey(id []byte, hid byte) (*SignPrivateKey, error) {
+	t2, err := extractScalar(m.D, id, hid)
+	if err != nil {
+		return nil, err
+	}
+	return &SignPrivateKey{m.SignMasterPublicKey, new(G1).ScalarBaseMult(t2)}, nil
+}
+
+// Sign signs msg with the user key priv, reading the random r from rand.
+func Sign(rand io.Reader, priv *SignPrivateKey, msg []byte) (*Signature, error) {
+	g := Pair(Gen1(), priv.Ppub)
+	for {
+		r, err := randScalar(rand)
+		if err != nil {
+			return nil, err
+		}
+		w := new(GT).Exp(g, r)
+		h := hashToRange(2, msg, w.Marshal())
+		l := new(big.Int).Sub(r, h)
+		if l.Mod(l, Order).Sign() == 0 {
+			continue
+		}
+		return &Signature{h, new(G1).ScalarMult(priv.D, l)}, nil
+	}
+}
+
+// Verify reports whether sig is a signature of msg by the user with
+// identity id and hid under the master public key pub.
+func Verify(pub *SignMasterPublicKey, id []byte, hid byte, msg []byte, sig *Signature) bool {
+	if sig == nil || !inRange(sig.H) || sig.S == nil || sig.S.p.isInfinity() {
+		return false
+	}
+	t := new(GT).Exp(Pair(Gen1(), pub.Ppub), sig.H)
+	h1 := hashToRange(1, id, []byte{hid})
+	q := new(G2).ScalarBaseMult(h1)
+	q.Add(q, pub.Ppub)
+	w := new(GT).Mul(Pair(sig.S, q), t)
+	return hashToRange(2, msg, w.Marshal()).Cmp(sig.H) == 0
+}
+
+// Marshal returns the signature as h || S, 32 and 65 bytes.
+func (sig *Signature) Marshal() []byte {
+	return append(appendFp(nil, sig.H), sig.S.Marshal()...)
+}
+
+// Unmarshal sets sig to the encoding returned by Marshal.
+func (sig *Signature) Unmarshal(b []byte) error {
+	if len(b) != 32+65 {
+		return errors.New("opensm/sm9: invalid signature encoding")
+	}
+	h := new(big.Int).SetBytes(b[:32])
+	if !inRange(h) {
+		return errors.New("opensm/sm9: invalid signature encoding")
+	}
+	s := new(G1)
+	if err := s.Unmarshal(b[32:]); err != nil {
+		return err
+	}
+	sig.H, sig.S = h, s
+	return nil
+}
@@ -0,0 +1,384 @@
+// Package stream implements online authenticated encryption of long
+// messages with the STREAM construction over SM4-GCM.
+//
+// The plaintext is split into segments of a fixed size, each sealed on its
+// own under a nonce made of a per-message prefix, the segment number and a
+// flag marking the last segment. Segments can therefore be produced and
+// checked one at a time, and truncation, reordering and appended data all
+// fail authentication.
+//
+// A message starts with a header holding a format version, the segment
+// size, a random salt and the nonce prefix. The SM4 key of the message is
+// derived from the caller's key with HKDF-SM3 over the salt, binding the
+// header and the additional data, so that one key can encrypt any number
+// of messages.
+package stream
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"opensm/src/kdf"
+	"opensm/src/sm4"
+)
+
+const (
+	// DefaultSegmentSize is the plaintext segment size of NewEncryptWriter.
+	DefaultSegmentSize = 64 << 10
+	// MaxSegmentSize bounds the segment size, and so the memory a reader
+	// allocates for a header it has not authenticated yet.
+	MaxSegmentSize = 16 << 20
+	// MinKeySize is the shortest key accepted.
+	MinKeySize = 16
+)
+
+const (
+	version    = 1
+	saltSize   = 16
+	prefixSize = 7
+	headerSize = 1 + 4 + saltSize + prefixSize
+	tagSize    = 16
+	nonceSize  = 12
+	// maxSegments is the number of distinct segment numbers.
+	maxSegments = math.MaxUint32 + 1
+)
+
+var (
+	// ErrHeader is returned for a missing or malformed message header.
+	ErrHeader = errors.New("opensm/stream: invalid header")
+	// ErrAuth is returned when a segment fails authentication, whether
+	// from a wrong key or additional data, modification, truncation,
+	// reordering or appended data.
+	ErrAuth = errors.New("opensm/stream: message authentication failed")
+	// ErrTooLarge is returned when a message would need more than 2^32
+	// segments.
+	ErrTooLarge = errors.New("opensm/stream: message too large")
+	// ErrClosed is returned by Write after Close.
+	ErrClosed = errors.New("opensm/stream: write after close")
+)
+
+// segmenter holds the message AEAD and builds segment nonces.
+type segmenter struct {
+	aead    cipher.AEAD
+	prefix  [prefixSize]byte
+	segSize int
+}
+
+func newSegmenter(header, key, additionalData []byte) (*segmenter, error) {
+	if len(key) < MinKeySize {
+		return nil, errors.New("opensm/stream: key shorter than 16 bytes")
+	}
+	if len(header) != headerSize || header[0] != version {
+		return nil, ErrHeader
+	}
+	segSize := binary.BigEndian.Uint32(header[1:5])
+	if segSize == 0 || segSize > MaxSegmentSize {
+		return nil, ErrHeader
+	}
+
+	salt := header[5 : 5+saltSize]
+	info := append(append([]byte(nil), header...), additionalData...)
+	var k [sm4.KeySize]byte
+	if _, err := io.ReadFull(kdf.HKDF(key, salt, info), k[:]); err != nil {
+		return nil, err
+	}
+	b, _ := sm4.NewCipher(k[:])
+	clear(k[:])
+	aead, err := cipher.NewGCM(b)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &segmenter{aead: aead, segSize: int(segSize)}
+	copy(s.prefix[:], header[5+saltSize:])
+	return s, nil
+}
+
+// nonce returns prefix || BE32(i) || last.
+func (s *segmenter) nonce(i uint64, last bool) [nonceSize]byte {
+	var n [nonceSize]byte
+	copy(n[:], s.prefix[:])
+	binary.BigEndian.PutUint32(n[prefixSize:], uint32(i))
+	if last {
+		n[nonceSize-1] = 1
+	}
+	return n
+}
+
+func (s *segmenter) open(seg []byte, i uint64, last bool) ([]byte, error) {
+	if len(seg) < tagSize {
+		return nil, ErrAuth
+	}
+	n := s.nonce(i, last)
+	p, err := s.aead.Open(seg[:0], n[:], seg, nil)
+	if err != nil {
+		return nil, ErrAuth
+	}
+	return p, nil
+}
+
+type encryptWriter struct {
+	w       io.Writer
+	s       *segmenter
+	buf     []byte
+	counter uint64
+	err     error
+}
+
+// NewEncryptWriter writes the header to w and returns a writer that encrypts
+// into w in segments of DefaultSegmentSize bytes. Close must be called to
+// write the last segment; it does not close w.
+func NewEncryptWriter(w io.Writer, key, additionalData []byte) (io.WriteCloser, error) {
+	return NewEncryptWriterSize(w, key, additionalData, DefaultSegmentSize)
+}
+
+// NewEncryptWriterSize is NewEncryptWriter with segments of segmentSize
+// plaintext bytes, from 1 to MaxSegmentSize. Each segment adds a 16-byte
+// tag.
+func NewEncryptWriterSize(w io.Writer, key, additionalData []byte, segmentSize int) (io.WriteCloser, error) {
+	if segmentSize <= 0 || segmentSize > MaxSegmentSize {
+		return nil, errors.New("opensm/stream: invalid segment size")
+	}
+
+	header := make([]byte, headerSize)
+	header[0] = version
+	binary.BigEndian.PutUint32(header[1:], uint32(segmentSize))
+	if _, err := io.ReadFull(rand.Reader, header[5:]); err != nil {
+		return nil, err
+	}
+	s, err := newSegmenter(header, key, additionalData)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{w: w, s: s, buf: make([]byte, 0, segmentSize+tagSize)}, nil
+}
+
+// Write buffers a full segment until more data follows, since only then is
+// it known not to be the last.
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if e.err != nil {
+			return written, e.err
+		}
+		if len(e.buf) == e.s.segSize {
+			e.err = e.flush(false)
+			continue
+		}
+		n := copy(e.buf[len(e.buf):e.s.segSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (e *encryptWriter) flush(last bool) error {
+	if !last && e.counter == maxSegments-1 {
+		return ErrTooLarge
+	}
+	n := e.s.nonce(e.counter, last)
+	out := e.s.aead.Seal(e.buf[:0], n[:], e.buf, nil)
+	e.buf = e.buf[:0]
+	e.counter++
+	_, err := e.w.Write(out)
+	return err
+}
+
+// Close seals and writes the last segment, which is empty only for an empty
+// message.
+func (e *encryptWriter) Close() error {
+	if e.err != nil {
+		if e.err == ErrClosed {
+			return nil
+		}
+		return e.err
+	}
+	if err := e.flush(true); err != nil {
+		e.err = err
+		return err
+	}
+	e.err = ErrClosed
+	return nil
+}
+
+type decryptReader struct {
+	r        io.Reader
+	s        *segmenter
+	buf      []byte
+	plain    []byte
+	counter  uint64
+	carry    byte
+	hasCarry bool
+	err      error
+}
+
+// NewDecryptReader reads the header from r and returns a reader of the
+// plaintext. Each segment is authenticated before any of it is returned, and
+// the reader reports io.EOF only after the last segment.
+func NewDecryptReader(r io.Reader, key, additionalData []byte) (io.Reader, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrHeader
+		}
+		return nil, err
+	}
+	s, err := newSegmenter(header, key, additionalData)
+	if err != nil {
+		return nil, err
+	}
+
+	// one byte beyond a full segment tells whether it is the last
+	return &decryptReader{r: r, s: s, buf: make([]byte, 0, s.segSize+tagSize+1)}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.err = d.next()
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// next reads and opens the following segment into plain, returning io.EOF
+// once the last one has been read.
+func (d *decryptReader) next() error {
+	segCT := d.s.segSize + tagSize
+	d.buf = d.buf[:0]
+	if d.hasCarry {
+		d.buf = append(d.buf, d.carry)
+	}
+	n, err := io.ReadFull(d.r, d.buf[len(d.buf):segCT+1])
+	d.buf = d.buf[:len(d.buf)+n]
+	last := false
+	switch err {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		last = true
+	default:
+		return err
+	}
+
+	seg := d.buf
+	if !last {
+		if d.counter == maxSegments-1 {
+			return ErrAuth
+		}
+		seg = d.buf[:segCT]
+		d.carry, d.hasCarry = d.buf[segCT], true
+	}
+	plain, err := d.s.open(seg, d.counter, last)
+	if err != nil {
+		return err
+	}
+	d.counter++
+	d.plain = plain
+	if last {
+		return io.EOF
+	}
+	return nil
+}
+
+// ReaderAt decrypts a message stored in an io.ReaderAt, opening only the
+// segments a read touches. It is safe for concurrent use.
+type ReaderAt struct {
+	r        io.ReaderAt
+	s        *segmenter
+	segments int64
+	lastLen  int
+	size     int64
+}
+
+// NewDecryptReaderAt returns a ReaderAt of the plaintext of the size-byte
+// message in r. The last segment is opened up front, so that a truncated
+// message is rejected and Size can be trusted.
+func NewDecryptReaderAt(r io.ReaderAt, size int64, key, additionalData []byte) (*ReaderAt, error) {
+	header := make([]byte, headerSize)
+	if size < headerSize {
+		return nil, ErrHeader
+	}
+	if n, err := r.ReadAt(header, 0); n < headerSize {
+		return nil, err
+	}
+	s, err := newSegmenter(header, key, additionalData)
+	if err != nil {
+		return nil, err
+	}
+
+	segCT := int64(s.segSize + tagSize)
+	body := size - headerSize
+	ra := &ReaderAt{r: r, s: s, segments: (body + segCT - 1) / segCT}
+	if ra.segments == 0 || ra.segments > maxSegments {
+		return nil, ErrAuth
+	}
+	ra.lastLen = int(body - (ra.segments-1)*segCT)
+	ra.size = body - ra.segments*tagSize
+	if ra.lastLen < tagSize {
+		return nil, ErrAuth
+	}
+
+	if _, err := ra.segment(make([]byte, segCT), ra.segments-1); err != nil {
+		return nil, err
+	}
+	return ra, nil
+}
+
+// Size returns the plaintext length.
+func (ra *ReaderAt) Size() int64 {
+	return ra.size
+}
+
+// segment reads and opens segment i into buf.
+func (ra *ReaderAt) segment(buf []byte, i int64) ([]byte, error) {
+	segCT := int64(ra.s.segSize + tagSize)
+	last := i == ra.segments-1
+	n := int(segCT)
+	if last {
+		n = ra.lastLen
+	}
+	if m, err := ra.r.ReadAt(buf[:n], headerSize+i*segCT); m < n {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return ra.s.open(buf[:n], uint64(i), last)
+}
+
+func (ra *ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("opensm/stream: negative offset")
+	}
+
+	var buf []byte
+	n := 0
+	for n < len(p) && off < ra.size {
+		if buf == nil {
+			buf = make([]byte, ra.s.segSize+tagSize)
+		}
+		i := off / int64(ra.s.segSize)
+		plain, err := ra.segment(buf, i)
+		if err != nil {
+			return n, err
+		}
+		k := copy(p[n:], plain[off-i*int64(ra.s.segSize):])
+		n += k
+		off += int64(k)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
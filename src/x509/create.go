@@ -0,0 +1,236 @@
+package x509
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"net"
+	"opensm/src/sm2"
+	"opensm/src/sm3"
+)
+
+// CreateCertificate returns a DER certificate for pub based on template,
+// issued by parent and signed with its key priv. For a self-signed
+// certificate parent is template and pub is &priv.PublicKey.
+//
+// The issuer and authority key identifier are taken from parent. A CA
+// certificate without a SubjectKeyId gets one made of the first 20 bytes of
+// the SM3 hash of the public key.
+func CreateCertificate(rand io.Reader, template, parent *Certificate, pub *sm2.PublicKey, priv *sm2.PrivateKey) ([]byte, error) {
+	if template.SerialNumber == nil || template.SerialNumber.Sign() <= 0 {
+		return nil, errors.New("opensm/x509: template needs a positive serial number")
+	}
+	if priv == nil || priv.AffinePoint == nil {
+		return nil, errUnsupportedKey
+	}
+	ki, err := marshalPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	if parent.PublicKey != nil && (parent.PublicKey.X.Cmp(priv.X) != 0 || parent.PublicKey.Y.Cmp(priv.Y) != 0) {
+		return nil, errors.New("opensm/x509: private key does not match the parent's public key")
+	}
+
+	subject, err := rawName(template.RawSubject, template.Subject)
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := rawName(parent.RawSubject, parent.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	t := *template
+	if !bytes.Equal(issuer, subject) && len(parent.SubjectKeyId) > 0 {
+		t.AuthorityKeyId = parent.SubjectKeyId
+	}
+	if len(t.SubjectKeyId) == 0 && t.IsCA {
+		h := sm3.New()
+		h.Write(ki.PublicKey.Bytes)
+		t.SubjectKeyId = h.Sum(nil)[:20]
+	}
+	exts, err := buildExtensions(&t)
+	if err != nil {
+		return nil, err
+	}
+
+	alg := pkix.AlgorithmIdentifier{Algorithm: OIDSignatureSM2WithSM3}
+	tbs := tbsCertificate{
+		Version:            2,
+		SerialNumber:       template.SerialNumber,
+		SignatureAlgorithm: alg,
+		Issuer:             asn1.RawValue{FullBytes: issuer},
+		Validity:           validity{template.NotBefore.UTC(), template.NotAfter.UTC()},
+		Subject:            asn1.RawValue{FullBytes: subject},
+		PublicKey:          ki,
+		Extensions:         exts,
+	}
+	tbsDER, err := asn1.Marshal(tbs)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := sign(rand, priv, tbsDER)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(certificate{
+		TBSCertificate:     tbsCertificate{Raw: tbsDER},
+		SignatureAlgorithm: alg,
+		SignatureValue:     asn1.BitString{Bytes: sig, BitLength: 8 * len(sig)},
+	})
+}
+
+// CreateCertificateRequest returns a DER PKCS #10 request for the subject,
+// names and extra extensions of template, signed with priv.
+func CreateCertificateRequest(rand io.Reader, template *CertificateRequest, priv *sm2.PrivateKey) ([]byte, error) {
+	if priv == nil || priv.AffinePoint == nil {
+		return nil, errUnsupportedKey
+	}
+	ki, err := marshalPublicKey(&priv.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	subject, err := rawName(template.RawSubject, template.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	var exts []pkix.Extension
+	if len(template.DNSNames) > 0 || len(template.EmailAddresses) > 0 || len(template.IPAddresses) > 0 {
+		san, err := marshalSANs(template.DNSNames, template.EmailAddresses, template.IPAddresses)
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, pkix.Extension{Id: oidExtensionSubjectAltName, Value: san})
+	}
+	exts = append(exts, template.ExtraExtensions...)
+
+	attrs := []asn1.RawValue{}
+	if len(exts) > 0 {
+		v, err := asn1.Marshal(exts)
+		if err != nil {
+			return nil, err
+		}
+		a, err := asn1.Marshal(attribute{oidExtensionRequest, []asn1.RawValue{{FullBytes: v}}})
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, asn1.RawValue{FullBytes: a})
+	}
+
+	tbsDER, err := asn1.Marshal(tbsCertificateRequest{
+		Subject:       asn1.RawValue{FullBytes: subject},
+		PublicKey:     ki,
+		RawAttributes: attrs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sig, err := sign(rand, priv, tbsDER)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(certificateRequest{
+		TBSCSR:             tbsCertificateRequest{Raw: tbsDER},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: OIDSignatureSM2WithSM3},
+		SignatureValue:     asn1.BitString{Bytes: sig, BitLength: 8 * len(sig)},
+	})
+}
+
+// rawName returns raw if set and otherwise the DER encoding of name.
+func rawName(raw []byte, name pkix.Name) ([]byte, error) {
+	if len(raw) > 0 {
+		return raw, nil
+	}
+	return asn1.Marshal(name.ToRDNSequence())
+}
+
+// buildExtensions returns the extensions for the fields of t, followed by
+// t.ExtraExtensions. Key usage and basic constraints are marked critical.
+func buildExtensions(t *Certificate) ([]pkix.Extension, error) {
+	var exts []pkix.Extension
+	add := func(id asn1.ObjectIdentifier, critical bool, v any) error {
+		b, err := asn1.Marshal(v)
+		if err != nil {
+			return err
+		}
+		exts = append(exts, pkix.Extension{Id: id, Critical: critical, Value: b})
+		return nil
+	}
+
+	if t.KeyUsage != 0 {
+		var b [2]byte
+		n := 0
+		for i := 0; i < 9; i++ {
+			if t.KeyUsage&(1<<i) != 0 {
+				b[i/8] |= 0x80 >> (i % 8)
+				n = i + 1
+			}
+		}
+		if err := add(oidExtensionKeyUsage, true, asn1.BitString{Bytes: b[:(n+7)/8], BitLength: n}); err != nil {
+			return nil, err
+		}
+	}
+	if len(t.ExtKeyUsage) > 0 || len(t.UnknownExtKeyUsage) > 0 {
+		var oids []asn1.ObjectIdentifier
+		for _, u := range t.ExtKeyUsage {
+			if u < 0 || int(u) >= len(extKeyUsageOIDs) {
+				return nil, errors.New("opensm/x509: unknown extended key usage")
+			}
+			oids = append(oids, extKeyUsageOIDs[u])
+		}
+		oids = append(oids, t.UnknownExtKeyUsage...)
+		if err := add(oidExtensionExtendedKeyUsage, false, oids); err != nil {
+			return nil, err
+		}
+	}
+	if t.BasicConstraintsValid {
+		maxPathLen := t.MaxPathLen
+		if maxPathLen == 0 && !t.MaxPathLenZero {
+			maxPathLen = -1
+		}
+		if err := add(oidExtensionBasicConstraints, true, basicConstraints{t.IsCA, maxPathLen}); err != nil {
+			return nil, err
+		}
+	}
+	if len(t.SubjectKeyId) > 0 {
+		if err := add(oidExtensionSubjectKeyId, false, t.SubjectKeyId); err != nil {
+			return nil, err
+		}
+	}
+	if len(t.AuthorityKeyId) > 0 {
+		if err := add(oidExtensionAuthorityKeyId, false, authKeyId{t.AuthorityKeyId}); err != nil {
+			return nil, err
+		}
+	}
+	if len(t.DNSNames) > 0 || len(t.EmailAddresses) > 0 || len(t.IPAddresses) > 0 {
+		san, err := marshalSANs(t.DNSNames, t.EmailAddresses, t.IPAddresses)
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, pkix.Extension{Id: oidExtensionSubjectAltName, Value: san})
+	}
+	return append(exts, t.ExtraExtensions...), nil
+}
+
+func marshalSANs(dns, emails []string, ips []net.IP) ([]byte, error) {
+	var names []asn1.RawValue
+	for _, name := range dns {
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte(name)})
+	}
+	for _, email := range emails {
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, Bytes: []byte(email)})
+	}
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		if len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+			return nil, errors.New("opensm/x509: invalid IP address")
+		}
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 7, Bytes: ip})
+	}
+	return asn1.Marshal(names)
+}
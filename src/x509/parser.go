@@ -0,0 +1,231 @@
+package x509
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"net"
+)
+
+// ParseCertificate parses a DER certificate with an SM2 subject public key.
+func ParseCertificate(der []byte) (*Certificate, error) {
+	var cert certificate
+	rest, err := asn1.Unmarshal(der, &cert)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("opensm/x509: trailing data after certificate")
+	}
+	tbs := &cert.TBSCertificate
+	if !tbs.SignatureAlgorithm.Algorithm.Equal(cert.SignatureAlgorithm.Algorithm) {
+		return nil, errors.New("opensm/x509: inner and outer signature algorithms differ")
+	}
+	if tbs.Version < 0 || tbs.Version > 2 {
+		return nil, errors.New("opensm/x509: invalid certificate version")
+	}
+	if tbs.SerialNumber == nil {
+		return nil, errors.New("opensm/x509: missing serial number")
+	}
+
+	c := &Certificate{
+		Raw:                     der,
+		RawTBSCertificate:       tbs.Raw,
+		RawSubjectPublicKeyInfo: tbs.PublicKey.Raw,
+		RawSubject:              tbs.Subject.FullBytes,
+		RawIssuer:               tbs.Issuer.FullBytes,
+		Signature:               cert.SignatureValue.RightAlign(),
+		SignatureAlgorithm:      cert.SignatureAlgorithm.Algorithm,
+		Version:                 tbs.Version + 1,
+		SerialNumber:            tbs.SerialNumber,
+		NotBefore:               tbs.Validity.NotBefore,
+		NotAfter:                tbs.Validity.NotAfter,
+		Extensions:              tbs.Extensions,
+		MaxPathLen:              -1,
+	}
+	if c.PublicKey, err = parsePublicKey(&tbs.PublicKey); err != nil {
+		return nil, err
+	}
+	if err := parseName(c.RawIssuer, &c.Issuer); err != nil {
+		return nil, err
+	}
+	if err := parseName(c.RawSubject, &c.Subject); err != nil {
+		return nil, err
+	}
+
+	for _, e := range c.Extensions {
+		handled, err := c.parseExtension(e)
+		if err != nil {
+			return nil, err
+		}
+		if e.Critical && !handled {
+			c.UnhandledCriticalExtensions = append(c.UnhandledCriticalExtensions, e.Id)
+		}
+	}
+	return c, nil
+}
+
+// parseExtension sets the fields of c that e carries, reporting whether e
+// is one this package processes.
+func (c *Certificate) parseExtension(e pkix.Extension) (bool, error) {
+	switch {
+	case e.Id.Equal(oidExtensionKeyUsage):
+		var bits asn1.BitString
+		if err := unmarshalExtension(e, &bits); err != nil {
+			return false, err
+		}
+		for i := 0; i < 9; i++ {
+			if bits.At(i) != 0 {
+				c.KeyUsage |= 1 << i
+			}
+		}
+	case e.Id.Equal(oidExtensionBasicConstraints):
+		var bc basicConstraints
+		if err := unmarshalExtension(e, &bc); err != nil {
+			return false, err
+		}
+		c.BasicConstraintsValid = true
+		c.IsCA = bc.IsCA
+		c.MaxPathLen = bc.MaxPathLen
+		c.MaxPathLenZero = bc.MaxPathLen == 0
+	case e.Id.Equal(oidExtensionSubjectKeyId):
+		if err := unmarshalExtension(e, &c.SubjectKeyId); err != nil {
+			return false, err
+		}
+	case e.Id.Equal(oidExtensionAuthorityKeyId):
+		var aki authKeyId
+		if err := unmarshalExtension(e, &aki); err != nil {
+			return false, err
+		}
+		c.AuthorityKeyId = aki.Id
+	case e.Id.Equal(oidExtensionExtendedKeyUsage):
+		var oids []asn1.ObjectIdentifier
+		if err := unmarshalExtension(e, &oids); err != nil {
+			return false, err
+		}
+	next:
+		for _, oid := range oids {
+			for u, known := range extKeyUsageOIDs {
+				if oid.Equal(known) {
+					c.ExtKeyUsage = append(c.ExtKeyUsage, ExtKeyUsage(u))
+					continue next
+				}
+			}
+			c.UnknownExtKeyUsage = append(c.UnknownExtKeyUsage, oid)
+		}
+	case e.Id.Equal(oidExtensionSubjectAltName):
+		var err error
+		c.DNSNames, c.EmailAddresses, c.IPAddresses, err = parseSANs(e.Value)
+		if err != nil {
+			return false, err
+		}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// ParseCertificateRequest parses a DER PKCS #10 request with an SM2 public
+// key.
+func ParseCertificateRequest(der []byte) (*CertificateRequest, error) {
+	var csr certificateRequest
+	rest, err := asn1.Unmarshal(der, &csr)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("opensm/x509: trailing data after certificate request")
+	}
+	tbs := &csr.TBSCSR
+
+	r := &CertificateRequest{
+		Raw:                      der,
+		RawTBSCertificateRequest: tbs.Raw,
+		RawSubjectPublicKeyInfo:  tbs.PublicKey.Raw,
+		RawSubject:               tbs.Subject.FullBytes,
+		Signature:                csr.SignatureValue.RightAlign(),
+		SignatureAlgorithm:       csr.SignatureAlgorithm.Algorithm,
+		Version:                  tbs.Version,
+	}
+	if r.PublicKey, err = parsePublicKey(&tbs.PublicKey); err != nil {
+		return nil, err
+	}
+	if err := parseName(r.RawSubject, &r.Subject); err != nil {
+		return nil, err
+	}
+
+	for _, raw := range tbs.RawAttributes {
+		var attr attribute
+		if rest, err := asn1.Unmarshal(raw.FullBytes, &attr); err != nil || len(rest) != 0 {
+			return nil, errors.New("opensm/x509: invalid certificate request attribute")
+		}
+		if !attr.Type.Equal(oidExtensionRequest) {
+			continue
+		}
+		for _, v := range attr.Values {
+			var exts []pkix.Extension
+			if rest, err := asn1.Unmarshal(v.FullBytes, &exts); err != nil || len(rest) != 0 {
+				return nil, errors.New("opensm/x509: invalid extension request")
+			}
+			r.Extensions = append(r.Extensions, exts...)
+		}
+	}
+	for _, e := range r.Extensions {
+		if e.Id.Equal(oidExtensionSubjectAltName) {
+			if r.DNSNames, r.EmailAddresses, r.IPAddresses, err = parseSANs(e.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return r, nil
+}
+
+func parseName(der []byte, name *pkix.Name) error {
+	var rdn pkix.RDNSequence
+	if rest, err := asn1.Unmarshal(der, &rdn); err != nil {
+		return err
+	} else if len(rest) != 0 {
+		return errors.New("opensm/x509: trailing data after name")
+	}
+	name.FillFromRDNSequence(&rdn)
+	return nil
+}
+
+func unmarshalExtension(e pkix.Extension, v any) error {
+	rest, err := asn1.Unmarshal(e.Value, v)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errors.New("opensm/x509: trailing data in extension " + e.Id.String())
+	}
+	return nil
+}
+
+// parseSANs returns the DNS names, email addresses and IP addresses of a
+// subject alternative name extension, skipping other kinds of name.
+func parseSANs(der []byte) (dns, emails []string, ips []net.IP, err error) {
+	var names []asn1.RawValue
+	if rest, err := asn1.Unmarshal(der, &names); err != nil {
+		return nil, nil, nil, err
+	} else if len(rest) != 0 {
+		return nil, nil, nil, errors.New("opensm/x509: trailing data after subject alternative names")
+	}
+	for _, n := range names {
+		if n.Class != asn1.ClassContextSpecific {
+			return nil, nil, nil, errors.New("opensm/x509: invalid subject alternative name")
+		}
+		switch n.Tag {
+		case 1:
+			emails = append(emails, string(n.Bytes))
+		case 2:
+			dns = append(dns, string(n.Bytes))
+		case 7:
+			if len(n.Bytes) != net.IPv4len && len(n.Bytes) != net.IPv6len {
+				return nil, nil, nil, errors.New("opensm/x509: invalid IP address in subject alternative name")
+			}
+			ips = append(ips, net.IP(n.Bytes))
+		}
+	}
+	return dns, emails, ips, nil
+}
@@ -0,0 +1,66 @@
+package x509
+
+import (
+	"bytes"
+	"errors"
+)
+
+// CheckProfile returns an error describing the first way c departs from
+// the GM/T 0015 certificate profile, or nil. It checks that
+//
+//   - c is a version 3 certificate signed with SM2-with-SM3,
+//   - the serial number is positive and at most 20 bytes long,
+//   - the issuer and subject are not empty and the validity period is not
+//     reversed,
+//   - a key usage extension is present,
+//   - certificates not self-issued name their authority key identifier, and
+//   - CA certificates have critical basic constraints, a subject key
+//     identifier and the certificate signing key usage.
+//
+// Verify runs these checks on every certificate of a chain if asked to.
+func (c *Certificate) CheckProfile() error {
+	if c.Version != 3 {
+		return errors.New("opensm/x509: GM/T 0015: certificate is not version 3")
+	}
+	if !c.SignatureAlgorithm.Equal(OIDSignatureSM2WithSM3) {
+		return errors.New("opensm/x509: GM/T 0015: signature algorithm is not SM2-with-SM3")
+	}
+	if c.SerialNumber == nil || c.SerialNumber.Sign() <= 0 || len(c.SerialNumber.Bytes()) > 20 {
+		return errors.New("opensm/x509: GM/T 0015: serial number is not a positive integer of at most 20 bytes")
+	}
+	if len(c.Issuer.Names) == 0 || len(c.Subject.Names) == 0 {
+		return errors.New("opensm/x509: GM/T 0015: empty issuer or subject")
+	}
+	if c.NotAfter.Before(c.NotBefore) {
+		return errors.New("opensm/x509: GM/T 0015: validity period ends before it starts")
+	}
+	if c.KeyUsage == 0 {
+		return errors.New("opensm/x509: GM/T 0015: missing key usage")
+	}
+	if len(c.AuthorityKeyId) == 0 && !bytes.Equal(c.RawIssuer, c.RawSubject) {
+		return errors.New("opensm/x509: GM/T 0015: missing authority key identifier")
+	}
+
+	if !c.IsCA {
+		return nil
+	}
+	if !c.BasicConstraintsValid || !c.basicConstraintsCritical() {
+		return errors.New("opensm/x509: GM/T 0015: CA basic constraints are not critical")
+	}
+	if len(c.SubjectKeyId) == 0 {
+		return errors.New("opensm/x509: GM/T 0015: CA certificate has no subject key identifier")
+	}
+	if c.KeyUsage&KeyUsageCertSign == 0 {
+		return errors.New("opensm/x509: GM/T 0015: CA key usage does not allow certificate signing")
+	}
+	return nil
+}
+
+func (c *Certificate) basicConstraintsCritical() bool {
+	for _, e := range c.Extensions {
+		if e.Id.Equal(oidExtensionBasicConstraints) {
+			return e.Critical
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package x509
+
+import (
+	"bytes"
+	"errors"
+	"opensm/src/sm2"
+	"time"
+)
+
+// maxChainLength bounds the certificates in a chain Verify builds.
+const maxChainLength = 10
+
+// VerifyOptions are the trust anchors and settings for Verify.
+type VerifyOptions struct {
+	Roots         []*Certificate
+	Intermediates []*Certificate
+	// CurrentTime is the time to check validity at, the zero time meaning
+	// now.
+	CurrentTime time.Time
+	// CheckProfile also requires every certificate in the chain to pass
+	// CheckProfile.
+	CheckProfile bool
+	// UID is the signer ID the chain's signatures are checked with, nil
+	// meaning sm2.DefaultUID. Certificates OpenSSL 3 issues without a
+	// distid option need the empty ID, []byte{}.
+	UID []byte
+}
+
+func (opts *VerifyOptions) uid() []byte {
+	if opts.UID == nil {
+		return sm2.DefaultUID
+	}
+	return opts.UID
+}
+
+// CheckSignature verifies signature, a DER SM2-with-SM3 signature, of
+// signed by the public key of c.
+func (c *Certificate) CheckSignature(signed, signature []byte) error {
+	return checkSignature(c.PublicKey, sm2.DefaultUID, OIDSignatureSM2WithSM3, signed, signature)
+}
+
+// CheckSignatureFrom verifies that c is signed by parent, which must be
+// allowed to issue certificates, with sm2.DefaultUID.
+func (c *Certificate) CheckSignatureFrom(parent *Certificate) error {
+	return c.checkSignatureFrom(parent, sm2.DefaultUID)
+}
+
+func (c *Certificate) checkSignatureFrom(parent *Certificate, uid []byte) error {
+	if parent.Version == 3 && !parent.BasicConstraintsValid || parent.BasicConstraintsValid && !parent.IsCA {
+		return errors.New("opensm/x509: parent certificate is not a CA")
+	}
+	if parent.KeyUsage != 0 && parent.KeyUsage&KeyUsageCertSign == 0 {
+		return errors.New("opensm/x509: parent certificate may not sign certificates")
+	}
+	return checkSignature(parent.PublicKey, uid, c.SignatureAlgorithm, c.RawTBSCertificate, c.Signature)
+}
+
+// CheckSignature verifies the signature of the request with its own key.
+func (r *CertificateRequest) CheckSignature() error {
+	return checkSignature(r.PublicKey, sm2.DefaultUID, r.SignatureAlgorithm, r.RawTBSCertificateRequest, r.Signature)
+}
+
+// Verify builds a chain from c through opts.Intermediates to one of
+// opts.Roots, checking signatures, validity periods, CA constraints and
+// path lengths, and returns it starting with c.
+func (c *Certificate) Verify(opts VerifyOptions) ([]*Certificate, error) {
+	now := opts.CurrentTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if err := c.isValid(now, &opts); err != nil {
+		return nil, err
+	}
+	for _, root := range opts.Roots {
+		if bytes.Equal(c.Raw, root.Raw) {
+			return []*Certificate{c}, nil
+		}
+	}
+	return buildChain([]*Certificate{c}, now, &opts)
+}
+
+func (c *Certificate) isValid(now time.Time, opts *VerifyOptions) error {
+	if now.Before(c.NotBefore) || now.After(c.NotAfter) {
+		return errors.New("opensm/x509: certificate has expired or is not yet valid")
+	}
+	if len(c.UnhandledCriticalExtensions) > 0 {
+		return errors.New("opensm/x509: unhandled critical extension " + c.UnhandledCriticalExtensions[0].String())
+	}
+	if opts.CheckProfile {
+		return c.CheckProfile()
+	}
+	return nil
+}
+
+// buildChain extends chain, whose certificates are checked, up to a root,
+// trying issuers depth first.
+func buildChain(chain []*Certificate, now time.Time, opts *VerifyOptions) ([]*Certificate, error) {
+	err := errors.New("opensm/x509: certificate signed by unknown authority")
+	for _, root := range opts.Roots {
+		if e := checkIssuer(chain, root, now, opts); e != nil {
+			err = e
+			continue
+		}
+		return append(chain, root), nil
+	}
+	if len(chain) >= maxChainLength-1 {
+		return nil, err
+	}
+next:
+	for _, inter := range opts.Intermediates {
+		for _, c := range chain {
+			if c == inter || bytes.Equal(c.Raw, inter.Raw) {
+				continue next
+			}
+		}
+		if e := checkIssuer(chain, inter, now, opts); e != nil {
+			err = e
+			continue
+		}
+		full, e := buildChain(append(chain[:len(chain):len(chain)], inter), now, opts)
+		if e == nil {
+			return full, nil
+		}
+		err = e
+	}
+	return nil, err
+}
+
+// checkIssuer reports why issuer cannot sign the last certificate of chain.
+func checkIssuer(chain []*Certificate, issuer *Certificate, now time.Time, opts *VerifyOptions) error {
+	cur := chain[len(chain)-1]
+	if !bytes.Equal(cur.RawIssuer, issuer.RawSubject) {
+		return errors.New("opensm/x509: certificate signed by unknown authority")
+	}
+	if len(cur.AuthorityKeyId) > 0 && len(issuer.SubjectKeyId) > 0 && !bytes.Equal(cur.AuthorityKeyId, issuer.SubjectKeyId) {
+		return errors.New("opensm/x509: certificate signed by unknown authority")
+	}
+	if err := cur.checkSignatureFrom(issuer, opts.uid()); err != nil {
+		return err
+	}
+	if err := issuer.isValid(now, opts); err != nil {
+		return err
+	}
+	// the CAs between issuer and the leaf
+	if below := len(chain) - 1; issuer.BasicConstraintsValid && (issuer.MaxPathLen > 0 || issuer.MaxPathLenZero) && below > issuer.MaxPathLen {
+		return errors.New("opensm/x509: path length constraint exceeded")
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+// Package x509 parses and creates X.509 certificates and PKCS #10
+// certificate requests with SM2 public keys and SM2-with-SM3 signatures,
+// which crypto/x509 does not support, verifies certificate chains, and
+// optionally checks certificates against the GM/T 0015 certificate profile.
+//
+// Signatures are over SM3(ZA || data), with ZA computed for the signer's ID
+// and public key. The ID is sm2.DefaultUID unless VerifyOptions.UID names
+// another, such as the empty ID OpenSSL 3 signs with by default.
+package x509
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"opensm/src/sm2"
+	"opensm/src/sm3"
+	"time"
+)
+
+var (
+	// OIDSignatureSM2WithSM3 identifies SM2 signatures over SM3 digests.
+	OIDSignatureSM2WithSM3 = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 501}
+	// OIDNamedCurveSM2 identifies the SM2 curve.
+	OIDNamedCurveSM2 = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301}
+
+	oidPublicKeyEC = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+
+	oidExtensionSubjectKeyId     = asn1.ObjectIdentifier{2, 5, 29, 14}
+	oidExtensionKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionSubjectAltName   = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtensionBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+	oidExtensionAuthorityKeyId   = asn1.ObjectIdentifier{2, 5, 29, 35}
+	oidExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidExtensionRequest          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 14}
+)
+
+var (
+	errUnsupportedKey = errors.New("opensm/x509: unsupported public key")
+	errSignature      = errors.New("opensm/x509: invalid signature")
+)
+
+// KeyUsage is the set of key usage bits, with the same values as in
+// crypto/x509.
+type KeyUsage int
+
+const (
+	KeyUsageDigitalSignature KeyUsage = 1 << iota
+	KeyUsageContentCommitment
+	KeyUsageKeyEncipherment
+	KeyUsageDataEncipherment
+	KeyUsageKeyAgreement
+	KeyUsageCertSign
+	KeyUsageCRLSign
+	KeyUsageEncipherOnly
+	KeyUsageDecipherOnly
+)
+
+// ExtKeyUsage is an extended key usage with a name in this package.
+type ExtKeyUsage int
+
+const (
+	ExtKeyUsageAny ExtKeyUsage = iota
+	ExtKeyUsageServerAuth
+	ExtKeyUsageClientAuth
+	ExtKeyUsageCodeSigning
+	ExtKeyUsageEmailProtection
+	ExtKeyUsageTimeStamping
+	ExtKeyUsageOCSPSigning
+)
+
+var extKeyUsageOIDs = []asn1.ObjectIdentifier{
+	ExtKeyUsageAny:             {2, 5, 29, 37, 0},
+	ExtKeyUsageServerAuth:      {1, 3, 6, 1, 5, 5, 7, 3, 1},
+	ExtKeyUsageClientAuth:      {1, 3, 6, 1, 5, 5, 7, 3, 2},
+	ExtKeyUsageCodeSigning:     {1, 3, 6, 1, 5, 5, 7, 3, 3},
+	ExtKeyUsageEmailProtection: {1, 3, 6, 1, 5, 5, 7, 3, 4},
+	ExtKeyUsageTimeStamping:    {1, 3, 6, 1, 5, 5, 7, 3, 8},
+	ExtKeyUsageOCSPSigning:     {1, 3, 6, 1, 5, 5, 7, 3, 9},
+}
+
+// Certificate is an X.509 certificate with an SM2 subject public key. As a
+// template for CreateCertificate its fields from SerialNumber on are used,
+// except Extensions and UnhandledCriticalExtensions; the others are only
+// set by ParseCertificate.
+type Certificate struct {
+	Raw                     []byte
+	RawTBSCertificate       []byte
+	RawSubjectPublicKeyInfo []byte
+	RawSubject              []byte
+	RawIssuer               []byte
+
+	Signature          []byte
+	SignatureAlgorithm asn1.ObjectIdentifier
+	PublicKey          *sm2.PublicKey
+
+	Version             int
+	SerialNumber        *big.Int
+	Issuer              pkix.Name
+	Subject             pkix.Name
+	NotBefore, NotAfter time.Time
+	KeyUsage            KeyUsage
+
+	// Extensions are all the extensions of a parsed certificate, and
+	// ExtraExtensions are added verbatim to a created one.
+	Extensions      []pkix.Extension
+	ExtraExtensions []pkix.Extension
+	// UnhandledCriticalExtensions lists the critical extensions this
+	// package does not process. Verify rejects chains with any.
+	UnhandledCriticalExtensions []asn1.ObjectIdentifier
+
+	ExtKeyUsage        []ExtKeyUsage
+	UnknownExtKeyUsage []asn1.ObjectIdentifier
+
+	// BasicConstraintsValid says whether the basic constraints extension
+	// is present. MaxPathLen is -1 in parsed certificates without a path
+	// length, and in templates 0 means none unless MaxPathLenZero is set.
+	BasicConstraintsValid bool
+	IsCA                  bool
+	MaxPathLen            int
+	MaxPathLenZero        bool
+
+	SubjectKeyId   []byte
+	AuthorityKeyId []byte
+
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []net.IP
+}
+
+// CertificateRequest is a PKCS #10 certificate request with an SM2 public
+// key. The extensions are those of the extension request attributes.
+type CertificateRequest struct {
+	Raw                      []byte
+	RawTBSCertificateRequest []byte
+	RawSubjectPublicKeyInfo  []byte
+	RawSubject               []byte
+
+	Signature          []byte
+	SignatureAlgorithm asn1.ObjectIdentifier
+	PublicKey          *sm2.PublicKey
+
+	Version int
+	Subject pkix.Name
+
+	Extensions      []pkix.Extension
+	ExtraExtensions []pkix.Extension
+
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []net.IP
+}
+
+type certificate struct {
+	TBSCertificate     tbsCertificate
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+type tbsCertificate struct {
+	Raw                asn1.RawContent
+	Version            int `asn1:"optional,explicit,default:0,tag:0"`
+	SerialNumber       *big.Int
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Issuer             asn1.RawValue
+	Validity           validity
+	Subject            asn1.RawValue
+	PublicKey          publicKeyInfo
+	UniqueId           asn1.BitString   `asn1:"optional,tag:1"`
+	SubjectUniqueId    asn1.BitString   `asn1:"optional,tag:2"`
+	Extensions         []pkix.Extension `asn1:"omitempty,optional,explicit,tag:3"`
+}
+
+type validity struct {
+	NotBefore, NotAfter time.Time
+}
+
+type publicKeyInfo struct {
+	Raw       asn1.RawContent
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+type certificateRequest struct {
+	TBSCSR             tbsCertificateRequest
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+type tbsCertificateRequest struct {
+	Raw           asn1.RawContent
+	Version       int
+	Subject       asn1.RawValue
+	PublicKey     publicKeyInfo
+	RawAttributes []asn1.RawValue `asn1:"tag:0"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type basicConstraints struct {
+	IsCA       bool `asn1:"optional"`
+	MaxPathLen int  `asn1:"optional,default:-1"`
+}
+
+type authKeyId struct {
+	Id []byte `asn1:"optional,tag:0"`
+}
+
+type sm2Signature struct {
+	R, S *big.Int
+}
+
+// ParsePKIXPublicKey parses an SM2 public key in PKIX SubjectPublicKeyInfo
+// form. Both the id-ecPublicKey algorithm with the SM2 curve and the SM2
+// curve identifier used as the algorithm, as OpenSSL 3 writes it, are
+// accepted.
+func ParsePKIXPublicKey(der []byte) (*sm2.PublicKey, error) {
+	var ki publicKeyInfo
+	if rest, err := asn1.Unmarshal(der, &ki); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, errors.New("opensm/x509: trailing data after public key")
+	}
+	return parsePublicKey(&ki)
+}
+
+// MarshalPKIXPublicKey returns pub in PKIX SubjectPublicKeyInfo form, with
+// the id-ecPublicKey algorithm and the SM2 curve.
+func MarshalPKIXPublicKey(pub *sm2.PublicKey) ([]byte, error) {
+	ki, err := marshalPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(ki)
+}
+
+func parsePublicKey(ki *publicKeyInfo) (*sm2.PublicKey, error) {
+	alg := ki.Algorithm
+	switch {
+	case alg.Algorithm.Equal(oidPublicKeyEC):
+		var curve asn1.ObjectIdentifier
+		rest, err := asn1.Unmarshal(alg.Parameters.FullBytes, &curve)
+		if err != nil || len(rest) != 0 || !curve.Equal(OIDNamedCurveSM2) {
+			return nil, errUnsupportedKey
+		}
+	case alg.Algorithm.Equal(OIDNamedCurveSM2):
+	default:
+		return nil, errUnsupportedKey
+	}
+
+	b := ki.PublicKey.Bytes
+	if ki.PublicKey.BitLength != 8*65 || len(b) != 65 || b[0] != 4 {
+		return nil, errors.New("opensm/x509: invalid SM2 public key")
+	}
+	curve := sm2.SM2P256()
+	x := new(big.Int).SetBytes(b[1:33])
+	y := new(big.Int).SetBytes(b[33:])
+	if x.Cmp(curve.Params().P) >= 0 || y.Cmp(curve.Params().P) >= 0 || !curve.IsOnCurve(x, y) {
+		return nil, errors.New("opensm/x509: invalid SM2 public key")
+	}
+	return &sm2.PublicKey{AffinePoint: &sm2.AffinePoint{X: x, Y: y}}, nil
+}
+
+func marshalPublicKey(pub *sm2.PublicKey) (publicKeyInfo, error) {
+	if pub == nil || pub.AffinePoint == nil {
+		return publicKeyInfo{}, errUnsupportedKey
+	}
+	params, err := asn1.Marshal(OIDNamedCurveSM2)
+	if err != nil {
+		return publicKeyInfo{}, err
+	}
+	point := make([]byte, 65)
+	point[0] = 4
+	pub.X.FillBytes(point[1:33])
+	pub.Y.FillBytes(point[33:])
+	return publicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPublicKeyEC,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		PublicKey: asn1.BitString{Bytes: point, BitLength: 8 * len(point)},
+	}, nil
+}
+
+// digest returns SM3(ZA || data) for the signer pub with ID uid.
+func digest(pub *sm2.PublicKey, uid, data []byte) ([]byte, error) {
+	za, err := sm2.ZA(pub, uid)
+	if err != nil {
+		return nil, err
+	}
+	h := sm3.New()
+	h.Write(za)
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
+// sign returns the DER SM2-with-SM3 signature of data by priv.
+func sign(rand io.Reader, priv *sm2.PrivateKey, data []byte) ([]byte, error) {
+	e, err := digest(&priv.PublicKey, sm2.DefaultUID, data)
+	if err != nil {
+		return nil, err
+	}
+	r, s, err := sm2.Sign(rand, priv, e)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(sm2Signature{r, s})
+}
+
+// checkSignature verifies the DER signature sig of data by pub, with ID uid,
+// under the algorithm alg.
+func checkSignature(pub *sm2.PublicKey, uid []byte, alg asn1.ObjectIdentifier, data, sig []byte) error {
+	if !alg.Equal(OIDSignatureSM2WithSM3) {
+		return errors.New("opensm/x509: unsupported signature algorithm " + alg.String())
+	}
+	var rs sm2Signature
+	if rest, err := asn1.Unmarshal(sig, &rs); err != nil || len(rest) != 0 {
+		return errSignature
+	}
+	e, err := digest(pub, uid, data)
+	if err != nil {
+		return err
+	}
+	if !sm2.Verify(pub, e, rs.R, rs.S) {
+		return errSignature
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package zuc
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// checkEEA3 validates the parameters shared by EEA3 and EIA3.
+func checkEEA3(bearer, direction uint8, msg []byte, length int) error {
+	if bearer > 0x1F {
+		return errors.New("opensm/zuc: bearer must be 5 bits")
+	}
+	if direction > 1 {
+		return errors.New("opensm/zuc: direction must be 0 or 1")
+	}
+	if length < 0 || (length+7)/8 > len(msg) {
+		return errors.New("opensm/zuc: message shorter than its bit length")
+	}
+	return nil
+}
+
+// NewEEA3 returns the 128-EEA3 keystream for a 16-byte confidentiality key
+// and the COUNT, BEARER (5 bits) and DIRECTION (1 bit) of a message.
+func NewEEA3(key []byte, count uint32, bearer, direction uint8) (*Cipher, error) {
+	if err := checkEEA3(bearer, direction, nil, 0); err != nil {
+		return nil, err
+	}
+	var iv [IVSize]byte
+	binary.BigEndian.PutUint32(iv[:], count)
+	iv[4] = bearer<<3 | direction<<2
+	copy(iv[8:], iv[:8])
+	return NewCipher(key, iv[:])
+}
+
+// EEA3 encrypts or decrypts the first length bits of msg with 128-EEA3. The
+// result has (length+7)/8 bytes, the bits past length in its last byte set
+// to zero.
+func EEA3(key []byte, count uint32, bearer, direction uint8, msg []byte, length int) ([]byte, error) {
+	if err := checkEEA3(bearer, direction, msg, length); err != nil {
+		return nil, err
+	}
+	c, err := NewEEA3(key, count, bearer, direction)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, (length+7)/8)
+	c.XORKeyStream(out, msg[:len(out)])
+	if r := length % 8; r != 0 {
+		out[len(out)-1] &= 0xFF << (8 - r)
+	}
+	return out, nil
+}
+
+// EIA3 returns the 32-bit 128-EIA3 MAC of the first length bits of msg under
+// a 16-byte integrity key.
+func EIA3(key []byte, count uint32, bearer, direction uint8, msg []byte, length int) (uint32, error) {
+	if err := checkEEA3(bearer, direction, msg, length); err != nil {
+		return 0, err
+	}
+
+	var iv [IVSize]byte
+	binary.BigEndian.PutUint32(iv[:], count)
+	iv[4] = bearer << 3
+	copy(iv[8:], iv[:8])
+	iv[8] ^= direction << 7
+	iv[14] ^= direction << 7
+	c, err := NewCipher(key, iv[:])
+	if err != nil {
+		return 0, err
+	}
+
+	k := make([]uint32, (length+31)/32+2)
+	c.KeyStream(k)
+	// z returns the keystream word starting at bit i
+	z := func(i int) uint32 {
+		w, r := i/32, uint(i%32)
+		if r == 0 {
+			return k[w]
+		}
+		return k[w]<<r | k[w+1]>>(32-r)
+	}
+
+	var t uint32
+	for i := 0; i < length; i++ {
+		bit := uint32(msg[i/8]>>(7-i%8)) & 1
+		t ^= z(i) & -bit
+	}
+	t ^= z(length)
+	return t ^ k[len(k)-1], nil
+}
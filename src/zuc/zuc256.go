@@ -0,0 +1,147 @@
+package zuc
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash"
+)
+
+const (
+	// Key256Size is the length of a ZUC-256 key.
+	Key256Size = 32
+	// IV256Size is the length of a ZUC-256 IV: 17 bytes, then 8 bytes
+	// holding 6 bits each, 184 bits in all.
+	IV256Size = 25
+)
+
+// d256 is the 7-bit loading constant of ZUC-256 keystream generation; the
+// MAC flips the low bit of d256[0] for 64 and 128-bit tags and of d256[2]
+// for 32 and 128-bit tags.
+var d256 = [16]byte{
+	0x22, 0x2F, 0x24, 0x2A, 0x6D, 0x40, 0x40, 0x40,
+	0x40, 0x40, 0x40, 0x40, 0x40, 0x52, 0x10, 0x30,
+}
+
+// NewCipher256 returns ZUC-256 for a 32-byte key and a 25-byte IV.
+func NewCipher256(key, iv []byte) (*Cipher, error) {
+	return newCipher256(key, iv, &d256)
+}
+
+func newCipher256(key, iv []byte, d *[16]byte) (*Cipher, error) {
+	if len(key) != Key256Size {
+		return nil, KeySizeError(len(key))
+	}
+	if len(iv) != IV256Size {
+		return nil, KeySizeError(len(iv))
+	}
+	for _, b := range iv[17:] {
+		if b > 0x3F {
+			return nil, errors.New("opensm/zuc: ZUC-256 IV bytes 17 to 24 must be 6 bits")
+		}
+	}
+
+	k := key
+	c := new(Cipher)
+	s := &c.st.s
+	s[0] = cell(k[0], d[0], k[21], k[16])
+	s[1] = cell(k[1], d[1], k[22], k[17])
+	s[2] = cell(k[2], d[2], k[23], k[18])
+	s[3] = cell(k[3], d[3], k[24], k[19])
+	s[4] = cell(k[4], d[4], k[25], k[20])
+	s[5] = cell(iv[0], d[5]|iv[17], k[5], k[26])
+	s[6] = cell(iv[1], d[6]|iv[18], k[6], k[27])
+	s[7] = cell(iv[10], d[7]|iv[19], k[7], iv[2])
+	s[8] = cell(k[8], d[8]|iv[20], iv[3], iv[11])
+	s[9] = cell(k[9], d[9]|iv[21], iv[12], iv[4])
+	s[10] = cell(iv[5], d[10]|iv[22], k[10], k[28])
+	s[11] = cell(k[11], d[11]|iv[23], iv[6], iv[13])
+	s[12] = cell(k[12], d[12]|iv[24], iv[7], iv[14])
+	s[13] = cell(k[13], d[13], iv[15], iv[8])
+	s[14] = cell(k[14], d[14]|k[31]>>4, iv[16], iv[9])
+	s[15] = cell(k[15], d[15]|k[31]&0x0F, k[30], k[29])
+	c.st.init()
+	return c, nil
+}
+
+// mac256 is the ZUC-256 MAC. The tag starts as the first tagSize bits of
+// keystream; every set message bit XORs in the tagSize-bit keystream window
+// that follows, which slides by one bit per message bit, and the window
+// reached at the end is XORed in last.
+type mac256 struct {
+	key [Key256Size]byte
+	iv  [IV256Size]byte
+	d   [16]byte
+	n   int // tag words
+
+	c   *Cipher
+	tag [4]uint32
+	win [5]uint32 // n+1 keystream words holding the window
+	off uint      // bit offset of the window in win[0]
+}
+
+// NewMAC256 returns the ZUC-256 MAC for a 32-byte key and a 25-byte IV with
+// a tag of size 4, 8 or 16 bytes. A key and IV pair must not be reused.
+func NewMAC256(key, iv []byte, size int) (hash.Hash, error) {
+	m := &mac256{d: d256, n: size / 4}
+	switch size {
+	case 4:
+		m.d[2] |= 1
+	case 8:
+		m.d[0] |= 1
+	case 16:
+		m.d[0] |= 1
+		m.d[2] |= 1
+	default:
+		return nil, errors.New("opensm/zuc: MAC size must be 4, 8 or 16 bytes")
+	}
+	if _, err := newCipher256(key, iv, &m.d); err != nil {
+		return nil, err
+	}
+	copy(m.key[:], key)
+	copy(m.iv[:], iv)
+	m.Reset()
+	return m, nil
+}
+
+func (m *mac256) Size() int { return 4 * m.n }
+
+func (m *mac256) BlockSize() int { return 4 }
+
+func (m *mac256) Reset() {
+	m.c, _ = newCipher256(m.key[:], m.iv[:], &m.d)
+	m.c.KeyStream(m.tag[:m.n])
+	m.c.KeyStream(m.win[:m.n+1])
+	m.off = 0
+}
+
+// window returns word k of the current window.
+func (m *mac256) window(k int) uint32 {
+	if m.off == 0 {
+		return m.win[k]
+	}
+	return m.win[k]<<m.off | m.win[k+1]>>(32-m.off)
+}
+
+func (m *mac256) Write(p []byte) (int, error) {
+	for _, b := range p {
+		for j := 7; j >= 0; j-- {
+			mask := -uint32(b >> j & 1)
+			for k := 0; k < m.n; k++ {
+				m.tag[k] ^= m.window(k) & mask
+			}
+			if m.off++; m.off == 32 {
+				m.off = 0
+				copy(m.win[:], m.win[1:m.n+1])
+				m.c.KeyStream(m.win[m.n : m.n+1])
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (m *mac256) Sum(in []byte) []byte {
+	for k := 0; k < m.n; k++ {
+		in = binary.BigEndian.AppendUint32(in, m.tag[k]^m.window(k))
+	}
+	return in
+}
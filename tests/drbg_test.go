@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"opensm/src/drbg"
+	"opensm/src/sm2"
+	"testing"
+)
+
+// seqReader is a predictable entropy source returning 0x00, 0x01, 0x02, ...
+type seqReader struct {
+	n byte
+}
+
+func (r *seqReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = r.n
+		r.n++
+	}
+	return len(p), nil
+}
+
+type drbgGen interface {
+	io.Reader
+	Generate(out, additional []byte) error
+	Reseed(additional []byte) error
+}
+
+// The expected outputs come from an independent implementation of the
+// SP 800-90A algorithms instantiated with SM3 and SM4.
+func testDRBG(t *testing.T, name string, newDRBG func(io.Reader, []byte, bool) (drbgGen, error), want []string) {
+	d, err := newDRBG(&seqReader{}, []byte("personalization"), false)
+	if err != nil {
+		t.Fatalf("%s: instantiate failed : %s", name, err)
+	}
+
+	out := make([]byte, 64)
+	d.Generate(out, nil)
+	if !bytes.Equal(out, fromHex(want[0])) {
+		t.Errorf("%s: Generate = %x, want %s", name, out, want[0])
+	}
+
+	d.Generate(out, []byte("additional"))
+	if !bytes.Equal(out, fromHex(want[1])) {
+		t.Errorf("%s: Generate with additional input = %x, want %s", name, out, want[1])
+	}
+
+	d.Reseed([]byte("reseed"))
+	out = make([]byte, 37)
+	io.ReadFull(d, out)
+	if !bytes.Equal(out, fromHex(want[2])) {
+		t.Errorf("%s: Read after Reseed = %x, want %s", name, out, want[2])
+	}
+
+	d, _ = newDRBG(&seqReader{}, nil, true)
+	d.Generate(make([]byte, 16), nil)
+	out = make([]byte, 40)
+	d.Generate(out, []byte("additional"))
+	if !bytes.Equal(out, fromHex(want[3])) {
+		t.Errorf("%s: Generate with prediction resistance = %x, want %s", name, out, want[3])
+	}
+
+	if err := d.Generate(make([]byte, drbg.MaxRequest+1), nil); err != drbg.ErrRequestTooLarge {
+		t.Errorf("%s: oversized Generate returned %v", name, err)
+	}
+	if n, err := d.Read(make([]byte, 3*drbg.MaxRequest+5)); n != 3*drbg.MaxRequest+5 || err != nil {
+		t.Errorf("%s: large Read = %d, %v", name, n, err)
+	}
+
+	if _, err := newDRBG(bytes.NewReader(make([]byte, 4)), nil, false); err == nil {
+		t.Errorf("%s: instantiate with short entropy succeeded", name)
+	}
+
+	d, _ = newDRBG(nil, nil, false)
+	pkey, err := sm2.GenerateKeySM2P256(d)
+	if err != nil {
+		t.Fatalf("%s: GenerateKeySM2P256 failed : %s", name, err)
+	}
+	msg := make([]byte, 32)
+	io.ReadFull(d, msg)
+	r, s, err := sm2.Sign(d, pkey, msg)
+	if err != nil || !sm2.Verify(&pkey.PublicKey, msg, r, s) {
+		t.Errorf("%s: sign with DRBG failed : %v", name, err)
+	}
+}
+
+func TestHashDRBG(t *testing.T) {
+	testDRBG(t, "SM3 Hash_DRBG", func(r io.Reader, p []byte, pr bool) (drbgGen, error) {
+		return drbg.NewHashDRBG(r, p, pr)
+	}, []string{
+		"4ea563b95851e9340545b90202f857e476a33a64b56a775e3048bd6c139535a5ef09651533eb1a5569f7bffa32bf9566abc18e85e44ccbd65c2cbdd0ac5e2a03",
+		"f0f670f3e0f6f5c7983ee17cecccac2feef09496bc7e378ed38dde879c766509032be0da2ee1e6f2710300a5b0254f8fd51cb8d02b4643aef3b87e72ec52b521",
+		"fa1821f547f7cf0106aeaa5ddd612bca0956a96a260012454d2b3ab3e4dfe9cb8899589714",
+		"9bdcbd248116a15232eb8b952b69769352986f73afecb57b122f327253104ee8f6561d85673eec53",
+	})
+}
+
+func TestCtrDRBG(t *testing.T) {
+	testDRBG(t, "SM4 CTR_DRBG", func(r io.Reader, p []byte, pr bool) (drbgGen, error) {
+		return drbg.NewCtrDRBG(r, p, pr)
+	}, []string{
+		"ebd5f3f538c0c613054f0f45e42ff2f5dca8dc6a3008c129b76e70b7ff7e3182fb231ccceccd854a74f14b5808dfb49add7bf75624778db2b8b962e52b30263e",
+		"a2a0e2e41be4ea5ed2fec48068d17ae2b0d8b256dcd6e06a80cc4dd9312f3c3148797a3d2a999868dbeebc0e6acd5433b4e7418f685b586468fecbcfc3a12a8f",
+		"bd824d5861ff831e5fad9c7453b005a49eac422098fe62cbf19e19a2014fab7ecc55b906b9",
+		"47e17895f1450da1acea5e9009c6c32471376ace8b46ae2366be95759dbf0f41e893617830d2a48d",
+	})
+}
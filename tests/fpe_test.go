@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/aes"
+	"errors"
+	"opensm/src/fpe"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const (
+	digits   = "0123456789"
+	base36   = "0123456789abcdefghijklmnopqrstuvwxyz"
+	hanDigit = "零一二三四五六七八九"
+)
+
+func TestFF1AES(t *testing.T) {
+	// NIST SP 800-38G FF1 samples 1-3
+	b, _ := aes.NewCipher(fromHex("2B7E151628AED2A6ABF7158809CF4F3C"))
+	for _, tc := range []struct {
+		alphabet, tweak, plain, want string
+	}{
+		{digits, "", "0123456789", "2433477484"},
+		{digits, "39383736353433323130", "0123456789", "6124200773"},
+		{base36, "3737373770717273373737", "0123456789abcdefghi", "a9tv40mll9kdu509eum"},
+	} {
+		f, err := fpe.NewFF1Cipher(b, tc.alphabet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := f.Encrypt(tc.plain, fromHex(tc.tweak))
+		if err != nil || got != tc.want {
+			t.Errorf("Encrypt(%s) = %s, %v; want %s", tc.plain, got, err, tc.want)
+		}
+		if got, err := f.Decrypt(tc.want, fromHex(tc.tweak)); err != nil || got != tc.plain {
+			t.Errorf("Decrypt(%s) = %s, %v", tc.want, got, err)
+		}
+	}
+}
+
+func TestFF31AES(t *testing.T) {
+	// the FF3-1 sample built from NIST FF3 sample 1 with a 56-bit tweak, and
+	// a radix-36 case from an independent implementation
+	key := fromHex("EF4359D8D580AA4F7F036D6F04FC6A94")
+	slices.Reverse(key)
+	b, _ := aes.NewCipher(key)
+	for _, tc := range []struct {
+		alphabet, tweak, plain, want string
+	}{
+		{digits, "D8E7920AFA330A", "890121234567890000", "477064185124354662"},
+		{base36, "9A768A92F60E12", "0123456789abcdefghi", "c5w89fqt1cmo9t608nc"},
+	} {
+		f, err := fpe.NewFF31Cipher(b, tc.alphabet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := f.Encrypt(tc.plain, fromHex(tc.tweak))
+		if err != nil || got != tc.want {
+			t.Errorf("Encrypt(%s) = %s, %v; want %s", tc.plain, got, err, tc.want)
+		}
+		if got, err := f.Decrypt(tc.want, fromHex(tc.tweak)); err != nil || got != tc.plain {
+			t.Errorf("Decrypt(%s) = %s, %v", tc.want, got, err)
+		}
+	}
+}
+
+func TestFPESM4(t *testing.T) {
+	key := fromHex("0123456789ABCDEFFEDCBA9876543210")
+	ff1, err := fpe.NewFF1(key, digits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ff1b36, _ := fpe.NewFF1(key, base36)
+	ff31, err := fpe.NewFF31(key, digits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ff31b36, _ := fpe.NewFF31(key, base36)
+
+	type mode interface {
+		Encrypt(string, []byte) (string, error)
+		Decrypt(string, []byte) (string, error)
+	}
+
+	// values from an independent Python implementation
+	for _, tc := range []struct {
+		m                  mode
+		tweak, plain, want string
+	}{
+		{ff1, "", "6222021234567890123", "5295497548139381925"},
+		{ff1, "0102030405", "13800138000", "10216953226"},
+		{ff1b36, "3737373770717273373737", "0123456789abcdefghi", "4q6cm19pbpxfry40rej"},
+		{ff31, "D8E7920AFA330A", "6222021234567890123", "7548426211967770654"},
+		{ff31b36, "9A768A92F60E12", "0123456789abcdefghi", "bp1muj0xwj6myk1qihj"},
+	} {
+		got, err := tc.m.Encrypt(tc.plain, fromHex(tc.tweak))
+		if err != nil || got != tc.want {
+			t.Errorf("Encrypt(%s) = %s, %v; want %s", tc.plain, got, err, tc.want)
+		}
+		if got, err := tc.m.Decrypt(tc.want, fromHex(tc.tweak)); err != nil || got != tc.plain {
+			t.Errorf("Decrypt(%s) = %s, %v", tc.want, got, err)
+		}
+	}
+
+	// any alphabet, including multi-byte characters, at every length
+	han, _ := fpe.NewFF1(key, hanDigit)
+	han31, _ := fpe.NewFF31(key, hanDigit)
+	bin, _ := fpe.NewFF1(key, "01")
+	for _, tc := range []struct {
+		m        mode
+		alphabet string
+		minLen   int
+	}{
+		{ff1, digits, 6}, {ff31, digits, 6}, {han, hanDigit, 6}, {han31, hanDigit, 6}, {bin, "01", 20},
+	} {
+		alpha := []rune(tc.alphabet)
+		for n := tc.minLen; n <= 56; n++ {
+			plain := make([]rune, n)
+			for i := range plain {
+				plain[i] = alpha[(i*7+n)%len(alpha)]
+			}
+			tweak := seq(n, n+7)
+			ct, err := tc.m.Encrypt(string(plain), tweak)
+			if err != nil {
+				t.Fatalf("%q, %d numerals: %v", tc.alphabet, n, err)
+			}
+			if len([]rune(ct)) != n {
+				t.Fatalf("%q, %d numerals: ciphertext %q changed length", tc.alphabet, n, ct)
+			}
+			for _, r := range ct {
+				if !slices.Contains(alpha, r) {
+					t.Fatalf("%q, %d numerals: ciphertext %q leaves the alphabet", tc.alphabet, n, ct)
+				}
+			}
+			if pt, err := tc.m.Decrypt(ct, tweak); err != nil || pt != string(plain) {
+				t.Fatalf("%q, %d numerals: Decrypt = %q, %v", tc.alphabet, n, pt, err)
+			}
+		}
+	}
+}
+
+func TestFPEErrors(t *testing.T) {
+	key := fromHex("0123456789ABCDEFFEDCBA9876543210")
+	ff1, _ := fpe.NewFF1(key, digits)
+	ff31, _ := fpe.NewFF31(key, digits)
+	tweak := make([]byte, fpe.FF31TweakSize)
+
+	// a million is the least domain: six decimal digits, 20 binary ones
+	if _, err := ff1.Encrypt("12345", nil); !errors.Is(err, fpe.ErrLength) {
+		t.Errorf("FF1 5 digits: %v", err)
+	}
+	if _, err := ff1.Encrypt("123456", nil); err != nil {
+		t.Errorf("FF1 6 digits: %v", err)
+	}
+	bin, _ := fpe.NewFF1(key, "01")
+	if _, err := bin.Encrypt("0101010101010101010", nil); !errors.Is(err, fpe.ErrLength) {
+		t.Errorf("FF1 19 bits: %v", err)
+	}
+	if _, err := ff31.Encrypt("12345", tweak); !errors.Is(err, fpe.ErrLength) {
+		t.Errorf("FF3-1 5 digits: %v", err)
+	}
+	// FF3-1 is limited to 2*floor(log10(2^96)) = 56 digits
+	if _, err := ff31.Encrypt(strings.Repeat("1", 56), tweak); err != nil {
+		t.Errorf("FF3-1 56 digits: %v", err)
+	}
+	if _, err := ff31.Encrypt(strings.Repeat("1", 57), tweak); !errors.Is(err, fpe.ErrLength) {
+		t.Errorf("FF3-1 57 digits: %v", err)
+	}
+
+	if _, err := ff1.Encrypt("12345a", nil); !errors.Is(err, fpe.ErrAlphabet) {
+		t.Errorf("FF1 foreign character: %v", err)
+	}
+	if _, err := ff31.Encrypt("123456", tweak[:6]); !errors.Is(err, fpe.ErrTweak) {
+		t.Errorf("FF3-1 short tweak: %v", err)
+	}
+	for _, a := range []string{"", "0", "0120"} {
+		if _, err := fpe.NewFF1(key, a); !errors.Is(err, fpe.ErrAlphabet) {
+			t.Errorf("alphabet %q: %v", a, err)
+		}
+	}
+	if _, err := fpe.NewFF1(key[:15], digits); err == nil {
+		t.Errorf("short key accepted")
+	}
+}
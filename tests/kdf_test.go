@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"opensm/src/kdf"
+	"testing"
+)
+
+func fromHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func seq(from, to int) []byte {
+	b := make([]byte, 0, to-from)
+	for i := from; i < to; i++ {
+		b = append(b, byte(i))
+	}
+	return b
+}
+
+// The HKDF and PBKDF2 inputs are those of RFC 5869 and RFC 6070; the outputs
+// for SM3 were cross-checked against OpenSSL's HMAC-SM3.
+func TestHKDF(t *testing.T) {
+	tests := []struct {
+		ikm, salt, info []byte
+		prk, okm        string
+	}{
+		{
+			bytes.Repeat([]byte{0x0b}, 22), seq(0x00, 0x0d), seq(0xf0, 0xfa),
+			"e0d6f7b0bd056327b7659f1f39ad850561fbcf4fb10fb58e88eafa55cf7cd01e",
+			"c69fe91b7aaee2dd5718d72dcaee0cce93f1b8e41f792da51261b6a517e68b36ed2c595572b01dfa359b",
+		},
+		{
+			seq(0x00, 0x50), seq(0x60, 0xb0), seq(0xb0, 0x100),
+			"1a43a7fedb2d111eb33babd0d256c272aa3262cdb12e6b43d4321ae8888485d5",
+			"c1226236bbdefa7921f9febe27b864f33e449201b436d8844ea53f58170dd6426defbd22ed1f3c5960f35523e62e3b6c0d657f2c61893436f539013199bfaef25aafd1e7726ede927623a9f5cbb8885c7e5d",
+		},
+		{
+			bytes.Repeat([]byte{0x0b}, 22), nil, nil,
+			"004fc37143377d072d74e82ff480e8d7937ec607411bc1ec65dd34401871ff9c",
+			"c8c91a38ae2fb3b023a7c38ce9f0748f28230d59b6b950ba3ba949bf0d713a5774815778801741cb2034",
+		},
+	}
+
+	for i, tt := range tests {
+		prk := kdf.Extract(tt.ikm, tt.salt)
+		if !bytes.Equal(prk, fromHex(tt.prk)) {
+			t.Errorf("test %d: Extract = %x, want %s", i, prk, tt.prk)
+		}
+
+		want := fromHex(tt.okm)
+		okm := make([]byte, len(want))
+		if _, err := io.ReadFull(kdf.HKDF(tt.ikm, tt.salt, tt.info), okm); err != nil || !bytes.Equal(okm, want) {
+			t.Errorf("test %d: HKDF = %x, %v, want %s", i, okm, err, tt.okm)
+		}
+
+		// the same output read a few bytes at a time
+		r := kdf.Expand(prk, tt.info)
+		okm = okm[:0]
+		for len(okm) < len(want) {
+			p := make([]byte, 5)
+			if len(want)-len(okm) < len(p) {
+				p = p[:len(want)-len(okm)]
+			}
+			io.ReadFull(r, p)
+			okm = append(okm, p...)
+		}
+		if !bytes.Equal(okm, want) {
+			t.Errorf("test %d: streamed Expand = %x, want %s", i, okm, tt.okm)
+		}
+	}
+
+	r := kdf.Expand(make([]byte, 32), nil)
+	if _, err := io.ReadFull(r, make([]byte, 255*32)); err != nil {
+		t.Errorf("reading 255 blocks failed : %s", err)
+	}
+	if _, err := r.Read(make([]byte, 1)); err != kdf.ErrLimit {
+		t.Errorf("reading past 255 blocks returned %v, want ErrLimit", err)
+	}
+}
+
+func TestPBKDF2(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iter, keyLen   int
+		want           string
+	}{
+		{"password", "salt", 1, 32, "4612f922a1fdcefaf4312fc6f8f3322b489cbf24f2ea361b44c2bd8fa2c6dcb0"},
+		{"password", "salt", 4096, 32, "b6e8f2074c87432b78f62e5ced980fdff89e86af2f693dab1638e2b3683045dd"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, 40,
+			"3b6282ac8519f059e465abff0ea37b0dbfe6c672a76e6b805312d53900db630732ccc1a88fa5512a"},
+	}
+
+	for i, tt := range tests {
+		dk := kdf.PBKDF2([]byte(tt.password), []byte(tt.salt), tt.iter, tt.keyLen)
+		if !bytes.Equal(dk, fromHex(tt.want)) {
+			t.Errorf("test %d: PBKDF2 = %x, want %s", i, dk, tt.want)
+		}
+	}
+}
+
+func TestKDF(t *testing.T) {
+	tests := []struct {
+		z    []byte
+		klen int
+		want string
+	}{
+		{seq(0, 64), 19, "c3e5cfe48b9da30523c65df3b189227188a89a"},
+		// GB/T 32918.4 annex A: t = KDF(x2 || y2, 152 bits) for the message
+		// "encryption standard"
+		{fromHex("64d20d27d0632957f8028c1e024f6b02edf23102a566c932ae8bd613a8e865fe" +
+			"58d225eca784ae300a81a2d48281a828e1cedf11c4219099840265375077bf78"), 19, "006e30dae231b071dfad8aa379e90264491603"},
+		{[]byte("abc"), 0, ""},
+		{[]byte("abc"), 100, "fe1ea80dac6f100c33537bd24619ec7c72a1e8b1ffeaefb1eb52a37791fdaf619db16c0ac7bebb47238c6cc925ff66af7936e278e12d2664502bb38b03fd41cb2975a660d33ecc32fe62f27c738964e266ec71694f39a68810af5a05d3b45d67975866a5"},
+	}
+
+	for i, tt := range tests {
+		want := fromHex(tt.want)
+		if k := kdf.KDF(tt.z, tt.klen); !bytes.Equal(k, want) {
+			t.Errorf("test %d: KDF = %x, want %s", i, k, tt.want)
+		}
+
+		r := kdf.NewKDF(tt.z)
+		k := make([]byte, 0, tt.klen)
+		for len(k) < tt.klen {
+			p := make([]byte, 7)
+			if tt.klen-len(k) < len(p) {
+				p = p[:tt.klen-len(k)]
+			}
+			io.ReadFull(r, p)
+			k = append(k, p...)
+		}
+		if !bytes.Equal(k, want) {
+			t.Errorf("test %d: streamed KDF = %x, want %s", i, k, tt.want)
+		}
+	}
+
+	for name, f := range map[string]func(){
+		"KDF with a negative length":    func() { kdf.KDF([]byte("abc"), -1) },
+		"PBKDF2 with a negative length": func() { kdf.PBKDF2([]byte("password"), []byte("salt"), 1, -1) },
+		"PBKDF2 with 0 iterations":      func() { kdf.PBKDF2([]byte("password"), []byte("salt"), 0, 20) },
+		"PBKDF2 with -1 iterations":     func() { kdf.PBKDF2([]byte("password"), []byte("salt"), -1, 20) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s did not panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"opensm/src/keywrap"
+	"opensm/src/sm4"
+	"testing"
+)
+
+type wrapVector struct {
+	kek, key, wrapped string
+	pad               bool
+}
+
+func checkWrap(t *testing.T, newCipher func([]byte) (cipher.Block, error), vectors []wrapVector) {
+	t.Helper()
+
+	for _, v := range vectors {
+		b, _ := newCipher(fromHex(v.kek))
+		key, want := fromHex(v.key), fromHex(v.wrapped)
+
+		wrap, unwrap := keywrap.Wrap, keywrap.Unwrap
+		if v.pad {
+			wrap, unwrap = keywrap.WrapPad, keywrap.UnwrapPad
+		}
+
+		got, err := wrap(b, key)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("wrap %s = %x, %v; want %x", v.key, got, err, want)
+		}
+		got, err = unwrap(b, want)
+		if err != nil || !bytes.Equal(got, key) {
+			t.Errorf("unwrap %s = %x, %v", v.wrapped, got, err)
+		}
+
+		for i := range want {
+			bad := append([]byte(nil), want...)
+			bad[i] ^= 0x10
+			if _, err := unwrap(b, bad); !errors.Is(err, keywrap.ErrIntegrity) {
+				t.Errorf("unwrap with byte %d modified: %v", i, err)
+			}
+		}
+	}
+}
+
+func TestKeyWrapAES(t *testing.T) {
+	// RFC 3394 section 4.1 and 4.2, RFC 5649 section 6
+	checkWrap(t, aes.NewCipher, []wrapVector{
+		{"000102030405060708090A0B0C0D0E0F", "00112233445566778899AABBCCDDEEFF", "1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5", false},
+		{"000102030405060708090A0B0C0D0E0F1011121314151617", "00112233445566778899AABBCCDDEEFF", "96778B25AE6CA435F92B5B97C050AED2468AB8A17AD84E5D", false},
+		{"5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8", "c37b7e6492584340bed12207808941155068f738", "138bdeaa9b8fa7fc61f97742e72248ee5ae6ae5360d1ae6a5f54f373fa543b6a", true},
+		{"5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8", "466f7250617369", "afbeb0f07dfbf5419200f2ccb50bb24f", true},
+	})
+}
+
+func TestKeyWrapSM4(t *testing.T) {
+	// the same structure over SM4. These are not GmSSL output: GmSSL was not
+	// available, so they are this package's own results and only guard
+	// against regressions. The wrapping itself is checked against the RFC
+	// vectors above, since it does not depend on the block cipher.
+	checkWrap(t, sm4.NewCipher, []wrapVector{
+		{"000102030405060708090a0b0c0d0e0f", "00112233445566778899aabbccddeeff", "c72e8dbfefe856259fff77de2023b380a9e2d0b8acb9b6f6", false},
+		{"000102030405060708090a0b0c0d0e0f", "00112233445566778899aabbccddeeff0001020304050607", "a874c3d64c7a639b7e8c97243550f528090df4cdcfb2cb81d403899fced7b88a", false},
+		{"5840df6e29b02af1ab493b705bf16ea1", "c37b7e6492584340bed12207808941155068f738", "c47d86253815615060826963826843eb1be39ecd9a032d04b22a710eb93d63e0", true},
+		{"5840df6e29b02af1ab493b705bf16ea1", "466f7250617369", "e4e0de4b938de5c3944f9e452779cf26", true},
+	})
+
+	kek, _ := sm4.NewCipher(testBytes(16, 1))
+	for n := 1; n <= 40; n++ {
+		key := testBytes(n, byte(n))
+		w, err := keywrap.WrapPad(kek, key)
+		if err != nil || len(w) != (n+7)/8*8+8 {
+			t.Fatalf("WrapPad %d bytes: %d bytes, %v", n, len(w), err)
+		}
+		if got, err := keywrap.UnwrapPad(kek, w); err != nil || !bytes.Equal(got, key) {
+			t.Errorf("UnwrapPad %d bytes: %x, %v", n, got, err)
+		}
+	}
+
+	// the padded and unpadded forms must not accept each other
+	w, _ := keywrap.Wrap(kek, testBytes(16, 2))
+	if _, err := keywrap.UnwrapPad(kek, w); !errors.Is(err, keywrap.ErrIntegrity) {
+		t.Errorf("UnwrapPad accepted a Wrap output: %v", err)
+	}
+
+	for _, n := range []int{0, 8, 15, 17} {
+		if _, err := keywrap.Wrap(kek, make([]byte, n)); !errors.Is(err, keywrap.ErrInvalidLength) {
+			t.Errorf("Wrap %d bytes: %v", n, err)
+		}
+	}
+	for _, n := range []int{0, 8, 16, 23} {
+		_, err := keywrap.Unwrap(kek, make([]byte, n))
+		var le keywrap.LengthError
+		if !errors.Is(err, keywrap.ErrInvalidLength) || !errors.As(err, &le) || int(le) != n {
+			t.Errorf("Unwrap %d bytes: %v", n, err)
+		}
+	}
+	if _, err := keywrap.WrapPad(kek, nil); !errors.Is(err, keywrap.ErrInvalidLength) {
+		t.Errorf("WrapPad empty: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"hash"
+	"opensm/src/mac"
+	"opensm/src/sm4"
+	"testing"
+)
+
+var macMsg = fromHex("6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710")
+
+// checkMAC compares h over msg with want, writing in one piece and in small
+// chunks, and checks that Sum leaves the state alone.
+func checkMAC(t *testing.T, name string, h hash.Hash, msg []byte, want string) {
+	t.Helper()
+
+	h.Reset()
+	h.Write(msg)
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		t.Errorf("%s: got %s, want %s", name, got, want)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		t.Errorf("%s: second Sum got %s", name, got)
+	}
+
+	h.Reset()
+	for i := 0; i < len(msg); i += 7 {
+		h.Write(msg[i:min(i+7, len(msg))])
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		t.Errorf("%s: chunked got %s, want %s", name, got, want)
+	}
+}
+
+func TestCMAC(t *testing.T) {
+	key := fromHex("2b7e151628aed2a6abf7158809cf4f3c")
+
+	// RFC 4493 with AES-128
+	a, _ := aes.NewCipher(key)
+	for _, tc := range []struct {
+		n    int
+		want string
+	}{
+		{0, "bb1d6929e95937287fa37d129b756746"},
+		{16, "070a16b46b4d4144f79bdd9dd04a287c"},
+		{40, "dfa66747de9ae63030ca32611497c827"},
+		{64, "51f0bebf7e3b9d92fc49741779363cfe"},
+	} {
+		checkMAC(t, "AES-CMAC", mac.NewCMAC(a), macMsg[:tc.n], tc.want)
+	}
+
+	// the same inputs with SM4, checked against OpenSSL
+	s, _ := sm4.NewCipher(key)
+	for _, tc := range []struct {
+		n    int
+		want string
+	}{
+		{0, "399a9c930964a3d4e38c59da47f0b309"},
+		{16, "4e4c2a4417e567fef081e0fab55a5762"},
+		{40, "8e31701927d50b28d53787513b69dd75"},
+		{64, "cc2b4f3d2c5aaf8a4ac30e28650eddc0"},
+	} {
+		checkMAC(t, "SM4-CMAC", mac.NewCMAC(s), macMsg[:tc.n], tc.want)
+	}
+}
+
+func TestISO9797(t *testing.T) {
+	k, _ := sm4.NewCipher(fromHex("2b7e151628aed2a6abf7158809cf4f3c"))
+	k1, _ := sm4.NewCipher(seq(0, 16))
+	k2, _ := sm4.NewCipher(seq(16, 32))
+	keys := map[mac.Algorithm][]cipher.Block{
+		mac.Alg1: {k}, mac.Alg2: {k, k1}, mac.Alg3: {k, k1}, mac.Alg4: {k, k1, k2}, mac.Alg6: {k, k1},
+	}
+
+	for _, tc := range []struct {
+		alg  mac.Algorithm
+		pad  mac.Padding
+		n    int
+		want string
+	}{
+		{mac.Alg1, mac.Pad1, 0, "09cbe15d851b5b0bbba4ca42eae3ff70"},
+		{mac.Alg1, mac.Pad1, 16, "a51411ff04a711443891fce7ab842a29"},
+		{mac.Alg1, mac.Pad1, 40, "f5b8a40c05fd4a65398e6efe580c1dfb"},
+		{mac.Alg1, mac.Pad2, 0, "dc226b361ba938b8930b0e773c3c6304"},
+		{mac.Alg1, mac.Pad2, 16, "8670c4f8476a76f895f94dc5267cf753"},
+		{mac.Alg1, mac.Pad2, 40, "1444550b3a7bbb9b76a2d8f4e5442046"},
+		{mac.Alg1, mac.Pad3, 0, "09cbe15d851b5b0bbba4ca42eae3ff70"},
+		{mac.Alg1, mac.Pad3, 16, "fca3d1036e4a8d96dfb79107cacc17a0"},
+		{mac.Alg1, mac.Pad3, 40, "3e5140fb2b1f2745b77ec15578dfa3f5"},
+		{mac.Alg2, mac.Pad1, 40, "b1dfc1a948fea3f2b31c1bc228bf4cc4"},
+		{mac.Alg2, mac.Pad2, 40, "8f12cfe9268c97428988894ed5abe5a8"},
+		{mac.Alg2, mac.Pad3, 40, "4a312752be91aa42acaddf88b6eceea7"},
+		{mac.Alg3, mac.Pad1, 40, "516d56de24b44a8c3dd422c18d5299d2"},
+		{mac.Alg3, mac.Pad2, 40, "7b0f1ac5ca5a6cb0c37dab4d7b7c0dee"},
+		{mac.Alg3, mac.Pad3, 40, "7d56c8e20b8520b0f842eb915734fc0d"},
+		{mac.Alg4, mac.Pad1, 40, "3e756c931f68cff0962b4c6233994b7c"},
+		{mac.Alg4, mac.Pad2, 40, "2bd99c8685e4ce18a47a0530c1cf8e7f"},
+		{mac.Alg4, mac.Pad3, 40, "6260b8118002a40af46fa8f3b2e5a58c"},
+		{mac.Alg4, mac.Pad1, 16, "fb934daf5525b2ef5f14802c6b508e34"},
+		{mac.Alg4, mac.Pad2, 0, "24b39880081ace0b2d0252317f91a451"},
+		{mac.Alg6, mac.Pad1, 40, "e02a4f6a3ca3f0298df8e0ac4790b915"},
+		{mac.Alg6, mac.Pad2, 40, "bcf85634cc605c3444536f6f30f1cbfb"},
+		{mac.Alg6, mac.Pad2, 32, "e2ec89608964bcad2c1b162831887bd8"},
+		{mac.Alg6, mac.Pad3, 40, "1613d5c060682d83696eafc7f9db3ff5"},
+	} {
+		h, err := mac.NewISO9797(tc.alg, tc.pad, 16, keys[tc.alg]...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkMAC(t, "ISO 9797-1", h, macMsg[:tc.n], tc.want)
+	}
+
+	// truncation keeps the leftmost bytes
+	h, _ := mac.NewISO9797(mac.Alg3, mac.Pad1, 8, k, k1)
+	checkMAC(t, "truncated", h, macMsg[:40], "516d56de24b44a8c")
+
+	h, _ = mac.NewISO9797(mac.Alg5, 0, 16, k)
+	if !bytes.Equal(h.Sum(nil), mac.NewCMAC(k).Sum(nil)) {
+		t.Errorf("Alg5 differs from NewCMAC")
+	}
+
+	for _, bad := range []struct {
+		alg  mac.Algorithm
+		pad  mac.Padding
+		size int
+		keys []cipher.Block
+	}{
+		{0, mac.Pad1, 16, []cipher.Block{k}},
+		{7, mac.Pad1, 16, []cipher.Block{k}},
+		{mac.Alg1, 4, 16, []cipher.Block{k}},
+		{mac.Alg1, mac.Pad1, 0, []cipher.Block{k}},
+		{mac.Alg1, mac.Pad1, 17, []cipher.Block{k}},
+		{mac.Alg2, mac.Pad1, 16, []cipher.Block{k}},
+		{mac.Alg4, mac.Pad1, 16, []cipher.Block{k, k1}},
+	} {
+		if _, err := mac.NewISO9797(bad.alg, bad.pad, bad.size, bad.keys...); err == nil {
+			t.Errorf("NewISO9797(%d, %d, %d, %d keys) succeeded", bad.alg, bad.pad, bad.size, len(bad.keys))
+		}
+	}
+}
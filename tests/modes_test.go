@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"errors"
+	"io"
+	"opensm/src/modes"
+	"opensm/src/sm4"
+	"testing"
+)
+
+// Expected values are from OpenSSL 3.0 SM4-ECB, -CBC, -CFB and -OFB over the
+// plaintext padded by hand.
+var (
+	modesKey   = fromHex("0123456789abcdeffedcba9876543210")
+	modesIV    = fromHex("000102030405060708090a0b0c0d0e0f")
+	modesPlain = append(fromHex("0123456789abcdeffedcba98765432100123456789abcdeffedcba9876543210"), "opensm"...)
+)
+
+func TestModesVectors(t *testing.T) {
+	b, _ := sm4.NewCipher(modesKey)
+	cbc := "a9a268883a336315bac0c9c9ff350ab1b236a4a85616d4aabf0a83555c7d4115"
+
+	for _, tc := range []struct {
+		name  string
+		pad   modes.Padding
+		ecb   bool
+		plain []byte
+		want  string
+	}{
+		{"ECB/PKCS7", modes.PKCS7, true, modesPlain,
+			"681edf34d206965e86b3e94f536e4246681edf34d206965e86b3e94f536e42460b34a2da680642b66c643e1194742bc5"},
+		{"CBC/PKCS7", modes.PKCS7, false, modesPlain, cbc + "ed0f2a07025ee5018f47ad0f05be57b7"},
+		{"CBC/PKCS7 aligned", modes.PKCS7, false, modesPlain[:32], cbc + "a0a569217184d9d496b62852fb86fd03"},
+		{"CBC/ISO7816", modes.ISO7816, false, modesPlain, cbc + "f87ecc8fcbfbadb6c9696f5a193b5cff"},
+		{"CBC/Zero", modes.Zero, false, modesPlain, cbc + "0cee2e5978062809e624c5433a6bafbb"},
+		{"CBC/None", modes.NoPadding, false, modesPlain[:32], cbc},
+	} {
+		want := fromHex(tc.want)
+		var got, back []byte
+		var err error
+		if tc.ecb {
+			got, err = modes.EncryptECB(b, modes.InsecureECB{}, tc.plain, tc.pad)
+			if err == nil {
+				back, err = modes.DecryptECB(b, modes.InsecureECB{}, got, tc.pad)
+			}
+		} else {
+			got, err = modes.EncryptCBC(b, modesIV, tc.plain, tc.pad)
+			if err == nil {
+				back, err = modes.DecryptCBC(b, modesIV, got, tc.pad)
+			}
+		}
+		if err != nil || !bytes.Equal(got, want) || !bytes.Equal(back, tc.plain) {
+			t.Errorf("%s: got %x, round trip %q, %v", tc.name, got, back, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		enc, dec func(cipher.Block, []byte, []byte) []byte
+		want     string
+	}{
+		{"CFB", modes.EncryptCFB, modes.DecryptCFB, "07bbd906b40da542d4514d1a97fccb7ab08042271f518c5ff71a31881413a02d6b3ae32dd74c"},
+		{"OFB", modes.EncryptOFB, modes.DecryptOFB, "07bbd906b40da542d4514d1a97fccb7af2cc072b3e2897929f83560cab77da303437fd26fc64"},
+	} {
+		got := tc.enc(b, modesIV, modesPlain)
+		if !bytes.Equal(got, fromHex(tc.want)) {
+			t.Errorf("%s: got %x", tc.name, got)
+		}
+		if back := tc.dec(b, modesIV, got); !bytes.Equal(back, modesPlain) {
+			t.Errorf("%s: round trip %q", tc.name, back)
+		}
+	}
+
+	// a stream split at odd points gives the same result
+	want := modes.EncryptCFB(b, modesIV, modesPlain)
+	s := modes.NewCFBDecrypter(b, modesIV)
+	got := append([]byte(nil), want...)
+	for _, cut := range [][2]int{{0, 3}, {3, 20}, {20, 21}, {21, len(got)}} {
+		s.XORKeyStream(got[cut[0]:cut[1]], got[cut[0]:cut[1]])
+	}
+	if !bytes.Equal(got, modesPlain) {
+		t.Errorf("split in-place CFB decryption = %q", got)
+	}
+}
+
+func TestUnpad(t *testing.T) {
+	valid := []struct {
+		pad   modes.Padding
+		block string
+		n     int
+	}{
+		{modes.PKCS7, "00112233445566778899aabbccddee01", 15},
+		{modes.PKCS7, "10101010101010101010101010101010", 0},
+		{modes.ISO7816, "00112233445566778899aabbccdd8000", 14},
+		{modes.ISO7816, "80000000000000000000000000000000", 0},
+		{modes.ISO7816, "00112233445566778899aabbccddee80", 15},
+		{modes.Zero, "00112233445566778899aabbcc000000", 13},
+	}
+	for _, v := range valid {
+		block := fromHex(v.block)
+		got, err := modes.Unpad(block, v.pad, 16)
+		if err != nil || len(got) != v.n {
+			t.Errorf("Unpad(%s, %d) = %d bytes, %v; want %d", v.block, v.pad, len(got), err, v.n)
+		}
+	}
+
+	for _, v := range []struct {
+		pad   modes.Padding
+		block string
+	}{
+		{modes.PKCS7, "00112233445566778899aabbccddee00"},
+		{modes.PKCS7, "00112233445566778899aabbccddee11"},
+		{modes.PKCS7, "00112233445566778899aabbcc030203"},
+		{modes.ISO7816, "00112233445566778899aabbccddee00"},
+		{modes.ISO7816, "00000000000000000000000000000000"},
+		{modes.ISO7816, "00112233445566778899aabbccdd8001"},
+		{modes.ISO7816, "00112233445566778899aabbcc800100"},
+	} {
+		if _, err := modes.Unpad(fromHex(v.block), v.pad, 16); err != modes.ErrPadding {
+			t.Errorf("Unpad(%s, %d) error %v", v.block, v.pad, err)
+		}
+	}
+
+	b, _ := sm4.NewCipher(modesKey)
+	if _, err := modes.DecryptCBC(b, modesIV, make([]byte, 17), modes.PKCS7); err != modes.ErrInputLength {
+		t.Errorf("DecryptCBC of 17 bytes: error %v", err)
+	}
+	if _, err := modes.EncryptCBC(b, modesIV, make([]byte, 17), modes.NoPadding); err != modes.ErrInputLength {
+		t.Errorf("EncryptCBC of 17 bytes without padding: error %v", err)
+	}
+}
+
+func TestModesStream(t *testing.T) {
+	b, _ := sm4.NewCipher(modesKey)
+	for _, pad := range []modes.Padding{modes.PKCS7, modes.ISO7816, modes.Zero, modes.NoPadding} {
+		for _, n := range []int{0, 1, 15, 16, 17, 4095, 4096, 4097, 10000} {
+			if pad == modes.NoPadding {
+				n &^= 15
+			}
+			plain := testBytes(n, 1)
+			if pad == modes.Zero && n > 0 {
+				plain[n-1] = 0xff
+			}
+			want, err := modes.EncryptCBC(b, modesIV, plain, pad)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			w := modes.NewEncryptWriter(&buf, cipher.NewCBCEncrypter(b, modesIV), pad)
+			for p := plain; len(p) > 0; {
+				k := min(len(p), 1000)
+				w.Write(p[:k])
+				p = p[k:]
+			}
+			if err := w.Close(); err != nil || !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("pad %d, %d bytes: writer output differs: %v", pad, n, err)
+			}
+
+			r := modes.NewDecryptReader(bytes.NewReader(want), cipher.NewCBCDecrypter(b, modesIV), pad)
+			got, err := io.ReadAll(r)
+			if err != nil || !bytes.Equal(got, plain) {
+				t.Errorf("pad %d, %d bytes: reader output differs: %v", pad, n, err)
+			}
+		}
+	}
+
+	// corrupt padding surfaces at the end as ErrPadding
+	ct, _ := modes.EncryptECB(b, modes.InsecureECB{}, testBytes(100, 2), modes.PKCS7)
+	ct[len(ct)-1] ^= 1
+	r := modes.NewDecryptReader(bytes.NewReader(ct), modes.NewECBDecrypter(b, modes.InsecureECB{}), modes.PKCS7)
+	if _, err := io.ReadAll(r); !errors.Is(err, modes.ErrPadding) {
+		t.Errorf("corrupt padding: error %v", err)
+	}
+}
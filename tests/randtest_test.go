@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/rand"
+	"math"
+	"math/big"
+	"opensm/src/drbg"
+	"opensm/src/randtest"
+	"strings"
+	"testing"
+)
+
+func bitString(s string) []byte {
+	e := make([]byte, len(s))
+	for i := range s {
+		e[i] = s[i] - '0'
+	}
+	return e
+}
+
+// eBits returns the first n bits of the binary expansion of e, the sequence
+// used for the examples of SP 800-22 Appendix B.
+func eBits(n int) []byte {
+	// sum of 1/k! for k >= 1, by binary splitting: p/q = sum_{k=a}^{b-1} (a-1)!/k!
+	var split func(a, b int64) (*big.Int, *big.Int)
+	split = func(a, b int64) (*big.Int, *big.Int) {
+		if b-a == 1 {
+			return big.NewInt(1), big.NewInt(a)
+		}
+		m := (a + b) / 2
+		p1, q1 := split(a, m)
+		p2, q2 := split(m, b)
+		p := new(big.Int).Mul(p1, q2)
+		return p.Add(p, p2), q1.Mul(q1, q2)
+	}
+
+	p, q := split(1, 75000)
+	v := new(big.Int).Add(p, q)
+	v.Lsh(v, uint(n))
+	v.Quo(v, q)
+
+	e := make([]byte, n)
+	for i := range e {
+		e[i] = byte(v.Bit(v.BitLen() - 1 - i))
+	}
+	return e
+}
+
+func checkP(t *testing.T, name string, got, want float64) {
+	if math.Abs(got-want) > 0.000001 {
+		t.Errorf("%s: P-value = %f, want %f", name, got, want)
+	}
+}
+
+func TestRandtestExamples(t *testing.T) {
+	pi := bitString("1100100100001111110110101010001000100001011010001100001000110100110001001100011001100010100010111000")
+
+	checkP(t, "frequency", randtest.Frequency(bitString("1011010101")), 0.527089)
+	checkP(t, "frequency pi", randtest.Frequency(pi), 0.109599)
+	checkP(t, "block frequency", randtest.BlockFrequency(bitString("0110011010"), 3), 0.801252)
+	checkP(t, "block frequency pi", randtest.BlockFrequency(pi, 10), 0.706438)
+	checkP(t, "runs", randtest.Runs(bitString("1001101011")), 0.147232)
+	checkP(t, "runs pi", randtest.Runs(pi), 0.500798)
+	checkP(t, "cumulative sums pi forward", randtest.CumulativeSums(pi, true), 0.219194)
+	checkP(t, "cumulative sums pi backward", randtest.CumulativeSums(pi, false), 0.114866)
+	checkP(t, "approximate entropy pi", randtest.ApproximateEntropy(pi, 2), 0.235301)
+	checkP(t, "longest run", randtest.LongestRunOfOnes(bitString(
+		"11001100000101010110110001001100111000000000001001001101010100010001001111010110100000001101011111001100111001101101100010110010")), 0.180609)
+
+	p1, p2 := randtest.Serial(bitString("0011011101"), 3)
+	checkP(t, "serial P1", p1, 0.808792)
+	checkP(t, "serial P2", p2, 0.670320)
+}
+
+func TestRandtestE(t *testing.T) {
+	e := eBits(1000000)
+
+	checkP(t, "frequency", randtest.Frequency(e), 0.953749)
+	checkP(t, "block frequency", randtest.BlockFrequency(e, 128), 0.211072)
+	checkP(t, "cumulative sums forward", randtest.CumulativeSums(e, true), 0.669887)
+	checkP(t, "cumulative sums backward", randtest.CumulativeSums(e, false), 0.724266)
+	checkP(t, "runs", randtest.Runs(e), 0.561917)
+	checkP(t, "longest run", randtest.LongestRunOfOnes(e), 0.718945)
+	checkP(t, "rank", randtest.Rank(e), 0.306156)
+	checkP(t, "universal", randtest.Universal(e, 7, 1280), 0.282568)
+	checkP(t, "approximate entropy", randtest.ApproximateEntropy(e, 10), 0.700073)
+	checkP(t, "linear complexity", randtest.LinearComplexity(e, 500), 0.826335)
+
+	p1, p2 := randtest.Serial(e, 16)
+	checkP(t, "serial P1", p1, 0.766182)
+	checkP(t, "serial P2", p2, 0.462921)
+}
+
+func TestRandtestRun(t *testing.T) {
+	d, _ := drbg.NewHashDRBG(&seqReader{}, []byte("GM/T 0005"), false)
+	results, err := randtest.Run(d, randtest.SampleBits, randtest.DefaultAlpha)
+	if err != nil {
+		t.Fatalf("Run failed : %s", err)
+	}
+	for _, r := range results {
+		if !r.Pass {
+			t.Errorf("%s: P-value %f below %v", r.Name, r.PValue, randtest.DefaultAlpha)
+		}
+	}
+
+	if _, err := randtest.Run(rand.Reader, randtest.SampleBits, 0.001); err != nil {
+		t.Errorf("Run on crypto/rand failed : %s", err)
+	}
+
+	// a constant stream fails the frequency test
+	results, _ = randtest.Run(strings.NewReader(strings.Repeat("\xff", randtest.SampleBits/8)), randtest.SampleBits, randtest.DefaultAlpha)
+	if len(results) == 0 || results[0].Pass {
+		t.Errorf("all-ones sequence passed the frequency test")
+	}
+
+	for _, n := range []int{1000, 0, -1} {
+		if _, err := randtest.Run(rand.Reader, n, randtest.DefaultAlpha); err == nil {
+			t.Errorf("Run on %d bits succeeded", n)
+		}
+	}
+}
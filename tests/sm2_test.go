@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"crypto/rand"
+	"math/big"
 	"opensm/src/sm2"
+	"opensm/src/sm3"
 	"testing"
 )
 
@@ -44,3 +47,35 @@ func TestSign(t *testing.T) {
 		t.Errorf("verify failed\n")
 	}
 }
+
+func TestZA(t *testing.T) {
+	// GM/T 0003.5-2012 signature example
+	x, _ := new(big.Int).SetString("09F9DF311E5421A150DD7D161E4BC5C672179FAD1833FC076BB08FF356F35020", 16)
+	y, _ := new(big.Int).SetString("CCEA490CE26775A52DC6EA718CC1AA600AED05FBF35E084A6632F6072DA9AD13", 16)
+	pub := &sm2.PublicKey{AffinePoint: &sm2.AffinePoint{X: x, Y: y}}
+	za, err := sm2.ZA(pub, sm2.DefaultUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fromHex("B2E14C5C79C6DF5B85F4FE7ED8DB7A262B9DA7E07CCB0EA9F4747B8CCDA8A4F3")
+	if !bytes.Equal(za, want) {
+		t.Errorf("ZA = %X", za)
+	}
+
+	h := sm3.New()
+	h.Write(za)
+	h.Write([]byte("message digest"))
+	e := h.Sum(nil)
+	if want := fromHex("F0B43E94BA45ACCAACE692ED534382EB17E6AB5A19CE7B31F4486FDFC0D28640"); !bytes.Equal(e, want) {
+		t.Errorf("e = %X", e)
+	}
+	r, _ := new(big.Int).SetString("F5A03B0648D2C4630EEAC513E1BB81A15944DA3827D5B74143AC7EACEEE720B3", 16)
+	s, _ := new(big.Int).SetString("B1B6AA29DF212FD8763182BC0D421CA1BB9038FD1F7F42D4840B69C485BBC1AA", 16)
+	if !sm2.Verify(pub, e, r, s) {
+		t.Errorf("Verify rejected the example signature")
+	}
+
+	if _, err := sm2.ZA(pub, make([]byte, 1<<13)); err == nil {
+		t.Errorf("ZA accepted a uid longer than ENTL allows")
+	}
+}
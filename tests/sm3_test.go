@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/hex"
 	"opensm/src/sm3"
 	"testing"
 )
@@ -102,3 +103,113 @@ func TestNew(t *testing.T) {
 		t.Logf("%d bytes data mix continuously test success\n", len(data2))
 	}
 }
+
+// TestWriteChunks checks that the digest does not depend on how the input is
+// split across Write calls and that Sum leaves the state unchanged.
+func TestWriteChunks(t *testing.T) {
+	msg := make([]byte, 1000)
+	for i := range msg {
+		msg[i] = byte(i * 13)
+	}
+	h := sm3.New()
+	h.Write(msg)
+	want := h.Sum(nil)
+
+	// GB/T 32905 example 2
+	h.Reset()
+	h.Write(bytes.Repeat([]byte("abcd"), 16))
+	if got, want2 := h.Sum(nil), "debe9ff92275b8a138604889c18e5a4d6fdb70e5387e5765293dcba39c0c5732"; hex.EncodeToString(got) != want2 {
+		t.Fatalf("one-shot digest %x, want %s", got, want2)
+	}
+
+	for _, chunk := range []int{1, 3, 55, 63, 64, 65, 100, 999} {
+		h.Reset()
+		for p := msg; len(p) > 0; {
+			n := min(chunk, len(p))
+			h.Write(p[:n])
+			p = p[n:]
+			if len(p) == len(msg)/2 {
+				h.Sum(nil)
+			}
+		}
+		got1 := h.Sum(nil)
+		got2 := h.Sum(nil)
+		if !bytes.Equal(got1, want) || !bytes.Equal(got2, want) {
+			t.Errorf("chunks of %d: Sum = %x then %x, want %x", chunk, got1, got2, want)
+		}
+	}
+
+	// writing after Sum continues the same message
+	h.Reset()
+	h.Write(msg[:500])
+	h.Sum(nil)
+	h.Write(msg[500:])
+	if got := h.Sum(nil); !bytes.Equal(got, want) {
+		t.Errorf("Write after Sum: %x, want %x", got, want)
+	}
+}
+
+func TestSumMany(t *testing.T) {
+	msgs := [][]byte{[]byte("abc"), {}}
+	for _, n := range []int{55, 56, 63, 64, 65, 119, 120, 128, 1024, 4096, 4100} {
+		msgs = append(msgs, make([]byte, n))
+	}
+
+	seed := uint32(1)
+	for i := 0; i < 40; i++ {
+		seed = seed*1103515245 + 12345
+		msg := make([]byte, 1024+int(seed>>16)%3072)
+		for j := range msg {
+			msg[j] = byte(seed >> 8)
+			seed = seed*1103515245 + 12345
+		}
+		msgs = append(msgs, msg)
+	}
+
+	sums := sm3.SumMany(msgs)
+	if len(sums) != len(msgs) {
+		t.Fatalf("SumMany returned %d digests for %d messages", len(sums), len(msgs))
+	}
+
+	h := sm3.New()
+	for i, msg := range msgs {
+		h.Reset()
+		h.Write(msg)
+		if want := h.Sum(nil); !bytes.Equal(sums[i][:], want) {
+			t.Errorf("message %d (%d bytes): SumMany = %x, want %x", i, len(msg), sums[i], want)
+		}
+	}
+
+	if len(sm3.SumMany(nil)) != 0 {
+		t.Errorf("SumMany(nil) returned digests")
+	}
+}
+
+func BenchmarkSumMany(b *testing.B) {
+	msgs := make([][]byte, 64)
+	for i := range msgs {
+		msgs[i] = make([]byte, 2048)
+	}
+
+	b.SetBytes(int64(len(msgs) * 2048))
+	for i := 0; i < b.N; i++ {
+		sm3.SumMany(msgs)
+	}
+}
+
+func BenchmarkSumOneByOne(b *testing.B) {
+	msgs := make([][]byte, 64)
+	for i := range msgs {
+		msgs[i] = make([]byte, 2048)
+	}
+
+	h := sm3.New()
+	b.SetBytes(int64(len(msgs) * 2048))
+	for i := 0; i < b.N; i++ {
+		for _, msg := range msgs {
+			h.Reset()
+			h.Write(msg)
+			h.Sum(nil)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"opensm/src/sm3tree"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func treeData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + 3)
+	}
+	return data
+}
+
+func TestTreeSum(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "2daef60e7a0b8f5e024c81cd2ab3109f2b4f155cf83adeb2ae5532f74a157fdf"},
+		{4 * sm3tree.LeafSize, "bf766d097dbfe45af78a1bf19bebf66aba68d008b977b5468e6db100f75d89c9"},
+		{5*sm3tree.LeafSize + sm3tree.LeafSize/2, "f39513ce42ea40bf0c35fa187652159128f2aea320d8e5733896fa461610ca9d"},
+	}
+
+	for _, tt := range tests {
+		data := treeData(tt.n)
+		want, _ := hex.DecodeString(tt.want)
+
+		h := sm3tree.New(4)
+		h.Write(data)
+		if got := h.Sum(nil); !bytes.Equal(got, want) {
+			t.Errorf("%d bytes: Sum = %x, want %x", tt.n, got, want)
+		}
+
+		// odd-sized writes straddling leaf boundaries
+		h.Reset()
+		for p := data; len(p) > 0; {
+			k := 100003
+			if k > len(p) {
+				k = len(p)
+			}
+			h.Write(p[:k])
+			p = p[k:]
+		}
+		if got := h.Sum(nil); !bytes.Equal(got, want) {
+			t.Errorf("%d bytes chunked: Sum = %x, want %x", tt.n, got, want)
+		}
+
+		got, err := sm3tree.SumReaderAt(bytes.NewReader(data), int64(len(data)), 3)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%d bytes: SumReaderAt = %x, %v, want %x", tt.n, got, err, want)
+		}
+	}
+}
+
+func TestTreeSingleLeaf(t *testing.T) {
+	want, _ := hex.DecodeString("a7fe0cdcc2194aa7a9c6bfad5637581bf051d935a10bb6a9ccabfce125c27d96")
+
+	h := sm3tree.New(0)
+	h.Write([]byte("abc"))
+	if got := h.Sum(nil); !bytes.Equal(got, want) {
+		t.Errorf("Sum = %x, want %x", got, want)
+	}
+}
+
+func TestTreeSumFile(t *testing.T) {
+	data := treeData(5*sm3tree.LeafSize + sm3tree.LeafSize/2)
+	path := filepath.Join(t.TempDir(), "image")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	h := sm3tree.New(0)
+	h.Write(data)
+	want := h.Sum(nil)
+
+	got, err := sm3tree.SumFile(path)
+	if err != nil {
+		t.Fatalf("SumFile failed : %s", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("SumFile = %x, want %x", got, want)
+	}
+
+	if _, err := sm3tree.SumFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("SumFile of a missing file succeeded")
+	}
+}
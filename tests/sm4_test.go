@@ -2,7 +2,15 @@ package main
 
 import (
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"opensm/src/sm4"
+	"sync"
 	"testing"
 	"time"
 )
@@ -64,3 +72,742 @@ func TestBlockSize(t *testing.T) {
 		t.Logf("Decrypt %d round failed!", round)
 	}
 }
+
+func TestEncryptBlocks(t *testing.T) {
+	block, _ := sm4.NewCipher(testBytes(16, 7))
+	bc := block.(sm4.Blocks)
+
+	for blocks := 0; blocks <= 130; blocks++ {
+		src := testBytes(blocks*16, byte(blocks))
+
+		want := make([]byte, len(src))
+		for i := 0; i < len(src); i += 16 {
+			block.Encrypt(want[i:i+16], src[i:i+16])
+		}
+		got := make([]byte, len(src))
+		bc.EncryptBlocks(got, src)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%d blocks: EncryptBlocks differs from Encrypt", blocks)
+		}
+
+		bc.DecryptBlocks(got, got)
+		if !bytes.Equal(got, src) {
+			t.Fatalf("%d blocks: in-place DecryptBlocks did not invert EncryptBlocks", blocks)
+		}
+		for i := 0; i < len(src); i += 16 {
+			block.Decrypt(got[i:i+16], want[i:i+16])
+		}
+		if !bytes.Equal(got, src) {
+			t.Fatalf("%d blocks: Decrypt did not invert EncryptBlocks", blocks)
+		}
+	}
+
+	// Encrypt handles exactly one block and leaves the rest of dst alone.
+	src := testBytes(48, 8)
+	dst := make([]byte, 48)
+	block.Encrypt(dst, src)
+	want := make([]byte, 16)
+	block.Encrypt(want, src[:16])
+	if !bytes.Equal(dst[:16], want) || !bytes.Equal(dst[16:], make([]byte, 32)) {
+		t.Errorf("Encrypt touched more than one block")
+	}
+}
+
+func TestBlocksPanics(t *testing.T) {
+	block, _ := sm4.NewCipher(testBytes(16, 9))
+	bc := block.(sm4.Blocks)
+	buf := make([]byte, 64)
+
+	for name, f := range map[string]func(){
+		"short src":      func() { block.Encrypt(buf[:16], buf[:15]) },
+		"short dst":      func() { block.Decrypt(buf[:15], buf[16:32]) },
+		"overlap":        func() { block.Encrypt(buf[1:17], buf[:16]) },
+		"partial block":  func() { bc.EncryptBlocks(buf, buf[:40]) },
+		"short bulk dst": func() { bc.DecryptBlocks(buf[:16], buf[16:48]) },
+		"bulk overlap":   func() { bc.EncryptBlocks(buf[16:], buf[:48]) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: no panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestMK(t *testing.T) {
+	// GB/T 32907-2016 appendix A, first and last round keys
+	rk := sm4.MK(0x01234567, 0x89abcdef, 0xfedcba98, 0x76543210)
+	if len(rk) != 32 || rk[0] != 0xf12186f9 || rk[31] != 0x9124a012 {
+		t.Errorf("MK = %08x", rk)
+	}
+}
+
+func TestKeySize(t *testing.T) {
+	for _, n := range []int{0, 1, 8, 15, 17, 24, 32} {
+		block, err := sm4.NewCipher(make([]byte, n))
+		if block != nil {
+			t.Errorf("%d-byte key: got a cipher", n)
+		}
+		var kse sm4.KeySizeError
+		if !errors.As(err, &kse) || int(kse) != n {
+			t.Errorf("%d-byte key: got error %v, want KeySizeError(%d)", n, err, n)
+		}
+	}
+
+	// the cipher must not depend on the caller's key slice
+	key := testBytes(16, 10)
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([]byte, 16)
+	block.Encrypt(want, want)
+	clear(key)
+	got := make([]byte, 16)
+	block.Encrypt(got, got)
+	if !bytes.Equal(got, want) {
+		t.Errorf("cipher changed after the key slice was cleared")
+	}
+}
+
+func TestZeroize(t *testing.T) {
+	block, _ := sm4.NewCipher(testBytes(16, 11))
+	block.(sm4.Zeroizer).Zeroize()
+
+	// with all round keys zero, both directions give the same known block
+	got := make([]byte, 32)
+	block.Encrypt(got[:16], got[:16])
+	block.(sm4.Blocks).DecryptBlocks(got[16:], got[16:])
+	for i := 0; i < 2; i++ {
+		if !bytes.Equal(got[16*i:16*i+16], []byte{
+			0x76, 0x76, 0x76, 0x76, 0x6d, 0x6d, 0x6d, 0x6d,
+			0x18, 0x18, 0x18, 0x18, 0x39, 0x39, 0x39, 0x39,
+		}) {
+			t.Errorf("round keys not wiped: %x", got[16*i:16*i+16])
+		}
+	}
+}
+
+func BenchmarkEncrypt(b *testing.B) {
+	key := make([]byte, 16)
+	buf := make([]byte, 16)
+	c, _ := sm4.NewCipher(key)
+
+	b.SetBytes(16)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c.Encrypt(buf, buf)
+	}
+}
+
+func BenchmarkDecrypt(b *testing.B) {
+	key := make([]byte, 16)
+	buf := make([]byte, 16)
+	c, _ := sm4.NewCipher(key)
+
+	b.SetBytes(16)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c.Decrypt(buf, buf)
+	}
+}
+
+// plainBlock hides the optional interfaces of the SM4 block so that
+// crypto/cipher falls back to its generic modes built on Encrypt alone.
+type plainBlock struct {
+	cipher.Block
+}
+
+func testBytes(n int, seed byte) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i)*7 + seed
+	}
+	return b
+}
+
+func TestCTR(t *testing.T) {
+	key := testBytes(16, 1)
+	iv := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xf0}
+	block, _ := sm4.NewCipher(key)
+
+	for _, n := range []int{0, 1, 15, 16, 17, 100, 127, 128, 129, 1000, 1024, 1025, 4096, 5000} {
+		src := testBytes(n, 3)
+
+		want := make([]byte, n)
+		cipher.NewCTR(plainBlock{block}, iv).XORKeyStream(want, src)
+
+		got := make([]byte, n)
+		cipher.NewCTR(block, iv).XORKeyStream(got, src)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%d bytes: CTR output differs from the reference", n)
+		}
+
+		// uneven chunks across keystream refills
+		got = make([]byte, n)
+		s := cipher.NewCTR(block, iv)
+		for off := 0; off < n; {
+			k := (off%7)*37 + 1
+			if off+k > n {
+				k = n - off
+			}
+			s.XORKeyStream(got[off:off+k], src[off:off+k])
+			off += k
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%d bytes: chunked CTR output differs from the reference", n)
+		}
+	}
+}
+
+// TestCTRBlockCounts checks every multi-block path, including the short
+// tails, against the single-block code.
+func TestCTRBlockCounts(t *testing.T) {
+	block, _ := sm4.NewCipher(testBytes(16, 5))
+	iv := testBytes(16, 6)
+
+	for blocks := 1; blocks <= 72; blocks++ {
+		src := testBytes(blocks*16, byte(blocks))
+
+		want := make([]byte, len(src))
+		cipher.NewCTR(plainBlock{block}, iv).XORKeyStream(want, src)
+
+		got := make([]byte, len(src))
+		cipher.NewCTR(block, iv).XORKeyStream(got, src)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%d blocks: CTR output differs from the reference", blocks)
+		}
+	}
+}
+
+func TestGCM(t *testing.T) {
+	key := fromHex("0123456789ABCDEFFEDCBA9876543210")
+	nonce := fromHex("00001234567800000000ABCD")
+	aad := fromHex("FEEDFACEDEADBEEFFEEDFACEDEADBEEFABADDAD2")
+	plain := fromHex("AAAAAAAAAAAAAAAABBBBBBBBBBBBBBBBCCCCCCCCCCCCCCCCDDDDDDDDDDDDDDDDEEEEEEEEEEEEEEEEFFFFFFFFFFFFFFFFEEEEEEEEEEEEEEEEAAAAAAAAAAAAAAAA")
+	want := fromHex("17F399F08C67D5EE19D0DC9969C4BB7D5FD46FD3756489069157B282BB200735D82710CA5C22F0CCFA7CBF93D496AC15A56834CBCF98C397B4024A2691233B8D" +
+		"83DE3541E4C2B58177E065A9BF7B62EC")
+
+	block, _ := sm4.NewCipher(key)
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("NewGCM failed : %s", err)
+	}
+
+	// RFC 8998 test vector
+	sealed := aead.Seal(nil, nonce, plain, aad)
+	if !bytes.Equal(sealed, want) {
+		t.Errorf("Seal = %x, want %x", sealed, want)
+	}
+	if opened, err := aead.Open(nil, nonce, sealed, aad); err != nil || !bytes.Equal(opened, plain) {
+		t.Errorf("Open = %x, %v", opened, err)
+	}
+
+	sealed[len(sealed)-1] ^= 1
+	if _, err := aead.Open(nil, nonce, sealed, aad); err == nil {
+		t.Errorf("Open accepted a forged tag")
+	}
+
+	for _, n := range []int{0, 1, 16, 100, 128, 1000, 1030, 5000} {
+		for _, nonceSize := range []int{12, 8, 16} {
+			nonce := testBytes(nonceSize, 5)
+			plain := testBytes(n, 9)
+			aad := testBytes(n%37, 11)
+
+			ref, _ := cipher.NewGCMWithNonceSize(plainBlock{block}, nonceSize)
+			aead, _ := cipher.NewGCMWithNonceSize(block, nonceSize)
+
+			want := ref.Seal(nil, nonce, plain, aad)
+			got := aead.Seal(nil, nonce, plain, aad)
+			if !bytes.Equal(got, want) {
+				t.Errorf("%d bytes, %d byte nonce: Seal differs from the reference", n, nonceSize)
+			}
+
+			opened, err := aead.Open(got[:0], nonce, got, aad)
+			if err != nil || !bytes.Equal(opened, plain) {
+				t.Errorf("%d bytes, %d byte nonce: in-place Open failed : %v", n, nonceSize, err)
+			}
+		}
+	}
+
+	ref, _ := cipher.NewGCMWithTagSize(plainBlock{block}, 12)
+	aead, _ = cipher.NewGCMWithTagSize(block, 12)
+	if got, want := aead.Seal(nil, nonce, plain, aad), ref.Seal(nil, nonce, plain, aad); !bytes.Equal(got, want) {
+		t.Errorf("12 byte tag: Seal differs from the reference")
+	}
+}
+
+func TestCCM(t *testing.T) {
+	key := fromHex("0123456789ABCDEFFEDCBA9876543210")
+	nonce := fromHex("00001234567800000000ABCD")
+	aad := fromHex("FEEDFACEDEADBEEFFEEDFACEDEADBEEFABADDAD2")
+	plain := fromHex("AAAAAAAAAAAAAAAABBBBBBBBBBBBBBBBCCCCCCCCCCCCCCCCDDDDDDDDDDDDDDDDEEEEEEEEEEEEEEEEFFFFFFFFFFFFFFFFEEEEEEEEEEEEEEEEAAAAAAAAAAAAAAAA")
+	want := fromHex("48AF93501FA62ADBCD414CCE6034D895DDA1BF8F132F042098661572E7483094FD12E518CE062C98ACEE28D95DF4416BED31A2F04476C18BB40C84A74B97DC5B" +
+		"16842D4FA186F56AB33256971FA110F4")
+
+	block, _ := sm4.NewCipher(key)
+	aead, err := sm4.NewCCM(block)
+	if err != nil {
+		t.Fatalf("NewCCM failed : %s", err)
+	}
+
+	// RFC 8998 test vector
+	sealed := aead.Seal(nil, nonce, plain, aad)
+	if !bytes.Equal(sealed, want) {
+		t.Errorf("Seal = %x, want %x", sealed, want)
+	}
+	if opened, err := aead.Open(nil, nonce, sealed, aad); err != nil || !bytes.Equal(opened, plain) {
+		t.Errorf("Open = %x, %v", opened, err)
+	}
+	for _, i := range []int{0, len(plain), len(sealed) - 1} {
+		sealed[i] ^= 1
+		if _, err := aead.Open(nil, nonce, sealed, aad); err == nil {
+			t.Errorf("Open accepted a change at byte %d", i)
+		}
+		sealed[i] ^= 1
+	}
+
+	// in place
+	buf := append([]byte(nil), plain...)
+	sealed = aead.Seal(buf[:0], nonce, buf, aad)
+	if opened, err := aead.Open(sealed[:0], nonce, sealed, aad); err != nil || !bytes.Equal(opened, plain) {
+		t.Errorf("in-place Open = %x, %v", opened, err)
+	}
+}
+
+// TestCCMSizes runs the generic mode over AES with the RFC 3610 and NIST
+// SP 800-38C examples, which exercise other nonce and tag sizes.
+func TestCCMSizes(t *testing.T) {
+	for _, tc := range []struct {
+		key, nonce, aad, plain, sealed string
+		tagSize                        int
+	}{
+		{
+			"C0C1C2C3C4C5C6C7C8C9CACBCCCDCECF", "00000003020100A0A1A2A3A4A5", "0001020304050607",
+			"08090A0B0C0D0E0F101112131415161718191A1B1C1D1E",
+			"588C979A61C663D2F066D0C2C0F989806D5F6B61DAC38417E8D12CFDF926E0", 8,
+		},
+		{
+			"404142434445464748494A4B4C4D4E4F", "10111213141516", "0001020304050607",
+			"20212223", "7162015B4DAC255D", 4,
+		},
+	} {
+		block, _ := aes.NewCipher(fromHex(tc.key))
+		nonce := fromHex(tc.nonce)
+		aead, err := sm4.NewCCMWithSize(block, len(nonce), tc.tagSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := fromHex(tc.sealed)
+		sealed := aead.Seal(nil, nonce, fromHex(tc.plain), fromHex(tc.aad))
+		if !bytes.Equal(sealed, want) {
+			t.Errorf("Seal = %x, want %x", sealed, want)
+		}
+		if opened, err := aead.Open(nil, nonce, want, fromHex(tc.aad)); err != nil || !bytes.Equal(opened, fromHex(tc.plain)) {
+			t.Errorf("Open = %x, %v", opened, err)
+		}
+	}
+
+	block, _ := sm4.NewCipher(testBytes(16, 12))
+	for nonceSize := 7; nonceSize <= 13; nonceSize++ {
+		for tagSize := 4; tagSize <= 16; tagSize += 2 {
+			aead, err := sm4.NewCCMWithSize(block, nonceSize, tagSize)
+			if err != nil {
+				t.Fatalf("nonce %d, tag %d: %v", nonceSize, tagSize, err)
+			}
+			nonce := testBytes(nonceSize, 13)
+			for _, n := range []int{0, 1, 16, 17, 1000} {
+				plain, aad := testBytes(n, 14), testBytes(n%40, 15)
+				sealed := aead.Seal(nil, nonce, plain, aad)
+				if len(sealed) != n+tagSize {
+					t.Fatalf("nonce %d, tag %d: sealed %d bytes", nonceSize, tagSize, len(sealed))
+				}
+				if opened, err := aead.Open(nil, nonce, sealed, aad); err != nil || !bytes.Equal(opened, plain) {
+					t.Errorf("nonce %d, tag %d, %d bytes: Open failed: %v", nonceSize, tagSize, n, err)
+				}
+			}
+		}
+	}
+
+	for _, sz := range [][2]int{{6, 16}, {14, 16}, {12, 2}, {12, 5}, {12, 18}} {
+		if _, err := sm4.NewCCMWithSize(block, sz[0], sz[1]); err == nil {
+			t.Errorf("nonce %d, tag %d: accepted", sz[0], sz[1])
+		}
+	}
+}
+
+func TestXTS(t *testing.T) {
+	// GB/T 17964-2021 example; the IEEE 1619 result differs only after the
+	// first block
+	key := fromHex("2B7E151628AED2A6ABF7158809CF4F3C000102030405060708090A0B0C0D0E0F")
+	tweak := (*[16]byte)(fromHex("F0F1F2F3F4F5F6F7F8F9FAFBFCFDFEFF"))
+	plain := fromHex("6BC1BEE22E409F96E93D7E117393172AAE2D8A571E03AC9C9EB76FAC45AF8E5130C81C46A35CE411E5FBC1191A0A52EFF69F2445DF4F9B17")
+	wantGB := fromHex("E9538251C71D7B80BBE4483FEF497BD12C5C581BD6242FC51E08964FB4F60FDB0BA42F63499279213D318D2C11F6886E903BE7F93A1B3479")
+	wantIEEE := fromHex("E9538251C71D7B80BBE4483FEF497BD1B3DB1A3E60408C575D63FF7DB39F83260869F9E2585FEC9F0B863BF8FD784B8627D16C0DB6D2CFC7")
+
+	// digests of a 1029-byte unit, sector 0x0123456789abcdef
+	long := make([]byte, 1029)
+	for i := range long {
+		long[i] = byte(i*31 + 7)
+	}
+	longKey := seq(1, 33)
+
+	for _, tc := range []struct {
+		name     string
+		new      func([]byte) (*sm4.XTS, error)
+		want     []byte
+		longHash string
+	}{
+		{"IEEE", sm4.NewXTS, wantIEEE, "f50dca5cf8dbf160b1eefb25fcc5b73f25693d6a02c75dda538c39f69f76b554"},
+		{"GB", sm4.NewXTSGB, wantGB, "9f9c33528576c128d4cb56c5300dd0faf67e8241a19e9cba593ea8c0d20781c2"},
+	} {
+		x, err := tc.new(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, len(plain))
+		x.EncryptTweak(got, plain, tweak)
+		if !bytes.Equal(got, tc.want) {
+			t.Errorf("%s: EncryptTweak = %X, want %X", tc.name, got, tc.want)
+		}
+		x.DecryptTweak(got, got, tweak)
+		if !bytes.Equal(got, plain) {
+			t.Errorf("%s: DecryptTweak = %X", tc.name, got)
+		}
+
+		x, _ = tc.new(longKey)
+		got = make([]byte, len(long))
+		x.Encrypt(got, long, 0x0123456789abcdef)
+		if h := sha256.Sum256(got); hex.EncodeToString(h[:]) != tc.longHash {
+			t.Errorf("%s: long unit digest %x", tc.name, h)
+		}
+
+		// every length around the multi-block and stealing boundaries
+		for n := 16; n <= 16*70+15; n += 7 {
+			src := testBytes(n, byte(n))
+			ct := make([]byte, n)
+			x.Encrypt(ct, src, uint64(n))
+			if want := xtsReference(longKey, src, uint64(n), tc.name == "GB"); !bytes.Equal(ct, want) {
+				t.Fatalf("%s: %d bytes: Encrypt differs from the one-block reference", tc.name, n)
+			}
+			pt := make([]byte, n)
+			x.Decrypt(pt, ct, uint64(n))
+			if !bytes.Equal(pt, src) {
+				t.Fatalf("%s: %d bytes: round trip failed", tc.name, n)
+			}
+			x.Encrypt(pt, pt, uint64(n))
+			if !bytes.Equal(pt, ct) {
+				t.Fatalf("%s: %d bytes: in-place Encrypt differs", tc.name, n)
+			}
+		}
+	}
+
+	if _, err := sm4.NewXTS(make([]byte, 16)); err == nil {
+		t.Errorf("NewXTS accepted a 16-byte key")
+	}
+	if _, err := sm4.NewXTS(append(seq(0, 16), seq(0, 16)...)); err == nil {
+		t.Errorf("NewXTS accepted equal key halves")
+	}
+}
+
+// xtsReference encrypts an XTS data unit one block at a time through
+// cipher.Block, to check the multi-block paths and their padding against.
+func xtsReference(key, src []byte, sector uint64, gb bool) []byte {
+	k1, _ := sm4.NewCipher(key[:16])
+	k2, _ := sm4.NewCipher(key[16:])
+	var t [16]byte
+	binary.LittleEndian.PutUint64(t[:], sector)
+	k2.Encrypt(t[:], t[:])
+	mul := func() {
+		var carry byte
+		if gb {
+			for i := range t {
+				t[i], carry = t[i]>>1|carry<<7, t[i]&1
+			}
+			t[0] ^= 0xE1 & -carry
+			return
+		}
+		for i := range t {
+			t[i], carry = t[i]<<1|carry, t[i]>>7
+		}
+		t[0] ^= 0x87 & -carry
+	}
+	block := func(dst, src []byte) {
+		subtle.XORBytes(dst, src, t[:])
+		k1.Encrypt(dst, dst)
+		subtle.XORBytes(dst, dst, t[:])
+		mul()
+	}
+
+	dst := make([]byte, len(src))
+	r := len(src) % 16
+	full := len(src) - r
+	if r != 0 {
+		full -= 16
+	}
+	for i := 0; i < full; i += 16 {
+		block(dst[i:i+16], src[i:i+16])
+	}
+	if r != 0 {
+		var cc, pp [16]byte
+		block(cc[:], src[full:full+16])
+		copy(pp[:], src[full+16:])
+		copy(pp[r:], cc[r:])
+		copy(dst[full+16:], cc[:r])
+		block(dst[full:full+16], pp[:])
+	}
+	return dst
+}
+
+// The SIV and GCM-SIV expected values come from a reference implementation
+// of RFC 5297 and RFC 8452 that reproduces the AES examples of both RFCs;
+// the inputs are those examples.
+func TestSIV(t *testing.T) {
+	for _, tc := range []struct {
+		key, plain, sealed string
+		ad                 []string
+	}{
+		{
+			"fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff", "112233445566778899aabbccddee",
+			"9a12a8d7bd932d583b0e02e45e836a7c3df7b452319cdda38530d3182a66",
+			[]string{"101112131415161718191a1b1c1d1e1f2021222324252627"},
+		},
+		{
+			"7f7e7d7c7b7a79787776757473727170404142434445464748494a4b4c4d4e4f",
+			"7468697320697320736f6d6520706c61696e7465787420746f20656e6372797074207573696e67205349562d414553",
+			"ff1180d27c75af4950aadb9dbd4c42f2956b0f048f40fe23aa108d3f62dcf34e2ac9fc0d2ab510b6a3108f3f32d75f26bdda9d6c7cee27f897f29ae5baff16",
+			[]string{"00112233445566778899aabbccddeeffdeaddadadeaddadaffeeddccbbaa99887766554433221100", "102030405060708090a0", "09f911029d74e35bd84156c5635688c0"},
+		},
+		{
+			"7f7e7d7c7b7a79787776757473727170404142434445464748494a4b4c4d4e4f", "",
+			"1e4aa42234abedf644218442d6eb68d9", []string{""},
+		},
+	} {
+		s, err := sm4.NewSIV(fromHex(tc.key), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plain, want := fromHex(tc.plain), fromHex(tc.sealed)
+		var ad [][]byte
+		for _, a := range tc.ad {
+			ad = append(ad, fromHex(a))
+		}
+
+		sealed := s.SealDeterministic(nil, plain, ad...)
+		if !bytes.Equal(sealed, want) {
+			t.Errorf("SealDeterministic = %x, want %x", sealed, want)
+		}
+		if opened, err := s.OpenDeterministic(nil, sealed, ad...); err != nil || !bytes.Equal(opened, plain) {
+			t.Errorf("OpenDeterministic = %x, %v", opened, err)
+		}
+		for _, i := range []int{0, len(sealed) - 1} {
+			sealed[i] ^= 1
+			if _, err := s.OpenDeterministic(nil, sealed, ad...); err == nil {
+				t.Errorf("OpenDeterministic accepted a change at byte %d", i)
+			}
+			sealed[i] ^= 1
+		}
+		if _, err := s.OpenDeterministic(nil, sealed, append(ad, nil)...); err == nil {
+			t.Errorf("OpenDeterministic accepted an extra additional data string")
+		}
+		if len(ad) == 1 {
+			if got := s.Seal(nil, nil, plain, ad[0]); !bytes.Equal(got, want) {
+				t.Errorf("Seal = %x, want %x", got, want)
+			}
+		}
+	}
+
+	// with a nonce, the vector is the additional data then the nonce
+	s, _ := sm4.NewSIV(seq(1, 33), 12)
+	var aead cipher.AEAD = s
+	nonce, plain, aad := seq(0, 12), testBytes(3001, 5), testBytes(1100, 9)
+	sealed := aead.Seal(nil, nonce, plain, aad)
+	if h := sha256.Sum256(sealed); hex.EncodeToString(h[:]) != "370c4cbb6e54f90f59cf8eedbd808a3f0420d001ffae96e4ba1bee657e27e30a" {
+		t.Errorf("long message digest %x", h)
+	}
+	if !bytes.Equal(sealed, s.SealDeterministic(nil, plain, aad, nonce)) {
+		t.Errorf("Seal differs from SealDeterministic(aad, nonce)")
+	}
+	buf := append([]byte(nil), plain...)
+	sealed = aead.Seal(buf[:0], nonce, buf, aad)
+	if opened, err := aead.Open(sealed[:0], nonce, sealed, aad); err != nil || !bytes.Equal(opened, plain) {
+		t.Errorf("in-place Open failed: %v", err)
+	}
+
+	if _, err := sm4.NewSIV(make([]byte, 16), 0); err == nil {
+		t.Errorf("NewSIV accepted a 16-byte key")
+	}
+}
+
+func TestSIVConcurrent(t *testing.T) {
+	s, _ := sm4.NewSIV(seq(1, 33), 0)
+	const n = 64
+	want := make([][]byte, n)
+	for i := range want {
+		want[i] = s.SealDeterministic(nil, testBytes(100+i, byte(i)), seq(0, i))
+	}
+
+	got := make([][]byte, n)
+	var wg sync.WaitGroup
+	for i := range got {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				got[i] = s.SealDeterministic(nil, testBytes(100+i, byte(i)), seq(0, i))
+				if !bytes.Equal(got[i], want[i]) {
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i := range got {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Errorf("message %d sealed concurrently = %x, want %x", i, got[i], want[i])
+		}
+	}
+}
+
+func TestGCMSIV(t *testing.T) {
+	key := fromHex("01000000000000000000000000000000")
+	nonce := fromHex("030000000000000000000000")
+	aead, err := sm4.NewGCMSIV(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct{ plain, aad, sealed string }{
+		{"", "", "1a8a0d12690856bd81e73d4b49a484a6"},
+		{"0100000000000000", "", "16e66877e329088e4f4d87a1f8258ae12df0f22b62350000"},
+		{"02000000000000000000000000000000", "01", "aaa9a7cf3dc402e35dd8620663076817d2963abb96ad5f4585d23deda863433f"},
+	} {
+		plain, aad, want := fromHex(tc.plain), fromHex(tc.aad), fromHex(tc.sealed)
+		sealed := aead.Seal(nil, nonce, plain, aad)
+		if !bytes.Equal(sealed, want) {
+			t.Errorf("Seal = %x, want %x", sealed, want)
+		}
+		if opened, err := aead.Open(nil, nonce, sealed, aad); err != nil || !bytes.Equal(opened, plain) {
+			t.Errorf("Open = %x, %v", opened, err)
+		}
+		for _, i := range []int{0, len(sealed) - 1} {
+			sealed[i] ^= 1
+			if _, err := aead.Open(nil, nonce, sealed, aad); err == nil {
+				t.Errorf("Open accepted a change at byte %d", i)
+			}
+			sealed[i] ^= 1
+		}
+	}
+
+	aead, _ = sm4.NewGCMSIV(seq(1, 17))
+	nonce, plain, aad := seq(0, 12), testBytes(3001, 5), testBytes(1100, 9)
+	sealed := aead.Seal(nil, nonce, plain, aad)
+	if h := sha256.Sum256(sealed); hex.EncodeToString(h[:]) != "bf26b8b704f07af8f552def47d68e24067d23171b7c86c0a40cea08947a41f51" {
+		t.Errorf("long message digest %x", h)
+	}
+	buf := append([]byte(nil), plain...)
+	sealed = aead.Seal(buf[:0], nonce, buf, aad)
+	if opened, err := aead.Open(sealed[:0], nonce, sealed, aad); err != nil || !bytes.Equal(opened, plain) {
+		t.Errorf("in-place Open failed: %v", err)
+	}
+}
+
+func TestParallel(t *testing.T) {
+	block, _ := sm4.NewCipher(testBytes(16, 3))
+	iv := append(bytes.Repeat([]byte{0xff}, 12), 0xff, 0xff, 0xf0, 0x00)
+	nonce := testBytes(12, 4)
+	aad := testBytes(20, 5)
+	gcm, _ := cipher.NewGCM(block)
+
+	for _, n := range []int{100, 128<<10 - 1, 128 << 10, 128<<10 + 5, 1<<20 + 7} {
+		src := testBytes(n, byte(n))
+		for _, workers := range []int{1, 3, 8} {
+			// a short first call leaves buffered keystream behind
+			want := make([]byte, n)
+			ref := cipher.NewCTR(block, iv)
+			ref.XORKeyStream(want[:5], src[:5])
+			ref.XORKeyStream(want[5:], src[5:])
+			got := make([]byte, n)
+			s, err := sm4.NewParallelCTR(block, iv, workers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.XORKeyStream(got[:5], src[:5])
+			s.XORKeyStream(got[5:], src[5:])
+			if !bytes.Equal(got, want) {
+				t.Errorf("%d bytes, %d workers: CTR differs from cipher.NewCTR", n, workers)
+			}
+
+			aead, err := sm4.NewParallelGCM(block, workers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sealed := aead.Seal(nil, nonce, src, aad)
+			if !bytes.Equal(sealed, gcm.Seal(nil, nonce, src, aad)) {
+				t.Errorf("%d bytes, %d workers: GCM differs from cipher.NewGCM", n, workers)
+			}
+			if opened, err := aead.Open(sealed[:0], nonce, sealed, aad); err != nil || !bytes.Equal(opened, src) {
+				t.Errorf("%d bytes, %d workers: Open failed: %v", n, workers, err)
+			}
+		}
+	}
+
+	if _, err := sm4.NewParallelCTR(plainBlock{block}, make([]byte, 16), 0); err == nil {
+		t.Errorf("NewParallelCTR accepted a foreign cipher.Block")
+	}
+	if _, err := sm4.NewParallelCTR(block, make([]byte, 15), 0); err == nil {
+		t.Errorf("NewParallelCTR accepted a 15-byte IV")
+	}
+	if _, err := sm4.NewParallelGCM(plainBlock{block}, 0); err == nil {
+		t.Errorf("NewParallelGCM accepted a foreign cipher.Block")
+	}
+}
+
+func BenchmarkCTR(b *testing.B) {
+	block, _ := sm4.NewCipher(make([]byte, 16))
+	buf := make([]byte, 8192)
+	s := cipher.NewCTR(block, make([]byte, 16))
+
+	b.SetBytes(int64(len(buf)))
+	for i := 0; i < b.N; i++ {
+		s.XORKeyStream(buf, buf)
+	}
+}
+
+func BenchmarkGCM(b *testing.B) {
+	block, _ := sm4.NewCipher(make([]byte, 16))
+	aead, _ := cipher.NewGCM(block)
+	buf := make([]byte, 8192)
+	nonce := make([]byte, 12)
+
+	b.SetBytes(int64(len(buf)))
+	for i := 0; i < b.N; i++ {
+		aead.Seal(buf[:0], nonce, buf, nil)
+	}
+}
+
+func BenchmarkParallelCTR(b *testing.B) {
+	block, _ := sm4.NewCipher(make([]byte, 16))
+	buf := make([]byte, 4<<20)
+	s, _ := sm4.NewParallelCTR(block, make([]byte, 16), 0)
+
+	b.SetBytes(int64(len(buf)))
+	for i := 0; i < b.N; i++ {
+		s.XORKeyStream(buf, buf)
+	}
+}
+
+func BenchmarkParallelGCM(b *testing.B) {
+	block, _ := sm4.NewCipher(make([]byte, 16))
+	aead, _ := sm4.NewParallelGCM(block, 0)
+	buf := make([]byte, 4<<20)
+	nonce := make([]byte, 12)
+
+	b.SetBytes(int64(len(buf)))
+	for i := 0; i < b.N; i++ {
+		aead.Seal(buf[:0], nonce, buf, nil)
+	}
+}
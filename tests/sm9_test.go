@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math/big"
+	"opensm/src/sm9"
+	"testing"
+)
+
+func TestSM9Pairing(t *testing.T) {
+	a, b := big.NewInt(0x1234567), big.NewInt(0x89abcdef)
+	e := sm9.Pair(sm9.Gen1(), sm9.Gen2())
+	one := new(sm9.GT).Exp(e, big.NewInt(0))
+	if e.Equal(one) {
+		t.Fatal("e(P1, P2) = 1")
+	}
+	if !new(sm9.GT).Exp(e, sm9.Order).Equal(one) {
+		t.Errorf("e(P1, P2)^N != 1")
+	}
+
+	got := sm9.Pair(new(sm9.G1).ScalarBaseMult(a), new(sm9.G2).ScalarBaseMult(b))
+	want := new(sm9.GT).Exp(e, new(big.Int).Mul(a, b))
+	if !got.Equal(want) {
+		t.Errorf("e(aP1, bP2) != e(P1, P2)^ab")
+	}
+
+	// e(P1, P2 + bP2) = e(P1, P2)·e(P1, bP2)
+	q := new(sm9.G2).ScalarBaseMult(b)
+	sum := sm9.Pair(sm9.Gen1(), new(sm9.G2).Add(sm9.Gen2(), q))
+	if !sum.Equal(new(sm9.GT).Mul(e, sm9.Pair(sm9.Gen1(), q))) {
+		t.Errorf("pairing not linear in G2")
+	}
+}
+
+func TestSM9Points(t *testing.T) {
+	k := big.NewInt(0x5eed)
+	p := new(sm9.G1).ScalarBaseMult(k)
+	var p2 sm9.G1
+	if err := p2.Unmarshal(p.Marshal()); err != nil || !p2.Equal(p) {
+		t.Errorf("G1 round trip: %v", err)
+	}
+	q := new(sm9.G2).ScalarBaseMult(k)
+	var q2 sm9.G2
+	if err := q2.Unmarshal(q.Marshal()); err != nil || !q2.Equal(q) {
+		t.Errorf("G2 round trip: %v", err)
+	}
+
+	bad := p.Marshal()
+	bad[64] ^= 1
+	if p2.Unmarshal(bad) == nil {
+		t.Errorf("G1 accepted a point off the curve")
+	}
+	bad = q.Marshal()
+	bad[128] ^= 1
+	if q2.Unmarshal(bad) == nil {
+		t.Errorf("G2 accepted a point off the curve")
+	}
+
+	if z := new(sm9.G1).ScalarMult(p, sm9.Order); !bytes.Equal(z.Marshal(), []byte{0}) {
+		t.Errorf("N·P = %x, want infinity", z.Marshal())
+	}
+}
+
+func TestSM9Sign(t *testing.T) {
+	// GM/T 0044-2016 part 5, appendix A
+	ks, _ := new(big.Int).SetString("0130E78459D78545CB54C587E02CF480CE0B66340F319F348A1D5B1F2DC5F4", 16)
+	master, err := sm9.NewSignMasterKey(ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ppub := fromHex("04" +
+		"9F64080B3084F733E48AFF4B41B565011CE0711C5E392CFB0AB1B6791B94C408" +
+		"29DBA116152D1F786CE843ED24A3B573414D2177386A92DD8F14D65696EA5E32" +
+		"69850938ABEA0112B57329F447E3A0CBAD3E2FDB1A77F335E89E1408D0EF1C25" +
+		"41E00A53DDA532DA1A7CE027B7A46F741006E85F5CDFF0730E75C05FB4E3216D")
+	if got := master.Ppub.Marshal(); !bytes.Equal(got, ppub) {
+		t.Errorf("Ppub-s = %X", got)
+	}
+
+	id := []byte("Alice")
+	user, err := master.ExtractKey(id, sm9.HIDSign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := fromHex("04" +
+		"A5702F05CF1315305E2D6EB64B0DEB923DB1A0BCF0CAFF90523AC8754AA69820" +
+		"78559A844411F9825C109F5EE3F52D720DD01785392A727BB1556952B2B013D3")
+	if got := user.D.Marshal(); !bytes.Equal(got, ds) {
+		t.Errorf("dsA = %X", got)
+	}
+
+	msg := []byte("Chinese IBS standard")
+	r := fromHex("00033C8616B06704813203DFD00965022ED15975C662337AED648835DC4B1CBE")
+	sig, err := sm9.Sign(bytes.NewReader(r), user, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := fromHex("823C4B21E4BD2DFE1ED92C606653E996668563152FC33F55D7BFBB9BD9705ADB")
+	s := fromHex("04" +
+		"73BF96923CE58B6AD0E13E9643A406D8EB98417C50EF1B29CEF9ADB48B6D598C" +
+		"856712F1C2E0968AB7769F42A99586AED139D5B8B3E15891827CC2ACED9BAA05")
+	if !bytes.Equal(sig.H.Bytes(), h) || !bytes.Equal(sig.S.Marshal(), s) {
+		t.Errorf("signature (%X, %X)", sig.H, sig.S.Marshal())
+	}
+
+	if !sm9.Verify(&master.SignMasterPublicKey, id, sm9.HIDSign, msg, sig) {
+		t.Errorf("Verify rejected the example signature")
+	}
+	if sm9.Verify(&master.SignMasterPublicKey, []byte("Bob"), sm9.HIDSign, msg, sig) {
+		t.Errorf("Verify accepted another identity")
+	}
+	if sm9.Verify(&master.SignMasterPublicKey, id, sm9.HIDSign, msg[1:], sig) {
+		t.Errorf("Verify accepted another message")
+	}
+
+	var sig2 sm9.Signature
+	if err := sig2.Unmarshal(sig.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	if sig2.H.Cmp(sig.H) != 0 || !sig2.S.Equal(sig.S) {
+		t.Errorf("signature round trip changed it")
+	}
+}
+
+func TestSM9SignRandom(t *testing.T) {
+	master, err := sm9.GenerateSignMasterKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := []byte("alice@example.com")
+	user, err := master.ExtractKey(id, sm9.HIDSign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("message")
+	sig, err := sm9.Sign(rand.Reader, user, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sm9.Verify(&master.SignMasterPublicKey, id, sm9.HIDSign, msg, sig) {
+		t.Errorf("Verify rejected a fresh signature")
+	}
+
+	other, _ := sm9.GenerateSignMasterKey(rand.Reader)
+	if sm9.Verify(&other.SignMasterPublicKey, id, sm9.HIDSign, msg, sig) {
+		t.Errorf("Verify accepted a signature under another master key")
+	}
+}
+
+// sm9EncryptMaster returns the master encryption key of GM/T 0044-2016
+// part 4, appendices C and D.
+func sm9EncryptMaster(t *testing.T) *sm9.EncryptMasterPrivateKey {
+	ke, _ := new(big.Int).SetString("01EDEE3778F441F8DEA3D9FA0ACC4E07EE36C93F9A08618AF4AD85CEDE1C22", 16)
+	master, err := sm9.NewEncryptMasterKey(ke)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ppub := fromHex("04" +
+		"787ED7B8A51F3AB84E0A66003F32DA5C720B17ECA7137D39ABC66E3C80A892FF" +
+		"769DE61791E5ADC4B9FF85A31354900B202871279A8C49DC3F220F644C57A7B1")
+	if got := master.Ppub.Marshal(); !bytes.Equal(got, ppub) {
+		t.Errorf("Ppub-e = %X", got)
+	}
+	return master
+}
+
+func TestSM9KEM(t *testing.T) {
+	master := sm9EncryptMaster(t)
+	id := []byte("Bob")
+	user, err := master.ExtractKey(id, sm9.HIDEncrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	de := fromHex("04" +
+		"94736ACD2C8C8796CC4785E938301A139A059D3537B6414140B2D31EECF41683" +
+		"115BAE85F5D8BC6C3DBD9E5342979ACCCF3C2F4F28420B1CB4F8C0B59A19B158" +
+		"7AA5E47570DA7600CD760A0CF7BEAF71C447F3844753FE74FA7BA92CA7D3B55F" +
+		"27538A62E7F7BFB51DCE08704796D94C9D56734F119EA44732B50E31CDEB75C1")
+	if got := user.D.Marshal(); !bytes.Equal(got, de) {
+		t.Errorf("deB = %X", got)
+	}
+	qb := fromHex("04" +
+		"709D165808B0A43E2574E203FA885ABCBAB16A240C4C1916552E7C43D09763B8" +
+		"693269A6BE2456F43333758274786B6051FF87B7F198DA4BA1A2C6E336F51FCC")
+	if got := master.UserKey(id, sm9.HIDEncrypt).Marshal(); !bytes.Equal(got, qb) {
+		t.Errorf("QB = %X", got)
+	}
+
+	r := fromHex("000074015F8489C01EF4270456F9E6475BFB602BDE7F33FD482AB4E3684A6722")
+	key, c, err := sm9.Encapsulate(bytes.NewReader(r), &master.EncryptMasterPublicKey, id, sm9.HIDEncrypt, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantC := fromHex("04" +
+		"1EDEE2C3F465914491DE44CEFB2CB434AB02C308D9DC5E2067B4FED5AAAC8A0F" +
+		"1C9B4C435ECA35AB83BB734174C0F78FDE81A53374AFF3B3602BBC5E37BE9A4C")
+	wantK := fromHex("4FF5CF86D2AD40C8F4BAC98D76ABDBDE0C0E2F0A829D3F911EF5B2BCE0695480")
+	if !bytes.Equal(c.Marshal(), wantC) || !bytes.Equal(key, wantK) {
+		t.Errorf("Encapsulate = %X, %X", key, c.Marshal())
+	}
+
+	got, err := sm9.Decapsulate(user, id, c, 32)
+	if err != nil || !bytes.Equal(got, wantK) {
+		t.Errorf("Decapsulate = %X, %v", got, err)
+	}
+	if got, _ := sm9.Decapsulate(user, []byte("Alice"), c, 32); bytes.Equal(got, wantK) {
+		t.Errorf("Decapsulate recovered the key under another identity")
+	}
+
+	for _, n := range []int{0, -1} {
+		if _, _, err := sm9.Encapsulate(rand.Reader, &master.EncryptMasterPublicKey, id, sm9.HIDEncrypt, n); err == nil {
+			t.Errorf("Encapsulate accepted key length %d", n)
+		}
+		if _, err := sm9.Decapsulate(user, id, c, n); err == nil {
+			t.Errorf("Decapsulate accepted key length %d", n)
+		}
+	}
+}
+
+func TestSM9Encrypt(t *testing.T) {
+	master := sm9EncryptMaster(t)
+	id := []byte("Bob")
+	user, err := master.ExtractKey(id, sm9.HIDEncrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("Chinese IBE standard")
+	r := fromHex("0000AAC0541779C8FC45E3E2CB25C12B5D2576B2129AE8BB5EE2CBE5EC9E785C")
+	c1 := "2445471164490618E1EE20528FF1D545B0F14C8BCAA44544F03DAB5DAC07D8FF" +
+		"42FFCA97D57CDDC05EA405F2E586FEB3A6930715532B8000759F13059ED59AC0"
+	for _, tt := range []struct {
+		name   string
+		cipher sm9.Cipher
+		want   []byte
+	}{
+		{"XOR", sm9.XORCipher, fromHex(c1 +
+			"BA672387BCD6DE5016A158A52BB2E7FC429197BCAB70B25AFEE37A2B9DB9F367" +
+			"1B5F5B0E951489682F3E64E1378CDD5DA9513B1C")},
+		{"SM4", sm9.SM4Cipher, fromHex(c1 +
+			"FD3C98DD92C44C68332675A370CCEEDE31E0C5CD209C257601149D12B394A2BE" +
+			"E05B6FAC6F11B965268C994F00DBA7A8BB00FD60583546CBDF4649250863F10A")},
+	} {
+		ct, err := sm9.Encrypt(bytes.NewReader(r), &master.EncryptMasterPublicKey, id, sm9.HIDEncrypt, msg, tt.cipher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(ct, tt.want) {
+			t.Errorf("%s: Encrypt = %X", tt.name, ct)
+		}
+		pt, err := sm9.Decrypt(user, id, ct, tt.cipher)
+		if err != nil || !bytes.Equal(pt, msg) {
+			t.Errorf("%s: Decrypt = %q, %v", tt.name, pt, err)
+		}
+
+		ct[len(ct)-1] ^= 1
+		if _, err := sm9.Decrypt(user, id, ct, tt.cipher); err == nil {
+			t.Errorf("%s: Decrypt accepted a modified ciphertext", tt.name)
+		}
+	}
+}
+
+func TestSM9EncryptRandom(t *testing.T) {
+	master, err := sm9.GenerateEncryptMasterKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := []byte("bob@example.com")
+	user, err := master.ExtractKey(id, sm9.HIDEncrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []sm9.Cipher{sm9.XORCipher, sm9.SM4Cipher} {
+		for _, n := range []int{0, 1, 16, 33} {
+			msg := make([]byte, n)
+			rand.Read(msg)
+			ct, err := sm9.Encrypt(rand.Reader, &master.EncryptMasterPublicKey, id, sm9.HIDEncrypt, msg, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pt, err := sm9.Decrypt(user, id, ct, c)
+			if err != nil || !bytes.Equal(pt, msg) {
+				t.Errorf("cipher %d, %d bytes: Decrypt = %x, %v", c, n, pt, err)
+			}
+		}
+	}
+}
+
+func TestSM9KeyExchange(t *testing.T) {
+	// GM/T 0044-2016 part 3, appendix B
+	ke, _ := new(big.Int).SetString("02E65B0762D042F51F0D23542B13ED8CFA2E9A0E7206361E013A283905E31F", 16)
+	master, err := sm9.NewEncryptMasterKey(ke)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ppub := fromHex("04" +
+		"9174542668E8F14AB273C0945C3690C66E5DD09678B86F734C4350567ED06283" +
+		"54E598C6BF749A3DACC9FFFEDD9DB6866C50457CFC7AA2A4AD65C3168FF74210")
+	if got := master.Ppub.Marshal(); !bytes.Equal(got, ppub) {
+		t.Errorf("Ppub-e = %X", got)
+	}
+
+	ida, idb := []byte("Alice"), []byte("Bob")
+	keyA, err := master.ExtractKey(ida, sm9.HIDExchange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyB, err := master.ExtractKey(idb, sm9.HIDExchange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := sm9.NewKeyExchange(keyA, ida, idb, sm9.HIDExchange, 16, true)
+	b, _ := sm9.NewKeyExchange(keyB, idb, ida, sm9.HIDExchange, 16, true)
+
+	ra := fromHex("00005879DD1D51E175946F23B1B41E93BA31C584AE59A426EC1046A4D03B06C8")
+	init, err := a.Init(bytes.NewReader(ra))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRA := fromHex("04" +
+		"7CBA5B19069EE66AA79D490413D11846B9BA76DD22567F809CF23B6D964BB265" +
+		"A9760C99CB6F706343FED05637085864958D6C90902ABA7D405FBEDF7B781599")
+	if got := init.Marshal(); !bytes.Equal(got, wantRA) {
+		t.Errorf("RA = %X", got)
+	}
+
+	rb := fromHex("00018B98C44BEF9F8537FB7D071B2C928B3BC65BD3D69E1EEE213564905634FE")
+	resp, skb, err := b.Respond(bytes.NewReader(rb), init)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantKey := fromHex("C5C13A8F59A97CDEAE64F16A2272A9E7")
+	wantSB := fromHex("3BB4BCEE8139C960B4D6566DB1E0D5F0B2767680E5E1BF934103E6C66E40FFEE")
+	if !bytes.Equal(skb, wantKey) || !bytes.Equal(resp.S, wantSB) {
+		t.Errorf("Respond = %X, SB %X", skb, resp.S)
+	}
+
+	var resp2 sm9.ExchangeResponse
+	if err := resp2.Unmarshal(resp.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	ska, conf, err := a.Finish(&resp2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSA := fromHex("195D1B7256BA7E0E67C71202A25F8C94FF8241702C2F55D613AE1C6B98215172")
+	if !bytes.Equal(ska, wantKey) || !bytes.Equal(conf.S, wantSA) {
+		t.Errorf("Finish = %X, SA %X", ska, conf.S)
+	}
+
+	var conf2 sm9.ExchangeConfirm
+	if err := conf2.Unmarshal(conf.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Confirm(&conf2); err != nil {
+		t.Errorf("Confirm: %v", err)
+	}
+}
+
+func TestSM9KeyExchangeRandom(t *testing.T) {
+	master, err := sm9.GenerateEncryptMasterKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ida, idb := []byte("alice@example.com"), []byte("bob@example.com")
+	keyA, _ := master.ExtractKey(ida, sm9.HIDExchange)
+	keyB, _ := master.ExtractKey(idb, sm9.HIDExchange)
+
+	for _, n := range []int{0, -1} {
+		if _, err := sm9.NewKeyExchange(keyA, ida, idb, sm9.HIDExchange, n, true); err == nil {
+			t.Errorf("NewKeyExchange accepted key length %d", n)
+		}
+	}
+
+	// without confirmation, and with a key longer than one SM3 output
+	a, _ := sm9.NewKeyExchange(keyA, ida, idb, sm9.HIDExchange, 48, false)
+	b, _ := sm9.NewKeyExchange(keyB, idb, ida, sm9.HIDExchange, 48, false)
+	init, err := a.Init(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var init2 sm9.ExchangeInit
+	if err := init2.Unmarshal(init.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	resp, skb, err := b.Respond(rand.Reader, &init2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Marshal()) != 65 {
+		t.Errorf("response carries SB without confirmation")
+	}
+	ska, conf, err := a.Finish(resp)
+	if err != nil || conf != nil {
+		t.Fatalf("Finish = %v, %v", conf, err)
+	}
+	if len(ska) != 48 || !bytes.Equal(ska, skb) {
+		t.Errorf("keys differ: %X, %X", ska, skb)
+	}
+
+	// a party with another identity's key fails confirmation
+	keyC, _ := master.ExtractKey([]byte("carol@example.com"), sm9.HIDExchange)
+	a, _ = sm9.NewKeyExchange(keyA, ida, idb, sm9.HIDExchange, 16, true)
+	c, _ := sm9.NewKeyExchange(keyC, idb, ida, sm9.HIDExchange, 16, true)
+	init, _ = a.Init(rand.Reader)
+	resp, _, err = c.Respond(rand.Reader, init)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := a.Finish(resp); err == nil {
+		t.Errorf("Finish accepted an impostor's response")
+	}
+	if _, _, err := a.Finish(resp); err == nil {
+		t.Errorf("Finish ran twice")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"opensm/src/stream"
+	"testing"
+)
+
+const streamHeaderSize = 28
+
+func encryptStream(t *testing.T, key, ad, plain []byte, segSize int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := stream.NewEncryptWriterSize(&buf, key, ad, segSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// uneven writes cross segment boundaries
+	for p := plain; len(p) > 0; {
+		n := min(len(p), 37)
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decryptStream(key, ad, ct []byte) ([]byte, error) {
+	r, err := stream.NewDecryptReader(bytes.NewReader(ct), key, ad)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestStream(t *testing.T) {
+	key, ad := seq(0, 32), []byte("file.bin")
+	for _, segSize := range []int{1, 16, 100} {
+		for _, n := range []int{0, 1, segSize - 1, segSize, segSize + 1, 3 * segSize, 3*segSize + 5, 1000} {
+			plain := testBytes(n, byte(n))
+			ct := encryptStream(t, key, ad, plain, segSize)
+			segments := max((n+segSize-1)/segSize, 1)
+			if len(ct) != streamHeaderSize+n+16*segments {
+				t.Errorf("%d/%d: ciphertext is %d bytes", segSize, n, len(ct))
+			}
+
+			got, err := decryptStream(key, ad, ct)
+			if err != nil || !bytes.Equal(got, plain) {
+				t.Errorf("%d/%d: decrypt failed: %v", segSize, n, err)
+			}
+
+			ra, err := stream.NewDecryptReaderAt(bytes.NewReader(ct), int64(len(ct)), key, ad)
+			if err != nil {
+				t.Fatalf("%d/%d: NewDecryptReaderAt: %v", segSize, n, err)
+			}
+			if ra.Size() != int64(n) {
+				t.Errorf("%d/%d: Size = %d", segSize, n, ra.Size())
+			}
+			for off := 0; off <= n; off += 7 {
+				p := make([]byte, 2*segSize+3)
+				k, err := ra.ReadAt(p, int64(off))
+				want := plain[off:min(off+len(p), n)]
+				if !bytes.Equal(p[:k], want) || (k < len(p)) != (err == io.EOF) {
+					t.Fatalf("%d/%d: ReadAt(%d) = %d, %v", segSize, n, off, k, err)
+				}
+			}
+		}
+	}
+}
+
+func TestStreamTampering(t *testing.T) {
+	key, ad := seq(0, 16), []byte("ad")
+	const segSize = 32
+	ct := encryptStream(t, key, ad, testBytes(4*segSize+10, 1), segSize)
+	segCT := segSize + 16
+	body := func(i int) []byte { return ct[streamHeaderSize+i*segCT : streamHeaderSize+(i+1)*segCT] }
+
+	swapped := append([]byte(nil), ct...)
+	copy(swapped[streamHeaderSize:], body(1))
+	copy(swapped[streamHeaderSize+segCT:], body(0))
+	flipped := append([]byte(nil), ct...)
+	flipped[len(flipped)-1] ^= 1
+
+	for _, tc := range []struct {
+		name string
+		ct   []byte
+		key  []byte
+		ad   []byte
+	}{
+		{"truncated at a segment", ct[:streamHeaderSize+2*segCT], key, ad},
+		{"truncated in a segment", ct[:len(ct)-3], key, ad},
+		{"last segment dropped", ct[:streamHeaderSize+4*segCT], key, ad},
+		{"appended segment", append(append([]byte(nil), ct...), body(0)...), key, ad},
+		{"appended byte", append(append([]byte(nil), ct...), 0), key, ad},
+		{"reordered", swapped, key, ad},
+		{"modified", flipped, key, ad},
+		{"wrong additional data", ct, key, []byte("other")},
+		{"wrong key", ct, seq(1, 17), ad},
+	} {
+		if _, err := decryptStream(tc.key, tc.ad, tc.ct); !errors.Is(err, stream.ErrAuth) {
+			t.Errorf("%s: Reader error %v", tc.name, err)
+		}
+		ra, err := stream.NewDecryptReaderAt(bytes.NewReader(tc.ct), int64(len(tc.ct)), tc.key, tc.ad)
+		if err == nil {
+			_, err = ra.ReadAt(make([]byte, ra.Size()), 0)
+		}
+		if !errors.Is(err, stream.ErrAuth) {
+			t.Errorf("%s: ReaderAt error %v", tc.name, err)
+		}
+	}
+
+	for _, bad := range [][]byte{ct[:10], append([]byte{2}, ct[1:]...)} {
+		if _, err := stream.NewDecryptReader(bytes.NewReader(bad), key, ad); !errors.Is(err, stream.ErrHeader) {
+			t.Errorf("bad header: error %v", err)
+		}
+	}
+
+	w, _ := stream.NewEncryptWriter(io.Discard, key, nil)
+	w.Close()
+	if _, err := w.Write([]byte{1}); !errors.Is(err, stream.ErrClosed) {
+		t.Errorf("Write after Close: error %v", err)
+	}
+	if _, err := stream.NewEncryptWriter(io.Discard, key[:15], nil); err == nil {
+		t.Errorf("NewEncryptWriter accepted a 15-byte key")
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"opensm/src/sm2"
+	"opensm/src/sm3"
+	"opensm/src/x509"
+	"testing"
+	"time"
+)
+
+// SM2 fixtures issued outside this module: an intermediate CA certificate
+// from the Chinese national root CA, a self-signed root made by OpenSSL 3,
+// and a certificate request and signing key from a cloud KMS.
+
+const x509SHECACert = `-----BEGIN CERTIFICATE-----
+MIICiDCCAiygAwIBAgIQLaGmvQznbGJOY0t9ainQKjAMBggqgRzPVQGDdQUAMC4x
+CzAJBgNVBAYTAkNOMQ4wDAYDVQQKDAVOUkNBQzEPMA0GA1UEAwwGUk9PVENBMB4X
+DTEzMDkxMzA4MTAyNVoXDTMzMDkwODA4MTAyNVowNDELMAkGA1UEBhMCQ04xETAP
+BgNVBAoMCFVuaVRydXN0MRIwEAYDVQQDDAlTSEVDQSBTTTIwWTATBgcqhkjOPQIB
+BggqgRzPVQGCLQNCAAR90R+RLQZKVBDwhIRVJR28ovu1x3duw2yxaWaY6E3lUKDW
+IsmAwMOqE71MW3gQOxm68QJfPy6JT4Evil10FwyAo4IBIjCCAR4wHwYDVR0jBBgw
+FoAUTDKxl9kzG8SmBcHG5YtiW/CXdlgwDwYDVR0TAQH/BAUwAwEB/zCBugYDVR0f
+BIGyMIGvMEGgP6A9pDswOTELMAkGA1UEBhMCQ04xDjAMBgNVBAoMBU5SQ0FDMQww
+CgYDVQQLDANBUkwxDDAKBgNVBAMMA2FybDAqoCigJoYkaHR0cDovL3d3dy5yb290
+Y2EuZ292LmNuL2FybC9hcmwuY3JsMD6gPKA6hjhsZGFwOi8vbGRhcC5yb290Y2Eu
+Z292LmNuOjM4OS9DTj1hcmwsT1U9QVJMLE89TlJDQUMsQz1DTjAOBgNVHQ8BAf8E
+BAMCAQYwHQYDVR0OBBYEFIkxBJF7Q6qqmr+EHZuG7vC4cJmgMAwGCCqBHM9VAYN1
+BQADSAAwRQIhAIp7/3vva+ZxFePKdqkzdGoVyGsfGHhiLLQeKrCZQ2Q5AiAmMOdf
+0f0b8CilrVWdi8pfZyO6RqYfnpcJ638l7KHfNA==
+-----END CERTIFICATE-----
+`
+
+const x509OpenSSLRoot = `-----BEGIN CERTIFICATE-----
+MIICGzCCAcCgAwIBAgIUZ2YpsJJVNcwfjCHBEz8otQDEpUEwCgYIKoEcz1UBg3Uw
+YjELMAkGA1UEBhMCSU4xEjAQBgNVBAgMCUJlbmdhbHVydTENMAsGA1UEBwwEQ2l0
+eTEQMA4GA1UECgwHU29tZU9yZzENMAsGA1UECwwEVGVzdDEPMA0GA1UEAwwGUm9v
+dENBMB4XDTI0MDgyNzAyMzQ1NloXDTM0MDgyNTAyMzQ1NlowYjELMAkGA1UEBhMC
+SU4xEjAQBgNVBAgMCUJlbmdhbHVydTENMAsGA1UEBwwEQ2l0eTEQMA4GA1UECgwH
+U29tZU9yZzENMAsGA1UECwwEVGVzdDEPMA0GA1UEAwwGUm9vdENBMFowFAYIKoEc
+z1UBgi0GCCqBHM9VAYItA0IABC8HaH8+WYCtUk06wAFfzR09nnOlQOJ2oORwD25m
+S55CdJv+Svzji0nSeSWtXBzo9y4Q6EKLDpOSQbKYeswVDoejUzBRMB0GA1UdDgQW
+BBRSGm5/62dcOw8vkiG8YGoZMf6UIzAfBgNVHSMEGDAWgBRSGm5/62dcOw8vkiG8
+YGoZMf6UIzAPBgNVHRMBAf8EBTADAQH/MAoGCCqBHM9VAYN1A0kAMEYCIQDC4s3P
+wAKTEz+410/odAO30Wzam895L31T1MQ0EaBYtQIhALbw1l4lcun4RTVWYQN5A2r2
+Cm2A1bCQaLWY1jsQTBpf
+-----END CERTIFICATE-----
+`
+
+// A root and two leaves issued by OpenSSL 3.0.17, with
+//
+//	openssl req -new -x509 -key ca.key -sm3 -sigopt distid:1234567812345678 ...
+//	openssl x509 -req -in leaf.csr -CA ca.pem -CAkey ca.key -sm3 \
+//		-sigopt distid:1234567812345678 ...
+//
+// for the first leaf and no -sigopt, so the empty ID, for the second.
+
+const x509OpenSSLChainRoot = `-----BEGIN CERTIFICATE-----
+MIIBxTCCAWygAwIBAgIBATAKBggqgRzPVQGDdTA6MQswCQYDVQQGEwJDTjEQMA4G
+A1UECgwHRXhhbXBsZTEZMBcGA1UEAwwQT3BlblNTTCBTTTIgUm9vdDAeFw0yNjEw
+MTgyMDIwNTVaFw00NjEwMTMyMDIwNTVaMDoxCzAJBgNVBAYTAkNOMRAwDgYDVQQK
+DAdFeGFtcGxlMRkwFwYDVQQDDBBPcGVuU1NMIFNNMiBSb290MFkwEwYHKoZIzj0C
+AQYIKoEcz1UBgi0DQgAE88Bmsm1KBIHkrO7F2o7tQxRNrCUcUaxBHVBi+rHsZwP2
+4zv+zfziQioAMf34oaDqCvEhFoD90N4YdItVo+xVG6NjMGEwHwYDVR0jBBgwFoAU
+lFS1eBrvVC259pdUM9QCSZntniswDwYDVR0TAQH/BAUwAwEB/zAOBgNVHQ8BAf8E
+BAMCAQYwHQYDVR0OBBYEFJRUtXga71QtufaXVDPUAkmZ7Z4rMAoGCCqBHM9VAYN1
+A0cAMEQCIEQnWdz4pu+AT+sPmxrf6Nc93Dant/p2WmrPnKItVyY0AiBvs+8ncUwR
+03gaOgH+3zmFlVQnJ/OxlaREPSoDpSZwZw==
+-----END CERTIFICATE-----
+`
+
+const x509OpenSSLLeaf = `-----BEGIN CERTIFICATE-----
+MIIB4DCCAYagAwIBAgIBAjAKBggqgRzPVQGDdTA6MQswCQYDVQQGEwJDTjEQMA4G
+A1UECgwHRXhhbXBsZTEZMBcGA1UEAwwQT3BlblNTTCBTTTIgUm9vdDAeFw0yNjEw
+MTgyMDIwNTVaFw0zNjEwMTUyMDIwNTVaMDoxCzAJBgNVBAYTAkNOMRAwDgYDVQQK
+DAdFeGFtcGxlMRkwFwYDVQQDDBBsZWFmLmV4YW1wbGUuY29tMFkwEwYHKoZIzj0C
+AQYIKoEcz1UBgi0DQgAEuxpZYz/B96mZQV1u+DbsOKQR3z427o+xmYx+4oWeU9kW
+S2FZbuWYnO1tvpU0t3jxjUvCY988WLaCZUi/X2K56aN9MHswDAYDVR0TAQH/BAIw
+ADAOBgNVHQ8BAf8EBAMCB4AwHQYDVR0OBBYEFKPWTGZK/8UY0TKy4a7hdpbZP5jp
+MB8GA1UdIwQYMBaAFJRUtXga71QtufaXVDPUAkmZ7Z4rMBsGA1UdEQQUMBKCEGxl
+YWYuZXhhbXBsZS5jb20wCgYIKoEcz1UBg3UDSAAwRQIhAMAd8ZjfD6otOc06HGMO
+k7Mvgsg45xWMdkfvt//s3pcGAiApwvTGURFF8Gvtked18KKelltgJrPD78lR+Qts
+NmXucg==
+-----END CERTIFICATE-----
+`
+
+const x509OpenSSLLeafNoID = `-----BEGIN CERTIFICATE-----
+MIIB4DCCAYagAwIBAgIBAzAKBggqgRzPVQGDdTA6MQswCQYDVQQGEwJDTjEQMA4G
+A1UECgwHRXhhbXBsZTEZMBcGA1UEAwwQT3BlblNTTCBTTTIgUm9vdDAeFw0yNjEw
+MTgyMDIxMDBaFw0zNjEwMTUyMDIxMDBaMDoxCzAJBgNVBAYTAkNOMRAwDgYDVQQK
+DAdFeGFtcGxlMRkwFwYDVQQDDBBub2lkLmV4YW1wbGUuY29tMFkwEwYHKoZIzj0C
+AQYIKoEcz1UBgi0DQgAEwnlRvm8ijMyTPQj40TbLXdnQ1PM+VoaMnnp0H9iKR4NM
+lQ1eU7naWB3LMol9TSBSiOGFxfUxKMBuriLxhgzsE6N9MHswDAYDVR0TAQH/BAIw
+ADAOBgNVHQ8BAf8EBAMCB4AwHQYDVR0OBBYEFPECROM/lmsZi4Gqo1DUHsl86UGs
+MB8GA1UdIwQYMBaAFJRUtXga71QtufaXVDPUAkmZ7Z4rMBsGA1UdEQQUMBKCEGxl
+YWYuZXhhbXBsZS5jb20wCgYIKoEcz1UBg3UDSAAwRQIhAMwgGkAqc6ncsfVIkFxS
+5Ift0Acsbrkct9hkRLTdTTLUAiAkbwb0CmC0M3PIZ0hQ68N/UdZIrljXh4wZJ2KA
+fAPtWA==
+-----END CERTIFICATE-----
+`
+
+const x509AliCSR = `-----BEGIN CERTIFICATE REQUEST-----
+MIIBYjCCAQkCAQAwRzELMAkGA1UEBhMCQ04xEzARBgNVBAMMCkNhcmdvU21hcnQx
+DzANBgNVBAcMBlpodWhhaTESMBAGA1UECAwJR3Vhbmdkb25nMFkwEwYHKoZIzj0C
+AQYIKoEcz1UBgi0DQgAERrsLH25zLm2LIo6tivZM9afLprSX6TCKAmQJArAO7VOt
+ZyW4PQwfaTsUIF7IXEFG4iI8bNuTQwMykUzLu2ypEKBgMC4GCSqGSIb3DQEJDjEh
+MB8wHQYDVR0OBBYEFA3FO8vT+8qZBfGZa2TRhLRbme+9MC4GCSqGSIb3DQEJDjEh
+MB8wHQYDVR0RBBYwFIESZW1tYW4uc3VuQGlxYXguY29tMAoGCCqBHM9VAYN1A0cA
+MEQCIBQx6yv3rzfWCkKqDZQOfNKESQc6NtpQbeVvcxfBrciwAiAj78kkrF5R3g4l
+bxIHjKZHc2sztHCXe7cseWGiLq0syg==
+-----END CERTIFICATE REQUEST-----
+`
+
+const x509AliKey = `-----BEGIN PUBLIC KEY-----
+MFkwEwYHKoZIzj0CAQYIKoEcz1UBgi0DQgAERrsLH25zLm2LIo6tivZM9afLprSX
+6TCKAmQJArAO7VOtZyW4PQwfaTsUIF7IXEFG4iI8bNuTQwMykUzLu2ypEA==
+-----END PUBLIC KEY-----
+`
+
+// x509AliSig is a signature by x509AliKey of the SM3(ZA || M) digest
+// x509AliDigest.
+const (
+	x509AliDigest = "Zsfw9GLu7dnR8tRr3BDk4kFnxIdc8veiKX2gK49LqOA="
+	x509AliSig    = "MEUCIHV5hOCgYzlO4HkrUhct1Cc8BeKmbXNP+ASje5rGOcCYAiEA2XOajXo3/IihtCEJmNpImtWw3uHIy5CX5TIxit7V0gQ="
+)
+
+func pemBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	b, _ := pem.Decode([]byte(s))
+	if b == nil {
+		t.Fatal("no PEM block")
+	}
+	return b.Bytes
+}
+
+func TestX509ParseExternal(t *testing.T) {
+	root, err := x509.ParseCertificate(pemBytes(t, x509OpenSSLRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Subject.CommonName != "RootCA" || !root.IsCA || root.Version != 3 {
+		t.Errorf("root: %v, CA %v, version %d", root.Subject, root.IsCA, root.Version)
+	}
+	if !root.SignatureAlgorithm.Equal(x509.OIDSignatureSM2WithSM3) {
+		t.Errorf("root signature algorithm %v", root.SignatureAlgorithm)
+	}
+	// OpenSSL 3 signs with an empty ID unless given one, not the default
+	if err := root.CheckSignatureFrom(root); err == nil {
+		t.Errorf("self signature with an empty ID checked with the default ID")
+	}
+	at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	if chain, err := root.Verify(x509.VerifyOptions{Roots: []*x509.Certificate{root}, CurrentTime: at}); err != nil || len(chain) != 1 {
+		t.Errorf("Verify = %d certificates, %v", len(chain), err)
+	}
+	// OpenSSL leaves out the key usage extension
+	if err := root.CheckProfile(); err == nil {
+		t.Errorf("CheckProfile accepted a root without key usage")
+	}
+
+	ca, err := x509.ParseCertificate(pemBytes(t, x509SHECACert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca.Subject.CommonName != "SHECA SM2" || ca.Issuer.CommonName != "ROOTCA" {
+		t.Errorf("subject %v, issuer %v", ca.Subject, ca.Issuer)
+	}
+	if ca.KeyUsage != x509.KeyUsageCertSign|x509.KeyUsageCRLSign || !ca.IsCA || ca.MaxPathLen != -1 {
+		t.Errorf("key usage %b, CA %v, path length %d", ca.KeyUsage, ca.IsCA, ca.MaxPathLen)
+	}
+	if len(ca.SubjectKeyId) != 20 || len(ca.AuthorityKeyId) != 20 {
+		t.Errorf("key ids %X, %X", ca.SubjectKeyId, ca.AuthorityKeyId)
+	}
+	if err := ca.CheckProfile(); err != nil {
+		t.Errorf("CheckProfile: %v", err)
+	}
+	if _, err := ca.Verify(x509.VerifyOptions{Roots: []*x509.Certificate{root}, CurrentTime: at}); err == nil {
+		t.Errorf("Verify accepted a certificate under an unrelated root")
+	}
+}
+
+func TestX509VerifyOpenSSLChain(t *testing.T) {
+	root, err := x509.ParseCertificate(pemBytes(t, x509OpenSSLChainRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(pemBytes(t, x509OpenSSLLeaf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	noID, err := x509.ParseCertificate(pemBytes(t, x509OpenSSLLeafNoID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := x509.VerifyOptions{
+		Roots:       []*x509.Certificate{root},
+		CurrentTime: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	chain, err := leaf.Verify(opts)
+	if err != nil || len(chain) != 2 || chain[1] != root {
+		t.Errorf("Verify = %d certificates, %v", len(chain), err)
+	}
+	if err := leaf.CheckSignatureFrom(root); err != nil {
+		t.Errorf("CheckSignatureFrom: %v", err)
+	}
+	if _, err := noID.Verify(opts); err == nil {
+		t.Errorf("Verify accepted an empty-ID signature with the default ID")
+	}
+
+	opts.UID = []byte{}
+	if chain, err := noID.Verify(opts); err != nil || len(chain) != 2 {
+		t.Errorf("Verify with the empty ID = %d certificates, %v", len(chain), err)
+	}
+	if _, err := leaf.Verify(opts); err == nil {
+		t.Errorf("Verify accepted a default-ID signature with the empty ID")
+	}
+}
+
+func TestX509RequestExternal(t *testing.T) {
+	csr, err := x509.ParseCertificateRequest(pemBytes(t, x509AliCSR))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		t.Errorf("CheckSignature: %v", err)
+	}
+	if csr.Subject.CommonName != "CargoSmart" || len(csr.EmailAddresses) != 1 || csr.EmailAddresses[0] != "emman.sun@iqax.com" {
+		t.Errorf("subject %v, emails %q", csr.Subject, csr.EmailAddresses)
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(pemBytes(t, x509AliKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub.X.Cmp(csr.PublicKey.X) != 0 || pub.Y.Cmp(csr.PublicKey.Y) != 0 {
+		t.Errorf("KMS key and request key differ")
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil || !bytes.Equal(der, pemBytes(t, x509AliKey)) {
+		t.Errorf("MarshalPKIXPublicKey = %X, %v", der, err)
+	}
+
+	e, _ := base64.StdEncoding.DecodeString(x509AliDigest)
+	sig, _ := base64.StdEncoding.DecodeString(x509AliSig)
+	var rs struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+		t.Fatal(err)
+	}
+	if !sm2.Verify(pub, e, rs.R, rs.S) {
+		t.Errorf("KMS signature rejected")
+	}
+}
+
+func TestX509CreateChain(t *testing.T) {
+	now := time.Now()
+	rootKey, _ := sm2.GenerateKeySM2P256(rand.Reader)
+	interKey, _ := sm2.GenerateKeySM2P256(rand.Reader)
+	leafKey, _ := sm2.GenerateKeySM2P256(rand.Reader)
+
+	ca := func(serial int64, name string, pathLen int) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{Country: []string{"CN"}, CommonName: name},
+			NotBefore:             now.Add(-time.Hour),
+			NotAfter:              now.Add(24 * time.Hour),
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			MaxPathLen:            pathLen,
+			MaxPathLenZero:        pathLen == 0,
+		}
+	}
+	create := func(template, parent *x509.Certificate, pub *sm2.PublicKey, priv *sm2.PrivateKey) *x509.Certificate {
+		t.Helper()
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	root := create(ca(1, "Test Root", 1), ca(1, "Test Root", 1), &rootKey.PublicKey, rootKey)
+	inter := create(ca(2, "Test Intermediate", 0), root, &interKey.PublicKey, rootKey)
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{Country: []string{"CN"}, CommonName: "server.example.com"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"server.example.com"},
+		IPAddresses:  []net.IP{net.ParseIP("192.0.2.1")},
+	}
+	leaf := create(leafTemplate, inter, &leafKey.PublicKey, interKey)
+
+	if !inter.MaxPathLenZero || root.MaxPathLen != 1 || len(root.SubjectKeyId) != 20 {
+		t.Errorf("path lengths %d, %d, root key id %X", root.MaxPathLen, inter.MaxPathLen, root.SubjectKeyId)
+	}
+	if !bytes.Equal(leaf.AuthorityKeyId, inter.SubjectKeyId) || leaf.DNSNames[0] != "server.example.com" ||
+		!leaf.IPAddresses[0].Equal(net.ParseIP("192.0.2.1")) || leaf.ExtKeyUsage[0] != x509.ExtKeyUsageServerAuth {
+		t.Errorf("leaf fields not kept: %+v", leaf)
+	}
+	for _, c := range []*x509.Certificate{root, inter, leaf} {
+		if err := c.CheckProfile(); err != nil {
+			t.Errorf("%s: CheckProfile: %v", c.Subject.CommonName, err)
+		}
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         []*x509.Certificate{root},
+		Intermediates: []*x509.Certificate{inter},
+		CheckProfile:  true,
+	}
+	chain, err := leaf.Verify(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 3 || chain[1] != inter || chain[2] != root {
+		t.Errorf("chain of %d certificates", len(chain))
+	}
+
+	opts.CurrentTime = now.Add(2 * time.Hour)
+	if _, err := leaf.Verify(opts); err == nil {
+		t.Errorf("Verify accepted an expired certificate")
+	}
+	opts.CurrentTime = time.Time{}
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: []*x509.Certificate{root}}); err == nil {
+		t.Errorf("Verify built a chain without the intermediate")
+	}
+
+	// the intermediate's path length of zero forbids another CA below it
+	sub := create(ca(4, "Test Sub CA", 0), inter, &leafKey.PublicKey, interKey)
+	if _, err := sub.Verify(opts); err != nil {
+		t.Errorf("Verify rejected a CA directly under the intermediate: %v", err)
+	}
+	leaf2 := create(leafTemplate, sub, &rootKey.PublicKey, leafKey)
+	opts.Intermediates = append(opts.Intermediates, sub)
+	if _, err := leaf2.Verify(opts); err == nil {
+		t.Errorf("Verify ignored the path length constraint")
+	}
+
+	tampered := *leaf
+	tampered.RawTBSCertificate = append([]byte(nil), leaf.RawTBSCertificate...)
+	tampered.RawTBSCertificate[len(tampered.RawTBSCertificate)-1] ^= 1
+	if err := tampered.CheckSignatureFrom(inter); err == nil {
+		t.Errorf("CheckSignatureFrom accepted a modified certificate")
+	}
+	if err := inter.CheckSignatureFrom(leaf); err == nil {
+		t.Errorf("CheckSignatureFrom accepted a non-CA parent")
+	}
+	if _, err := x509.CreateCertificate(rand.Reader, leafTemplate, inter, &leafKey.PublicKey, rootKey); err == nil {
+		t.Errorf("CreateCertificate signed with a key not matching the parent")
+	}
+
+	msg := []byte("signed data")
+	sig, err := sm2Sign(leafKey, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := leaf.CheckSignature(msg, sig); err != nil {
+		t.Errorf("CheckSignature: %v", err)
+	}
+	if err := leaf.CheckSignature(msg[1:], sig); err == nil {
+		t.Errorf("CheckSignature accepted another message")
+	}
+}
+
+// sm2Sign returns the DER SM2 signature of msg for the default ID.
+func sm2Sign(priv *sm2.PrivateKey, msg []byte) ([]byte, error) {
+	za, err := sm2.ZA(&priv.PublicKey, sm2.DefaultUID)
+	if err != nil {
+		return nil, err
+	}
+	h := sm3.New()
+	h.Write(za)
+	h.Write(msg)
+	r, s, err := sm2.Sign(rand.Reader, priv, h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(struct{ R, S *big.Int }{r, s})
+}
+
+func TestX509CreateRequest(t *testing.T) {
+	priv, _ := sm2.GenerateKeySM2P256(rand.Reader)
+	template := &x509.CertificateRequest{
+		Subject:        pkix.Name{Country: []string{"CN"}, Organization: []string{"Example"}, CommonName: "client"},
+		EmailAddresses: []string{"client@example.com"},
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: []byte{5, 0}},
+		},
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		t.Errorf("CheckSignature: %v", err)
+	}
+	if csr.Subject.CommonName != "client" || len(csr.EmailAddresses) != 1 || len(csr.Extensions) != 2 {
+		t.Errorf("subject %v, emails %q, %d extensions", csr.Subject, csr.EmailAddresses, len(csr.Extensions))
+	}
+	if csr.PublicKey.X.Cmp(priv.X) != 0 || csr.PublicKey.Y.Cmp(priv.Y) != 0 {
+		t.Errorf("public key changed")
+	}
+
+	der[len(der)-1] ^= 1
+	if csr, err := x509.ParseCertificateRequest(der); err == nil && csr.CheckSignature() == nil {
+		t.Errorf("CheckSignature accepted a modified request")
+	}
+}